@@ -1,7 +1,7 @@
 package statful
 
 import (
-	"strings"
+	"context"
 	"sync"
 )
 
@@ -12,12 +12,29 @@ type buffer struct {
 	disableAutoFlush bool
 
 	mu sync.Mutex
+	// flushing tracks the flushes of the metrics drained for the current sender, so the sender can be closed
+	// once they are done when it is replaced.
+	flushing *sync.WaitGroup
 
-	stdBuf []string
-	aggBuf map[Aggregation]map[AggregationFrequency][]string
+	stdBuf []Metric
+	aggBuf map[Aggregation]map[AggregationFrequency][]Metric
 
-	Sender Sender
-	Logger Logger
+	Sender  Sender
+	Logger  Logger
+	Stats   *Stats
+	Encoder Encoder
+}
+
+// drained holds the metrics taken out of the buffer along with the sender, encoder and dry run mode at drain time,
+// so a reconfiguration only applies to the metrics drained after it. The metrics are encoded when flushed,
+// for each destination sender.
+type drained struct {
+	stdBuf   []Metric
+	aggBuf   map[Aggregation]map[AggregationFrequency][]Metric
+	sender   Sender
+	encoder  Encoder
+	dryRun   bool
+	flushing *sync.WaitGroup
 }
 
 func (s *buffer) Put(name string, value float64, tags Tags, timestamp int64, aggregations Aggregations, frequency AggregationFrequency, opts ...PutOption) error {
@@ -26,12 +43,13 @@ func (s *buffer) Put(name string, value float64, tags Tags, timestamp int64, agg
 
 	p := newPutOptions(opts)
 
-	s.stdBuf = append(s.stdBuf, MetricToString(name, value, p.user, tags, timestamp, aggregations, frequency))
+	m := Metric{Name: name, Value: value, User: p.user, Tags: tags, Timestamp: timestamp, Aggregations: aggregations, Frequency: frequency}
+	s.stdBuf = append(s.stdBuf, m)
 	s.metricCount++
+	s.Stats.metricsPut()
 
 	if !s.disableAutoFlush && s.metricCount >= s.flushSize {
-		stdBuf, aggBuf := s.drainBuffers()
-		go s.flushBuffers(stdBuf, aggBuf)
+		go s.flushBuffers(context.Background(), s.drainBuffers())
 	}
 	s.mu.Unlock()
 
@@ -45,15 +63,16 @@ func (s *buffer) PutAggregated(name string, value float64, tags Tags, timestamp
 	p := newPutOptions(opts)
 
 	if s.aggBuf[aggregation] == nil {
-		s.aggBuf[aggregation] = make(map[AggregationFrequency][]string)
+		s.aggBuf[aggregation] = make(map[AggregationFrequency][]Metric)
 	}
 
-	s.aggBuf[aggregation][frequency] = append(s.aggBuf[aggregation][frequency], MetricToString(name, value, p.user, tags, timestamp, Aggregations{}, 0))
+	m := Metric{Name: name, Value: value, User: p.user, Tags: tags, Timestamp: timestamp}
+	s.aggBuf[aggregation][frequency] = append(s.aggBuf[aggregation][frequency], m)
 	s.metricCount++
+	s.Stats.metricsPut()
 
 	if !s.disableAutoFlush && s.metricCount >= s.flushSize {
-		stdBuf, aggBuf := s.drainBuffers()
-		go s.flushBuffers(stdBuf, aggBuf)
+		go s.flushBuffers(context.Background(), s.drainBuffers())
 	}
 	s.mu.Unlock()
 
@@ -62,66 +81,97 @@ func (s *buffer) PutAggregated(name string, value float64, tags Tags, timestamp
 
 func (s *buffer) Flush() {
 	s.mu.Lock()
-	stdBuf, aggBuf := s.drainBuffers()
+	d := s.drainBuffers()
 	s.mu.Unlock()
 
-	_ = s.flushBuffers(stdBuf, aggBuf)
+	_ = s.flushBuffers(context.Background(), d)
 }
 
 // FlushError flushes the buffer and returns a FlushErr error if any errors happen.
 func (s *buffer) FlushError() error {
+	return s.FlushContext(context.Background())
+}
+
+// FlushContext flushes the buffer using ctx for the sends and returns a FlushErr error if any errors happen.
+func (s *buffer) FlushContext(ctx context.Context) error {
 	s.mu.Lock()
-	stdBuf, aggBuf := s.drainBuffers()
+	d := s.drainBuffers()
 	s.mu.Unlock()
 
-	return s.flushBuffers(stdBuf, aggBuf)
+	return s.flushBuffers(ctx, d)
 }
 
-func (s *buffer) drainBuffers() ([]string, map[Aggregation]map[AggregationFrequency][]string) {
-	var stdBuf []string
-	var aggBuf map[Aggregation]map[AggregationFrequency][]string
+func (s *buffer) drainBuffers() drained {
+	d := drained{sender: s.Sender, encoder: s.Encoder, dryRun: s.dryRun, flushing: s.flushingGroup()}
+	d.flushing.Add(1)
 
 	if s.metricCount > 0 {
-		stdBuf = s.stdBuf
-		s.stdBuf = make([]string, 0, s.flushSize)
+		d.stdBuf = s.stdBuf
+		s.stdBuf = make([]Metric, 0, s.flushSize)
 
-		aggBuf = s.aggBuf
-		s.aggBuf = make(map[Aggregation]map[AggregationFrequency][]string)
+		d.aggBuf = s.aggBuf
+		s.aggBuf = make(map[Aggregation]map[AggregationFrequency][]Metric)
 
 		s.metricCount = 0
 	}
 
-	return stdBuf, aggBuf
+	return d
 }
 
-func (s *buffer) flushBuffers(stdBuf []string, aggBuf map[Aggregation]map[AggregationFrequency][]string) error {
-	var flushErr FlushErr
+func (s *buffer) flushingGroup() *sync.WaitGroup {
+	if s.flushing == nil {
+		s.flushing = &sync.WaitGroup{}
+	}
+
+	return s.flushing
+}
 
-	if len(stdBuf) > 0 {
-		if s.dryRun {
-			for _, m := range stdBuf {
-				s.Logger.Println("Dry metric:", m)
+func (s *buffer) flushBuffers(ctx context.Context, d drained) error {
+	defer d.flushing.Done()
+
+	var flushErr FlushErr
+	logger := structuredLoggerFor(s.Logger)
+	ctx = contextWithStats(ctx, s.Stats)
+
+	if len(d.stdBuf) > 0 {
+		if d.dryRun {
+			encoder := encoderFor(d.sender, d.encoder)
+			for _, m := range d.stdBuf {
+				line := encoder.Encode(m)
+				logLegacy(logger, []interface{}{"Dry metric:", line}, LevelInfo, "Dry metric:", "metric", line)
 			}
 		} else {
-			err := s.Sender.Send(strings.NewReader(strings.Join(stdBuf, "\n")))
-			if err != nil {
-				s.Logger.Println("Failed to send metrics", err)
+			err := sendMetricsContext(ctx, d.sender, metricBatch{metrics: d.stdBuf, encoder: d.encoder})
+			s.Stats.metricsFlushed(len(d.stdBuf), err)
+			if err == ErrSendBuffered {
+				logger.Log(LevelWarn, "Metrics buffered while the sender reconnects", "buffered", len(d.stdBuf))
+			} else if err != nil {
+				logLegacy(logger, []interface{}{"Failed to send metrics", err}, LevelError, "Failed to send metrics", "error", err, "dropped", len(d.stdBuf))
 				flushErr = flushErr.appendErr(err)
+			} else {
+				logger.Log(LevelDebug, "Flushed metrics", "count", len(d.stdBuf))
 			}
 		}
 	}
 
-	for agg, freqs := range aggBuf {
+	for agg, freqs := range d.aggBuf {
 		for freq, buf := range freqs {
-			if s.dryRun {
-				s.Logger.Println("Dry aggregated metric:", buf, agg, freq)
+			b := metricBatch{metrics: buf, encoder: d.encoder, aggregated: true, agg: agg, freq: freq}
+			if d.dryRun {
+				lines := b.lines(encoderFor(d.sender, d.encoder))
+				logLegacy(logger, []interface{}{"Dry aggregated metric:", lines, agg, freq}, LevelInfo, "Dry aggregated metric:", "metrics", lines, "aggregation", agg, "frequency", freq)
 				continue
 			}
 
-			err := s.Sender.SendAggregated(strings.NewReader(strings.Join(buf, "\n")), agg, freq)
-			if err != nil {
-				s.Logger.Println("Failed to send aggregated metrics", err)
+			err := sendMetricsContext(ctx, d.sender, b)
+			s.Stats.metricsFlushed(len(buf), err)
+			if err == ErrSendBuffered {
+				logger.Log(LevelWarn, "Aggregated metrics buffered while the sender reconnects", "buffered", len(buf), "aggregation", agg, "frequency", freq)
+			} else if err != nil {
+				logLegacy(logger, []interface{}{"Failed to send aggregated metrics", err}, LevelError, "Failed to send aggregated metrics", "error", err, "dropped", len(buf), "aggregation", agg, "frequency", freq)
 				flushErr = flushErr.appendErr(err)
+			} else {
+				logger.Log(LevelDebug, "Flushed aggregated metrics", "count", len(buf), "aggregation", agg, "frequency", freq)
 			}
 		}
 	}
@@ -0,0 +1,322 @@
+package statful
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The capture format written by WriterSender and FileSender has one record per line:
+//
+//	metric[,tag1=value] value unix_timestamp [aggregations]   plain metric, as sent to Send
+//	@aggregation,frequency metric[,tag1=value] value unix_timestamp   aggregated metric
+//	{"eventId":...}   event, as newline delimited JSON
+const (
+	captureAggregatedPrefix = '@'
+	captureEventPrefix      = '{'
+)
+
+type CaptureKind int
+
+const (
+	CaptureMetric CaptureKind = iota
+	CaptureAggregated
+	CaptureEvent
+)
+
+// CaptureRecord is a record read from a capture file. Line holds the metric line, without the aggregation prefix,
+// or the event JSON.
+type CaptureRecord struct {
+	Kind        CaptureKind
+	Line        string
+	Aggregation Aggregation
+	Frequency   AggregationFrequency
+	LineNumber  int
+}
+
+// CaptureError reports a malformed record and the line it was found on.
+type CaptureError struct {
+	LineNumber int
+	Line       string
+	Err        error
+}
+
+func (c *CaptureError) Error() string {
+	return fmt.Sprintf("line %d: %v", c.LineNumber, c.Err)
+}
+
+func (c *CaptureError) Unwrap() error {
+	return c.Err
+}
+
+// CaptureScanner reads the records of a capture file, as written by WriterSender and FileSender.
+// Scan stops on read errors only, malformed records are returned by Record as a *CaptureError.
+type CaptureScanner struct {
+	scanner    *bufio.Scanner
+	lineNumber int
+	record     CaptureRecord
+	err        error
+}
+
+func NewCaptureScanner(r io.Reader) *CaptureScanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), DefaultMaxBufferSize)
+
+	return &CaptureScanner{scanner: scanner}
+}
+
+// Scan advances to the next non empty record, it returns false at the end of the input or on a read error.
+func (c *CaptureScanner) Scan() bool {
+	for c.scanner.Scan() {
+		c.lineNumber++
+
+		line := strings.TrimSpace(c.scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		c.record, c.err = parseCaptureRecord(line)
+		c.record.LineNumber = c.lineNumber
+		if c.err != nil {
+			c.err = &CaptureError{LineNumber: c.lineNumber, Line: line, Err: c.err}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// Record returns the record read by the last call to Scan.
+func (c *CaptureScanner) Record() (CaptureRecord, error) {
+	return c.record, c.err
+}
+
+// Err returns the first read error.
+func (c *CaptureScanner) Err() error {
+	return c.scanner.Err()
+}
+
+// OpenCapture opens the capture file at path, decompressing it when the name ends in .gz like the files rotated
+// by FileSender with Compress set.
+func OpenCapture(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return &gzipFileReader{Reader: gr, file: f}, nil
+}
+
+type gzipFileReader struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g *gzipFileReader) Close() error {
+	err := g.Reader.Close()
+	if fileErr := g.file.Close(); err == nil {
+		err = fileErr
+	}
+
+	return err
+}
+
+// CaptureBatch holds capture records of the same kind, and for aggregated metrics of the same aggregation and
+// frequency, in capture order.
+type CaptureBatch struct {
+	Kind        CaptureKind
+	Aggregation Aggregation
+	Frequency   AggregationFrequency
+	Records     []CaptureRecord
+}
+
+// Send sends the records with the sender method matching their kind, the events as a JSON array.
+func (b CaptureBatch) Send(sender Sender) error {
+	lines := make([]string, len(b.Records))
+	for idx, record := range b.Records {
+		lines[idx] = record.Line
+	}
+
+	switch b.Kind {
+	case CaptureAggregated:
+		return sender.SendAggregated(strings.NewReader(strings.Join(lines, "\n")), b.Aggregation, b.Frequency)
+	case CaptureEvent:
+		return sender.SendEvents(strings.NewReader("[" + strings.Join(lines, ",") + "]"))
+	default:
+		return sender.Send(strings.NewReader(strings.Join(lines, "\n")))
+	}
+}
+
+type captureBatchKey struct {
+	kind CaptureKind
+	agg  Aggregation
+	freq AggregationFrequency
+}
+
+// CaptureBatcher groups the records read by a CaptureScanner in batches of at most Size records,
+// a Size of zero or less puts every record in its own batch.
+type CaptureBatcher struct {
+	Size int
+
+	batches map[captureBatchKey]*CaptureBatch
+	order   []captureBatchKey
+}
+
+// Add appends the record to the batch of its kind, returning the batch once it holds Size records.
+func (c *CaptureBatcher) Add(record CaptureRecord) (CaptureBatch, bool) {
+	key := captureBatchKey{kind: record.Kind}
+	if record.Kind == CaptureAggregated {
+		key.agg, key.freq = record.Aggregation, record.Frequency
+	}
+
+	if c.batches == nil {
+		c.batches = map[captureBatchKey]*CaptureBatch{}
+	}
+	b, ok := c.batches[key]
+	if !ok {
+		b = &CaptureBatch{Kind: key.kind, Aggregation: key.agg, Frequency: key.freq}
+		c.batches[key] = b
+		c.order = append(c.order, key)
+	}
+
+	b.Records = append(b.Records, record)
+	if len(b.Records) < c.Size {
+		return CaptureBatch{}, false
+	}
+
+	full := *b
+	b.Records = nil
+	return full, true
+}
+
+// Flush returns the batches not yet full, in the order their kind was first added, and empties the batcher.
+func (c *CaptureBatcher) Flush() []CaptureBatch {
+	var batches []CaptureBatch
+	for _, key := range c.order {
+		if b := c.batches[key]; len(b.Records) > 0 {
+			batches = append(batches, *b)
+		}
+	}
+	c.batches, c.order = nil, nil
+
+	return batches
+}
+
+func parseCaptureRecord(line string) (CaptureRecord, error) {
+	switch line[0] {
+	case captureEventPrefix:
+		if !json.Valid([]byte(line)) {
+			return CaptureRecord{Kind: CaptureEvent, Line: line}, fmt.Errorf("invalid event json")
+		}
+		return CaptureRecord{Kind: CaptureEvent, Line: line}, nil
+	case captureAggregatedPrefix:
+		record := CaptureRecord{Kind: CaptureAggregated}
+
+		sep := strings.IndexByte(line, ' ')
+		if sep < 0 {
+			return record, fmt.Errorf("missing metric after aggregation prefix")
+		}
+		record.Line = strings.TrimSpace(line[sep+1:])
+
+		parts := strings.Split(line[1:sep], ",")
+		if len(parts) != 2 || parts[0] == "" {
+			return record, fmt.Errorf("invalid aggregation prefix %q", line[:sep])
+		}
+		freq, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return record, fmt.Errorf("invalid aggregation frequency %q", parts[1])
+		}
+		record.Aggregation = Aggregation(parts[0])
+		record.Frequency = AggregationFrequency(freq)
+
+		return record, nil
+	default:
+		return CaptureRecord{Kind: CaptureMetric, Line: line}, nil
+	}
+}
+
+// appendCaptureMetrics appends the metric lines in data to dst, prefixed with the aggregation and frequency
+// when prefix is set.
+func appendCaptureMetrics(dst *bytes.Buffer, data []byte, prefix string) {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		dst.WriteString(prefix)
+		dst.Write(line)
+		dst.WriteByte('\n')
+	}
+}
+
+func captureAggregatedLinePrefix(agg Aggregation, freq AggregationFrequency) string {
+	return string(captureAggregatedPrefix) + string(agg) + "," + strconv.Itoa(int(freq)) + " "
+}
+
+// appendCaptureEvents appends the events in data to dst as newline delimited JSON.
+// Besides NDJSON it accepts the JSON array produced by JsonArraySerializer and the envelope produced by
+// EnvelopeSerializer.
+func appendCaptureEvents(dst *bytes.Buffer, data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil
+	}
+
+	switch trimmed[0] {
+	case '[':
+		var events []json.RawMessage
+		if err := json.Unmarshal(trimmed, &events); err != nil {
+			return err
+		}
+		return appendCaptureRawEvents(dst, events)
+	case '{':
+		if events, ok := unwrapEventEnvelope(trimmed); ok {
+			return appendCaptureRawEvents(dst, events)
+		}
+	}
+
+	appendCaptureMetrics(dst, trimmed, "")
+	return nil
+}
+
+// unwrapEventEnvelope returns the events of an EnvelopeSerializer payload, ok is false for any other payload,
+// e.g. a single NDJSON event.
+func unwrapEventEnvelope(data []byte) ([]json.RawMessage, bool) {
+	var envelope struct {
+		Version *int              `json:"v"`
+		Events  []json.RawMessage `json:"events"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil || envelope.Version == nil || envelope.Events == nil {
+		return nil, false
+	}
+
+	return envelope.Events, true
+}
+
+func appendCaptureRawEvents(dst *bytes.Buffer, events []json.RawMessage) error {
+	for _, event := range events {
+		if err := json.Compact(dst, event); err != nil {
+			return err
+		}
+		dst.WriteByte('\n')
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package statful
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCaptureScanner(t *testing.T) {
+	capture := strings.Join([]string{
+		"test.demo.metric,env=test 100.000000 1585161000 count,10",
+		"",
+		"@avg,30 test.demo.aggregated 200.000000 1585161001",
+		`{"eventId":"1"}`,
+		"@avg test.demo.aggregated 200.000000 1585161001",
+		"@avg,x test.demo.aggregated 200.000000 1585161001",
+		`{"eventId":`,
+	}, "\n")
+
+	expected := []struct {
+		record CaptureRecord
+		err    bool
+	}{
+		{record: CaptureRecord{Kind: CaptureMetric, Line: "test.demo.metric,env=test 100.000000 1585161000 count,10", LineNumber: 1}},
+		{record: CaptureRecord{Kind: CaptureAggregated, Line: "test.demo.aggregated 200.000000 1585161001", Aggregation: AggAvg, Frequency: Freq30s, LineNumber: 3}},
+		{record: CaptureRecord{Kind: CaptureEvent, Line: `{"eventId":"1"}`, LineNumber: 4}},
+		{err: true},
+		{err: true},
+		{err: true},
+	}
+
+	scanner := NewCaptureScanner(strings.NewReader(capture))
+	idx := 0
+	for scanner.Scan() {
+		if idx >= len(expected) {
+			t.Fatal("more records than expected")
+		}
+
+		record, err := scanner.Record()
+		if expected[idx].err {
+			var captureErr *CaptureError
+			if !errors.As(err, &captureErr) || captureErr.LineNumber != idx+2 {
+				t.Errorf("record %d: expected a CaptureError on line %d, got: %v", idx, idx+2, err)
+			}
+		} else if err != nil || record != expected[idx].record {
+			t.Errorf("record %d: got %+v (%v), expected %+v", idx, record, err, expected[idx].record)
+		}
+		idx++
+	}
+
+	if scanner.Err() != nil {
+		t.Errorf("Err() returned: %v", scanner.Err())
+	}
+	if idx != len(expected) {
+		t.Errorf("read %d records, expected %d", idx, len(expected))
+	}
+}
+
+func TestCaptureBatcher(t *testing.T) {
+	records := []CaptureRecord{
+		{Kind: CaptureMetric, Line: "a 1 1", LineNumber: 1},
+		{Kind: CaptureAggregated, Line: "b 2 2", Aggregation: AggAvg, Frequency: Freq10s, LineNumber: 2},
+		{Kind: CaptureMetric, Line: "c 3 3", LineNumber: 3},
+		{Kind: CaptureAggregated, Line: "d 4 4", Aggregation: AggSum, Frequency: Freq10s, LineNumber: 4},
+		{Kind: CaptureEvent, Line: `{"eventId":"1"}`, LineNumber: 5},
+		{Kind: CaptureMetric, Line: "e 5 5", LineNumber: 6},
+	}
+
+	batcher := &CaptureBatcher{Size: 2}
+	var batches []CaptureBatch
+	for _, record := range records {
+		if b, full := batcher.Add(record); full {
+			batches = append(batches, b)
+		}
+	}
+	batches = append(batches, batcher.Flush()...)
+
+	expected := []CaptureBatch{
+		{Kind: CaptureMetric, Records: []CaptureRecord{records[0], records[2]}},
+		{Kind: CaptureMetric, Records: []CaptureRecord{records[5]}},
+		{Kind: CaptureAggregated, Aggregation: AggAvg, Frequency: Freq10s, Records: []CaptureRecord{records[1]}},
+		{Kind: CaptureAggregated, Aggregation: AggSum, Frequency: Freq10s, Records: []CaptureRecord{records[3]}},
+		{Kind: CaptureEvent, Records: []CaptureRecord{records[4]}},
+	}
+	if !reflect.DeepEqual(batches, expected) {
+		t.Errorf("batches: %+v, expected: %+v", batches, expected)
+	}
+	if rest := batcher.Flush(); len(rest) != 0 {
+		t.Errorf("Flush() returned %+v after flushing, expected none", rest)
+	}
+}
+
+func TestCaptureBatch_Send(t *testing.T) {
+	sender := &recordingSender{}
+	batches := []CaptureBatch{
+		{Kind: CaptureMetric, Records: []CaptureRecord{{Line: "a 1 1"}, {Line: "b 2 2"}}},
+		{Kind: CaptureAggregated, Aggregation: AggAvg, Frequency: Freq30s, Records: []CaptureRecord{{Line: "c 3 3"}}},
+		{Kind: CaptureEvent, Records: []CaptureRecord{{Line: `{"eventId":"1"}`}, {Line: `{"eventId":"2"}`}}},
+	}
+	for _, b := range batches {
+		if err := b.Send(sender); err != nil {
+			t.Fatalf("Send() returned error: %v", err)
+		}
+	}
+
+	expected := []string{"a 1 1\nb 2 2", "c 3 3", `[{"eventId":"1"},{"eventId":"2"}]`}
+	if !reflect.DeepEqual(sender.payloads, expected) {
+		t.Errorf("payloads: %q, expected: %q", sender.payloads, expected)
+	}
+}
+
+func TestOpenCapture(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statful-capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	content := "test.demo.metric 1.000000 1585161000\n"
+
+	plain := filepath.Join(dir, "metrics.log")
+	if err := ioutil.WriteFile(plain, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipCopy(plain, plain+".gz"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{plain, plain + ".gz"} {
+		f, err := OpenCapture(path)
+		if err != nil {
+			t.Fatalf("OpenCapture(%s) returned error: %v", path, err)
+		}
+		data, err := ioutil.ReadAll(f)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil || string(data) != content {
+			t.Errorf("OpenCapture(%s) read %q (%v), expected %q", path, data, err, content)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package statful
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+const (
+	DefaultCircuitResetTimeout = 30 * time.Second
+)
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+func (c CircuitState) String() string {
+	switch c {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerSender fails fast with ErrCircuitOpen instead of waiting on a Sender that keeps failing.
+// The circuit opens after FailureThreshold consecutive failures, after ResetTimeout it becomes half-open and lets
+// HalfOpenMaxCalls sends through: a success closes the circuit again while a failure reopens it.
+// State transitions are logged to Logger and counted in the Stats of the client whose send caused them.
+type CircuitBreakerSender struct {
+	Sender           Sender
+	FailureThreshold int
+	ResetTimeout     time.Duration
+	HalfOpenMaxCalls int
+
+	Logger Logger
+	// OnStateChange is called on every transition while the breaker is locked, it must not call back into the breaker.
+	OnStateChange func(from, to CircuitState)
+
+	mu            sync.Mutex
+	state         CircuitState
+	failures      int
+	openedAt      time.Time
+	halfOpenCalls int
+	// generation changes on every transition, so results of calls admitted in a previous state are ignored.
+	generation uint64
+	now        func() time.Time
+}
+
+func (c *CircuitBreakerSender) Send(data io.Reader) error {
+	return c.SendContext(context.Background(), data)
+}
+
+func (c *CircuitBreakerSender) SendAggregated(data io.Reader, agg Aggregation, freq AggregationFrequency) error {
+	return c.SendAggregatedContext(context.Background(), data, agg, freq)
+}
+
+func (c *CircuitBreakerSender) SendEvents(data io.Reader) error {
+	return c.SendEventsContext(context.Background(), data)
+}
+
+func (c *CircuitBreakerSender) SendContext(ctx context.Context, data io.Reader) error {
+	return c.call(ctx, func() error {
+		return sendContext(ctx, c.Sender, data)
+	})
+}
+
+func (c *CircuitBreakerSender) SendAggregatedContext(ctx context.Context, data io.Reader, agg Aggregation, freq AggregationFrequency) error {
+	return c.call(ctx, func() error {
+		return sendAggregatedContext(ctx, c.Sender, data, agg, freq)
+	})
+}
+
+func (c *CircuitBreakerSender) SendEventsContext(ctx context.Context, data io.Reader) error {
+	return c.call(ctx, func() error {
+		return sendEventsContext(ctx, c.Sender, data)
+	})
+}
+
+func (c *CircuitBreakerSender) sendMetrics(ctx context.Context, b metricBatch) error {
+	return c.call(ctx, func() error {
+		return sendMetricsContext(ctx, c.Sender, b)
+	})
+}
+
+func (c *CircuitBreakerSender) sendEvents(ctx context.Context, b eventBatch) error {
+	return c.call(ctx, func() error {
+		return sendEventBatchContext(ctx, c.Sender, b)
+	})
+}
+
+// State returns the current state of the circuit, an open circuit past its ResetTimeout is reported half-open.
+func (c *CircuitBreakerSender) State() CircuitState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.resetTimeoutElapsed() {
+		return CircuitHalfOpen
+	}
+
+	return c.state
+}
+
+func (c *CircuitBreakerSender) call(ctx context.Context, send func() error) error {
+	stats := statsFromContext(ctx)
+
+	generation, err := c.before(stats)
+	if err != nil {
+		return err
+	}
+
+	err = send()
+	if err != nil && ctx.Err() != nil {
+		// cancelled by the caller, not a sender failure
+		c.cancelled(generation)
+		return err
+	}
+	c.after(generation, err, stats)
+
+	return err
+}
+
+// before admits a call and returns the generation the call was admitted in.
+func (c *CircuitBreakerSender) before(stats *Stats) (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.resetTimeoutElapsed() {
+		c.transition(CircuitHalfOpen, stats)
+	}
+
+	switch c.state {
+	case CircuitOpen:
+		stats.circuitRejected()
+		return c.generation, ErrCircuitOpen
+	case CircuitHalfOpen:
+		if c.halfOpenCalls >= c.halfOpenMaxCalls() {
+			stats.circuitRejected()
+			return c.generation, ErrCircuitOpen
+		}
+		c.halfOpenCalls++
+	}
+
+	return c.generation, nil
+}
+
+// after records the result of a call admitted in generation, results of a previous generation are stale.
+func (c *CircuitBreakerSender) after(generation uint64, err error, stats *Stats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	switch c.state {
+	case CircuitHalfOpen:
+		if c.halfOpenCalls > 0 {
+			c.halfOpenCalls--
+		}
+		if err != nil {
+			c.transition(CircuitOpen, stats)
+		} else {
+			c.transition(CircuitClosed, stats)
+		}
+	case CircuitClosed:
+		if err == nil {
+			c.failures = 0
+			return
+		}
+
+		c.failures++
+		if c.failures >= c.failureThreshold() {
+			c.transition(CircuitOpen, stats)
+		}
+	}
+}
+
+func (c *CircuitBreakerSender) cancelled(generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation == c.generation && c.state == CircuitHalfOpen && c.halfOpenCalls > 0 {
+		c.halfOpenCalls--
+	}
+}
+
+func (c *CircuitBreakerSender) resetTimeoutElapsed() bool {
+	return c.state == CircuitOpen && c.clock().Sub(c.openedAt) >= c.resetTimeout()
+}
+
+func (c *CircuitBreakerSender) transition(to CircuitState, stats *Stats) {
+	from := c.state
+	if from == to {
+		return
+	}
+
+	c.state = to
+	c.generation++
+	c.failures = 0
+	switch to {
+	case CircuitOpen:
+		c.openedAt = c.clock()
+	case CircuitHalfOpen:
+		c.halfOpenCalls = 0
+	}
+
+	stats.circuitTransition(to)
+	structuredLoggerFor(c.Logger).Log(LevelWarn, "Circuit breaker state changed", "from", from, "to", to)
+	if c.OnStateChange != nil {
+		c.OnStateChange(from, to)
+	}
+}
+
+func (c *CircuitBreakerSender) failureThreshold() int {
+	if c.FailureThreshold <= 0 {
+		return DefaultFailureThreshold
+	}
+
+	return c.FailureThreshold
+}
+
+func (c *CircuitBreakerSender) resetTimeout() time.Duration {
+	if c.ResetTimeout <= 0 {
+		return DefaultCircuitResetTimeout
+	}
+
+	return c.ResetTimeout
+}
+
+func (c *CircuitBreakerSender) halfOpenMaxCalls() int {
+	if c.HalfOpenMaxCalls <= 0 {
+		return 1
+	}
+
+	return c.HalfOpenMaxCalls
+}
+
+func (c *CircuitBreakerSender) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+
+	return time.Now()
+}
@@ -0,0 +1,177 @@
+package statful
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerSender(t *testing.T) {
+	now := time.Unix(1585161000, 0)
+	child := &recordingSender{err: errors.New("api down")}
+	var transitions []CircuitState
+
+	breaker := &CircuitBreakerSender{
+		Sender:           child,
+		FailureThreshold: 2,
+		ResetTimeout:     time.Minute,
+		OnStateChange: func(from, to CircuitState) {
+			transitions = append(transitions, to)
+		},
+		now: func() time.Time { return now },
+	}
+
+	client := New(Configuration{
+		DisableAutoFlush: true,
+		Logger:           fmtLogger(func(...interface{}) (int, error) { return 0, nil }),
+		Sender:           breaker,
+	})
+
+	flush := func() error {
+		client.Put("metric", 1, Tags{}, 0, Aggregations{}, Freq10s)
+		return client.FlushError()
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := flush(); err == nil {
+			t.Fatal("expected flush to fail")
+		}
+	}
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("State() returned: %v, expected: %v", breaker.State(), CircuitOpen)
+	}
+
+	// open circuit fails fast without calling the sender
+	err := breaker.Send(bytes.NewBufferString("metric 1 1"))
+	if err != ErrCircuitOpen {
+		t.Errorf("expected ErrCircuitOpen, got: %v", err)
+	}
+	if err := flush(); err == nil {
+		t.Fatal("expected flush to fail")
+	}
+	if len(child.payloads) != 2 {
+		t.Errorf("expected the sender to be called 2 times, got %d", len(child.payloads))
+	}
+
+	// failed trial after the reset timeout reopens the circuit
+	now = now.Add(time.Minute)
+	if breaker.State() != CircuitHalfOpen {
+		t.Fatalf("State() returned: %v, expected: %v", breaker.State(), CircuitHalfOpen)
+	}
+	if err := flush(); err == nil {
+		t.Fatal("expected flush to fail")
+	}
+	if breaker.State() != CircuitOpen {
+		t.Fatalf("State() returned: %v, expected: %v", breaker.State(), CircuitOpen)
+	}
+
+	// successful trial closes the circuit
+	now = now.Add(time.Minute)
+	child.err = nil
+	if err := flush(); err != nil {
+		t.Fatalf("FlushError() returned error: %v", err)
+	}
+	if breaker.State() != CircuitClosed {
+		t.Fatalf("State() returned: %v, expected: %v", breaker.State(), CircuitClosed)
+	}
+
+	expected := []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed}
+	if len(transitions) != len(expected) {
+		t.Fatalf("transitions: %v, expected: %v", transitions, expected)
+	}
+	for idx := range expected {
+		if transitions[idx] != expected[idx] {
+			t.Errorf("transitions: %v, expected: %v", transitions, expected)
+		}
+	}
+
+	stats := client.Stats()
+	expectedStats := Stats{
+		MetricsPut:        5,
+		MetricsFlushed:    1,
+		MetricsDropped:    4,
+		FlushErrors:       4,
+		CircuitOpened:     2,
+		CircuitHalfOpened: 2,
+		CircuitClosed:     1,
+		CircuitRejected:   1,
+	}
+	if stats != expectedStats {
+		t.Errorf("Stats() returned: %+v, expected: %+v", stats, expectedStats)
+	}
+}
+
+func TestCircuitBreakerSender_HalfOpenMaxCalls(t *testing.T) {
+	breaker := &CircuitBreakerSender{
+		Sender:           &recordingSender{},
+		HalfOpenMaxCalls: 1,
+		state:            CircuitHalfOpen,
+	}
+
+	generation, err := breaker.before(nil)
+	if err != nil {
+		t.Fatalf("expected the first half-open call to be allowed, got: %v", err)
+	}
+	if _, err := breaker.before(nil); err != ErrCircuitOpen {
+		t.Errorf("expected ErrCircuitOpen for calls over the limit, got: %v", err)
+	}
+
+	breaker.after(generation, nil, nil)
+	if breaker.State() != CircuitClosed {
+		t.Errorf("State() returned: %v, expected: %v", breaker.State(), CircuitClosed)
+	}
+}
+
+func TestCircuitBreakerSender_StaleResult(t *testing.T) {
+	now := time.Unix(1585161000, 0)
+	breaker := &CircuitBreakerSender{
+		Sender:           &recordingSender{},
+		FailureThreshold: 1,
+		ResetTimeout:     time.Minute,
+		now:              func() time.Time { return now },
+	}
+
+	// a slow call admitted while closed
+	slow, _ := breaker.before(nil)
+
+	failed, _ := breaker.before(nil)
+	breaker.after(failed, errors.New("api down"), nil)
+
+	now = now.Add(time.Minute)
+	probe, err := breaker.before(nil)
+	if err != nil {
+		t.Fatalf("expected the half-open probe to be allowed, got: %v", err)
+	}
+
+	// the slow call finishing during half-open must not decide the probe outcome
+	breaker.after(slow, nil, nil)
+	if breaker.State() != CircuitHalfOpen {
+		t.Fatalf("State() returned: %v, expected: %v", breaker.State(), CircuitHalfOpen)
+	}
+
+	breaker.after(probe, errors.New("api down"), nil)
+	if breaker.State() != CircuitOpen {
+		t.Errorf("State() returned: %v, expected: %v", breaker.State(), CircuitOpen)
+	}
+}
+
+func TestCircuitBreakerSender_SharedStats(t *testing.T) {
+	breaker := &CircuitBreakerSender{Sender: &recordingSender{err: errors.New("api down")}, FailureThreshold: 1}
+	newClient := func() *Client {
+		return New(Configuration{DisableAutoFlush: true, Sender: breaker})
+	}
+	first, second := newClient(), newClient()
+
+	first.Put("metric", 1, Tags{}, 0, Aggregations{}, Freq10s)
+	_ = first.FlushError()
+	second.Put("metric", 1, Tags{}, 0, Aggregations{}, Freq10s)
+	_ = second.FlushError()
+
+	if stats := first.Stats(); stats.CircuitOpened != 1 || stats.CircuitRejected != 0 {
+		t.Errorf("first client Stats() returned: %+v, expected the circuit opened once", stats)
+	}
+	if stats := second.Stats(); stats.CircuitOpened != 0 || stats.CircuitRejected != 1 {
+		t.Errorf("second client Stats() returned: %+v, expected a rejected send", stats)
+	}
+}
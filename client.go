@@ -1,6 +1,9 @@
 package statful
 
 import (
+	"context"
+	"fmt"
+	"net/url"
 	"sync"
 	"time"
 )
@@ -19,10 +22,16 @@ type Client struct {
 	buffer      buffer
 	eventBuffer eventBuffer
 
+	// mu guards the global tags and the flush ticker, Put holds it for reading so a Reconfigure applies
+	// between metrics.
+	mu         sync.RWMutex
 	ticker     *time.Ticker
-	tickerDone chan bool
+	tickerDone chan struct{}
 
 	globalTags Tags
+	stats      *Stats
+	observers  []MetricObserver
+	processors []Processor
 }
 
 type Configuration struct {
@@ -32,11 +41,32 @@ type Configuration struct {
 	FlushSize        int
 	FlushInterval    time.Duration
 
+	// Logger receives the flush failures and dry run output, a Logger also implementing StructuredLogger,
+	// e.g. StdLogger or SlogLogger, receives leveled entries with fields, debug entries included.
 	Logger Logger
 	Sender Sender
+
+	// EventSerializer defines the events payload format, defaults to JsonArraySerializer.
+	EventSerializer EventSerializer
+
+	// Encoder defines the metrics line format, defaults to StatfulEncoder.
+	Encoder Encoder
+
+	// Observers are notified of every metric put in the client, e.g. a PrometheusHandler.
+	Observers []MetricObserver
+
+	// Processors rewrite or drop every metric put in the client, in order, e.g. RenameMetric or DropTags.
+	Processors []Processor
 }
 
+// New creates a client from cfg as is, see NewWithError for a validated configuration with defaults.
+// A nil Logger discards the client logs.
 func New(cfg Configuration) *Client {
+	if cfg.Logger == nil {
+		cfg.Logger = noopLogger{}
+	}
+
+	stats := &Stats{}
 	statful := &Client{
 		buffer: buffer{
 			metricCount:      0,
@@ -44,10 +74,12 @@ func New(cfg Configuration) *Client {
 			dryRun:           cfg.DryRun,
 			disableAutoFlush: cfg.DisableAutoFlush,
 			mu:               sync.Mutex{},
-			stdBuf:           make([]string, 0, cfg.FlushSize),
-			aggBuf:           make(map[Aggregation]map[AggregationFrequency][]string),
+			stdBuf:           make([]Metric, 0, cfg.FlushSize),
+			aggBuf:           make(map[Aggregation]map[AggregationFrequency][]Metric),
 			Sender:           cfg.Sender,
 			Logger:           cfg.Logger,
+			Stats:            stats,
+			Encoder:          cfg.Encoder,
 		},
 		eventBuffer: eventBuffer{
 			buffer:     []Event{},
@@ -56,8 +88,13 @@ func New(cfg Configuration) *Client {
 			mu:         sync.Mutex{},
 			Sender:     cfg.Sender,
 			Logger:     cfg.Logger,
+			Serializer: cfg.EventSerializer,
+			Stats:      stats,
 		},
 		globalTags: cfg.Tags,
+		stats:      stats,
+		observers:  cfg.Observers,
+		processors: cfg.Processors,
 	}
 
 	if cfg.FlushInterval > 0 && !cfg.DisableAutoFlush {
@@ -67,10 +104,113 @@ func New(cfg Configuration) *Client {
 	return statful
 }
 
+// NewWithError validates cfg, applies the defaults and creates the client. Invalid fields are reported as a
+// *ConfigError naming the field. The defaults are DefaultFlushSize for FlushSize, DefaultFlushInterval for
+// FlushInterval unless DisableAutoFlush is set, and a Logger discarding the logs. HttpSender defaults to
+// DefaultUrl and a client with DefaultHttpTimeout.
+func NewWithError(cfg Configuration) (*Client, error) {
+	cfg, err := validateConfiguration(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(cfg), nil
+}
+
+func validateConfiguration(cfg Configuration) (Configuration, error) {
+	invalid := func(key string, format string, args ...interface{}) (Configuration, error) {
+		return Configuration{}, &ConfigError{Key: key, Msg: fmt.Sprintf(format, args...)}
+	}
+
+	if cfg.FlushSize < 0 {
+		return invalid("FlushSize", "must not be negative, got %d", cfg.FlushSize)
+	}
+	if cfg.FlushSize == 0 {
+		cfg.FlushSize = DefaultFlushSize
+	}
+
+	if cfg.FlushInterval < 0 {
+		return invalid("FlushInterval", "must not be negative, got %v", cfg.FlushInterval)
+	}
+	if cfg.DisableAutoFlush && cfg.FlushInterval > 0 {
+		return invalid("FlushInterval", "must not be set with DisableAutoFlush, got %v", cfg.FlushInterval)
+	}
+	if cfg.FlushInterval > 0 && cfg.FlushInterval < MinFlushInterval {
+		return invalid("FlushInterval", "must be at least %v, got %v", MinFlushInterval, cfg.FlushInterval)
+	}
+	if cfg.FlushInterval == 0 && !cfg.DisableAutoFlush {
+		cfg.FlushInterval = DefaultFlushInterval
+	}
+
+	for k := range cfg.Tags {
+		if k == "" {
+			return invalid("Tags", "must not have an empty name")
+		}
+	}
+
+	if cfg.Logger == nil {
+		cfg.Logger = noopLogger{}
+	}
+
+	if err := validateSender(cfg.Sender, cfg.DryRun); err != nil {
+		return Configuration{}, err
+	}
+
+	return cfg, nil
+}
+
+// validateSender checks the fields required by the known senders, a sender is required unless dryRun is set.
+func validateSender(sender Sender, dryRun bool) error {
+	invalid := func(key string, format string, args ...interface{}) error {
+		return &ConfigError{Key: key, Msg: fmt.Sprintf(format, args...)}
+	}
+
+	switch s := sender.(type) {
+	case nil:
+		if !dryRun {
+			return invalid("Sender", "is required unless DryRun is set")
+		}
+	case *HttpSender:
+		if s.Url != "" {
+			if parsed, err := url.Parse(s.Url); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+				return invalid("Sender.Url", "must be an absolute url, got %q", s.Url)
+			}
+		}
+		if s.Token == "" && !dryRun {
+			return invalid("Sender.Token", "is required by HttpSender")
+		}
+	case *UdpSender:
+		if s.Address == "" {
+			return invalid("Sender.Address", "is required by UdpSender")
+		}
+	case *TcpSender:
+		if s.Address == "" {
+			return invalid("Sender.Address", "is required by TcpSender")
+		}
+	case *UnixSender:
+		if s.Path == "" {
+			return invalid("Sender.Path", "is required by UnixSender")
+		}
+	case *MultiSender:
+		if len(s.Senders) == 0 {
+			return invalid("Sender.Senders", "must not be empty")
+		}
+	}
+
+	return nil
+}
+
 // Starts a go routine that periodically flushes the metrics from buffer
 // If AutoFlush is deactivated it just send metrics synchronously.
 // Returns a function that stops the timer.
 func (c *Client) StartFlushInterval(interval time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.startFlushInterval(interval)
+}
+
+func (c *Client) startFlushInterval(interval time.Duration) {
 	if c.buffer.disableAutoFlush {
 		return
 	}
@@ -79,25 +219,36 @@ func (c *Client) StartFlushInterval(interval time.Duration) {
 		interval = MinFlushInterval
 	}
 
-	c.ticker = time.NewTicker(interval)
-	c.tickerDone = make(chan bool)
+	c.stopFlushInterval()
+
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	c.ticker, c.tickerDone = ticker, done
 
 	go func() {
 		for {
 			select {
-			case <-c.ticker.C:
+			case <-ticker.C:
 				c.buffer.Flush()
-			case <-c.tickerDone:
-				break
+			case <-done:
+				return
 			}
 		}
 	}()
 }
 
 func (c *Client) StopFlushInterval() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stopFlushInterval()
+}
+
+func (c *Client) stopFlushInterval() {
 	if c.ticker != nil {
 		c.ticker.Stop()
-		c.tickerDone <- true
+		close(c.tickerDone)
+		c.ticker, c.tickerDone = nil, nil
 	}
 }
 
@@ -126,11 +277,35 @@ func (c *Client) TimerAggregated(name string, value float64, tags Tags, aggregat
 }
 
 func (c *Client) Put(name string, value float64, tags Tags, timestamp int64, aggs Aggregations, freq AggregationFrequency, opts ...PutOption) error {
-	return c.buffer.Put(name, value, tags.Merge(c.globalTags), timestamp, aggs, freq, opts...)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	m := Metric{Name: name, Value: value, User: newPutOptions(opts).user, Tags: tags.Merge(c.globalTags), Timestamp: timestamp, Aggregations: aggs, Frequency: freq}
+	if !process(c.processors, &m) {
+		c.stats.metricsFiltered()
+		return nil
+	}
+	for _, o := range c.observers {
+		o.ObserveMetric(m)
+	}
+
+	return c.buffer.Put(m.Name, m.Value, m.Tags, m.Timestamp, m.Aggregations, m.Frequency, WithUser(m.User))
 }
 
 func (c *Client) PutAggregated(name string, value float64, tags Tags, timestamp int64, agg Aggregation, freq AggregationFrequency, opts ...PutOption) error {
-	return c.buffer.PutAggregated(name, value, tags.Merge(c.globalTags), timestamp, agg, freq, opts...)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	m := Metric{Name: name, Value: value, User: newPutOptions(opts).user, Tags: tags.Merge(c.globalTags), Timestamp: timestamp, Frequency: freq}
+	if !process(c.processors, &m) {
+		c.stats.metricsFiltered()
+		return nil
+	}
+	for _, o := range c.observers {
+		o.ObserveAggregatedMetric(m, agg)
+	}
+
+	return c.buffer.PutAggregated(m.Name, m.Value, m.Tags, m.Timestamp, agg, m.Frequency, WithUser(m.User))
 }
 
 func (c *Client) Flush() {
@@ -141,3 +316,14 @@ func (c *Client) Flush() {
 func (c *Client) FlushError() error {
 	return c.buffer.FlushError()
 }
+
+// FlushContext flushes the client buffer, cancelling pending sends when ctx is done,
+// and returns a FlushErr error if any errors happen.
+func (c *Client) FlushContext(ctx context.Context) error {
+	return c.buffer.FlushContext(ctx)
+}
+
+// Stats returns a copy of the client counters.
+func (c *Client) Stats() Stats {
+	return c.stats.snapshot()
+}
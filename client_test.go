@@ -462,3 +462,118 @@ func TestStatfulSDK(t *testing.T) {
 		})
 	}
 }
+
+func TestNewWithError(t *testing.T) {
+	scenarios := []struct {
+		description string
+		cfg         Configuration
+		key         string
+	}{
+		{
+			description: "zero configuration without sender",
+			cfg:         Configuration{},
+			key:         "Sender",
+		}, {
+			description: "negative flush size",
+			cfg:         Configuration{FlushSize: -1, Sender: &recordingSender{}},
+			key:         "FlushSize",
+		}, {
+			description: "negative flush interval",
+			cfg:         Configuration{FlushInterval: -time.Second, Sender: &recordingSender{}},
+			key:         "FlushInterval",
+		}, {
+			description: "flush interval below the minimum",
+			cfg:         Configuration{FlushInterval: time.Millisecond, Sender: &recordingSender{}},
+			key:         "FlushInterval",
+		}, {
+			description: "flush interval with auto flush disabled",
+			cfg:         Configuration{DisableAutoFlush: true, FlushInterval: time.Second, Sender: &recordingSender{}},
+			key:         "FlushInterval",
+		}, {
+			description: "empty tag name",
+			cfg:         Configuration{DisableAutoFlush: true, Tags: Tags{"": "value"}, Sender: &recordingSender{}},
+			key:         "Tags",
+		}, {
+			description: "http sender without token",
+			cfg:         Configuration{DisableAutoFlush: true, Sender: &HttpSender{}},
+			key:         "Sender.Token",
+		}, {
+			description: "http sender with relative url",
+			cfg:         Configuration{DisableAutoFlush: true, Sender: &HttpSender{Url: "api.statful.com", Token: apiToken}},
+			key:         "Sender.Url",
+		}, {
+			description: "udp sender without address",
+			cfg:         Configuration{DisableAutoFlush: true, Sender: &UdpSender{}},
+			key:         "Sender.Address",
+		}, {
+			description: "tcp sender without address",
+			cfg:         Configuration{DisableAutoFlush: true, Sender: &TcpSender{}},
+			key:         "Sender.Address",
+		}, {
+			description: "unix sender without path",
+			cfg:         Configuration{DisableAutoFlush: true, Sender: &UnixSender{}},
+			key:         "Sender.Path",
+		}, {
+			description: "multi sender without senders",
+			cfg:         Configuration{DisableAutoFlush: true, Sender: &MultiSender{}},
+			key:         "Sender.Senders",
+		}, {
+			description: "dry run without sender",
+			cfg:         Configuration{DisableAutoFlush: true, DryRun: true},
+		}, {
+			description: "http sender without token in dry run",
+			cfg:         Configuration{DisableAutoFlush: true, DryRun: true, Sender: &HttpSender{}},
+		}, {
+			description: "http sender with defaults",
+			cfg:         Configuration{DisableAutoFlush: true, Sender: &HttpSender{Token: apiToken}},
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			client, err := NewWithError(s.cfg)
+			if s.key == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if client == nil {
+					t.Fatal("expected a client")
+				}
+				return
+			}
+
+			cfgErr, ok := err.(*ConfigError)
+			if !ok {
+				t.Fatalf("expected a *ConfigError for %s, got: %v", s.key, err)
+			}
+			if cfgErr.Key != s.key {
+				t.Errorf("expected error for %s, got: %v", s.key, err)
+			}
+			if client != nil {
+				t.Error("expected no client on error")
+			}
+		})
+	}
+}
+
+func TestNewWithError_Defaults(t *testing.T) {
+	sender := &recordingSender{err: fmt.Errorf("api down")}
+	client, err := NewWithError(Configuration{Sender: sender})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer client.StopFlushInterval()
+
+	if client.buffer.flushSize != DefaultFlushSize {
+		t.Errorf("expected flush size %d, got %d", DefaultFlushSize, client.buffer.flushSize)
+	}
+	if client.ticker == nil {
+		t.Error("expected the default flush interval to start the ticker")
+	}
+
+	// without a configured Logger a failed send must not panic
+	client.Put("test.demo.metric", 100, Tags{}, 1585161000, Aggregations{}, Freq10s)
+	if err := client.FlushError(); err == nil {
+		t.Error("expected the flush to fail")
+	}
+}
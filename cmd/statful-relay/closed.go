@@ -0,0 +1,14 @@
+//go:build go1.16
+// +build go1.16
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+// isClosed reports whether err comes from a listener or connection closed on shutdown.
+func isClosed(err error) bool {
+	return errors.Is(err, net.ErrClosed)
+}
@@ -0,0 +1,14 @@
+//go:build !go1.16
+// +build !go1.16
+
+package main
+
+import (
+	"strings"
+)
+
+// isClosed reports whether err comes from a listener or connection closed on shutdown,
+// net.ErrClosed was only added in Go 1.16.
+func isClosed(err error) bool {
+	return strings.Contains(err.Error(), "use of closed network connection")
+}
@@ -0,0 +1,195 @@
+// Command statful-relay is a local agent that receives the client line protocol on UDP, TCP and Unix sockets,
+// and optionally StatsD on UDP, buffers the metrics and forwards them compressed to the Statful API.
+//
+// Usage:
+//
+//	statful-relay [flags]
+//
+// Failed requests are retried and, while the API keeps failing, the metrics are written to a -spool capture file
+// that can be re-sent with statful-replay. The relay health and throughput counters are served as JSON on /health.
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/statful/statful-client-golang"
+	"github.com/statful/statful-client-golang/internal/cliflag"
+)
+
+func main() {
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	os.Exit(run(os.Args[1:], os.Stderr, stop))
+}
+
+func run(args []string, stderr io.Writer, stop <-chan os.Signal) int {
+	logger := log.New(stderr, "statful-relay: ", log.LstdFlags)
+
+	flags := flag.NewFlagSet("statful-relay", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	udpAddr := flags.String("udp", "127.0.0.1:2013", "UDP listen address, empty to disable")
+	tcpAddr := flags.String("tcp", "127.0.0.1:2013", "TCP listen address, empty to disable")
+	unixPath := flags.String("unix", "", "Unix stream socket path")
+	unixgramPath := flags.String("unixgram", "", "Unix datagram socket path")
+	statsdAddr := flags.String("statsd", "", "UDP listen address for StatsD and DogStatsD lines")
+	healthAddr := flags.String("health", "127.0.0.1:2014", "HTTP address serving /health, empty to disable")
+	url := flags.String("url", envOr("STATFUL_URL", statful.DefaultUrl), "Statful API url, defaults to $STATFUL_URL")
+	basePath := flags.String("base-path", "", "Statful API base path")
+	token := flags.String("token", os.Getenv("STATFUL_TOKEN"), "Statful API token, defaults to $STATFUL_TOKEN")
+	timeout := flags.Duration("timeout", statful.DefaultHttpTimeout, "HTTP request timeout")
+	flushSize := flags.Int("flush-size", 1000, "metrics buffered before a flush")
+	flushInterval := flags.Duration("flush-interval", 5*time.Second, "maximum time metrics are buffered")
+	retries := flags.Int("retries", 2, "retries of a failed request")
+	retryBackoff := flags.Duration("retry-backoff", 500*time.Millisecond, "wait before the first retry, doubled on each retry")
+	spoolPath := flags.String("spool", "", "capture file receiving the metrics while the API is failing")
+	spoolMaxSize := flags.Int64("spool-max-size", 100*1024*1024, "spool file size that triggers a rotation")
+	selfPrefix := flags.String("self-prefix", "statful.relay", "prefix of the relay own metrics")
+	selfInterval := flags.Duration("self-interval", 10*time.Second, "interval of the relay own metrics, 0 to disable")
+	tags := cliflag.Tags{}
+	flags.Var(tags, "tag", "global tag as key=value added to every metric, can be repeated")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *token == "" {
+		logger.Println("missing api token, set -token or $STATFUL_TOKEN")
+		return 2
+	}
+	if *udpAddr == "" && *tcpAddr == "" && *unixPath == "" && *unixgramPath == "" && *statsdAddr == "" {
+		logger.Println("no listener configured")
+		return 2
+	}
+
+	var sender statful.Sender = &retrySender{
+		sender: &statful.HttpSender{
+			Http:     &http.Client{Timeout: *timeout},
+			Url:      *url,
+			BasePath: *basePath,
+			Token:    *token,
+		},
+		retries: *retries,
+		backoff: *retryBackoff,
+	}
+
+	r := &relay{
+		parser:  statful.MetricParser{Lenient: true},
+		logger:  logger,
+		started: time.Now(),
+	}
+
+	if *spoolPath != "" {
+		spool := &statful.FileSender{Path: *spoolPath, MaxSize: *spoolMaxSize, Compress: true}
+		defer spool.Close()
+
+		r.failover = &statful.FailoverSender{Senders: []statful.Sender{sender, spool}, Logger: logger}
+		sender = r.failover
+	}
+
+	r.client = statful.New(statful.Configuration{
+		Tags:          statful.Tags(tags),
+		FlushSize:     *flushSize,
+		FlushInterval: *flushInterval,
+		Logger:        logger,
+		Sender:        sender,
+	})
+	defer r.client.StopFlushInterval()
+
+	if err := listen(r, *udpAddr, *tcpAddr, *unixPath, *unixgramPath, *statsdAddr); err != nil {
+		logger.Println(err)
+		r.close()
+		return 1
+	}
+
+	if *healthAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/health", r)
+		srv := &http.Server{Addr: *healthAddr, Handler: mux}
+		go func() {
+			if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Println("health server failed:", err)
+			}
+		}()
+		defer srv.Close()
+	}
+
+	done := make(chan struct{})
+	if *selfInterval > 0 {
+		go r.reportSelfMetrics(*selfPrefix, *selfInterval, done)
+	}
+
+	logger.Println("relaying metrics to", *url)
+	<-stop
+	close(done)
+
+	logger.Println("shutting down")
+	if err := r.close(); err != nil {
+		logger.Println("final flush failed:", err)
+		return 1
+	}
+
+	return 0
+}
+
+func listen(r *relay, udpAddr, tcpAddr, unixPath, unixgramPath, statsdAddr string) error {
+	if udpAddr != "" {
+		conn, err := net.ListenPacket("udp", udpAddr)
+		if err != nil {
+			return err
+		}
+		r.servePacket(conn, r.handleLine)
+	}
+
+	if tcpAddr != "" {
+		l, err := net.Listen("tcp", tcpAddr)
+		if err != nil {
+			return err
+		}
+		r.serveStream(l)
+	}
+
+	if unixPath != "" {
+		_ = os.Remove(unixPath)
+		l, err := net.Listen("unix", unixPath)
+		if err != nil {
+			return err
+		}
+		r.serveStream(l)
+	}
+
+	if unixgramPath != "" {
+		_ = os.Remove(unixgramPath)
+		conn, err := net.ListenPacket("unixgram", unixgramPath)
+		if err != nil {
+			return err
+		}
+		r.servePacket(conn, r.handleLine)
+	}
+
+	if statsdAddr != "" {
+		conn, err := net.ListenPacket("udp", statsdAddr)
+		if err != nil {
+			return err
+		}
+		r.servePacket(conn, r.handleStatsD)
+	}
+
+	return nil
+}
+
+func envOr(key string, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return fallback
+}
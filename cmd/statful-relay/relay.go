@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/statful/statful-client-golang"
+)
+
+const (
+	maxDatagramSize = 64 * 1024
+	maxLineSize     = 1024 * 1024
+)
+
+// relay receives metric lines from the socket listeners and buffers them in a client
+// that forwards them to the Statful API.
+type relay struct {
+	client   *statful.Client
+	failover *statful.FailoverSender
+	parser   statful.MetricParser
+	logger   *log.Logger
+	started  time.Time
+
+	received int64
+	invalid  int64
+
+	mu        sync.Mutex
+	listeners []io.Closer
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// handleLine parses a metric line and puts it in the client buffer.
+func (r *relay) handleLine(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+
+	m, err := r.parser.Parse(line)
+	if err != nil {
+		atomic.AddInt64(&r.invalid, 1)
+		r.logger.Printf("invalid metric line %q: %v", line, err)
+		return
+	}
+	atomic.AddInt64(&r.received, 1)
+
+	var opts []statful.PutOption
+	if m.User != "" {
+		opts = append(opts, statful.WithUser(m.User))
+	}
+	_ = r.client.Put(m.Name, m.Value, m.Tags, m.Timestamp, m.Aggregations, m.Frequency, opts...)
+}
+
+// handleStatsD parses a StatsD line and puts it in the client buffer.
+func (r *relay) handleStatsD(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+
+	m, err := statful.ParseStatsD(line)
+	if err == nil {
+		err = r.client.PutStatsD(m)
+	}
+	if err != nil {
+		atomic.AddInt64(&r.invalid, 1)
+		r.logger.Printf("invalid statsd line %q: %v", line, err)
+		return
+	}
+	atomic.AddInt64(&r.received, 1)
+}
+
+// servePacket reads newline separated lines from datagrams and passes them to handle until conn is closed.
+func (r *relay) servePacket(conn net.PacketConn, handle func(line string)) {
+	r.track(conn)
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		buf := make([]byte, maxDatagramSize)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				if !isClosed(err) {
+					r.logger.Println("read failed:", err)
+				}
+				return
+			}
+
+			for _, line := range bytes.Split(buf[:n], []byte("\n")) {
+				handle(string(line))
+			}
+		}
+	}()
+}
+
+// serveStream accepts connections on l and reads newline separated metric lines from each one until l is closed.
+func (r *relay) serveStream(l net.Listener) {
+	r.track(l)
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				if !isClosed(err) {
+					r.logger.Println("accept failed:", err)
+				}
+				return
+			}
+
+			r.wg.Add(1)
+			go r.serveConn(conn)
+		}
+	}()
+}
+
+func (r *relay) serveConn(conn net.Conn) {
+	defer r.wg.Done()
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		conn.Close()
+		return
+	}
+	if r.conns == nil {
+		r.conns = map[net.Conn]struct{}{}
+	}
+	r.conns[conn] = struct{}{}
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.conns, conn)
+		r.mu.Unlock()
+		conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		r.handleLine(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil && !isClosed(err) {
+		r.logger.Println("read failed:", err)
+	}
+}
+
+func (r *relay) track(l io.Closer) {
+	r.mu.Lock()
+	r.listeners = append(r.listeners, l)
+	r.mu.Unlock()
+}
+
+// close stops the listeners, waits for the open connections and flushes the buffered metrics.
+func (r *relay) close() error {
+	r.mu.Lock()
+	r.closed = true
+	for _, l := range r.listeners {
+		l.Close()
+	}
+	for conn := range r.conns {
+		conn.Close()
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+	return r.client.FlushError()
+}
+
+// health is the body of the /health endpoint.
+type health struct {
+	Status         string `json:"status"`
+	Uptime         string `json:"uptime"`
+	Received       int64  `json:"received"`
+	Invalid        int64  `json:"invalid"`
+	MetricsFlushed int64  `json:"metricsFlushed"`
+	MetricsDropped int64  `json:"metricsDropped"`
+	FlushErrors    int64  `json:"flushErrors"`
+	Spooling       bool   `json:"spooling"`
+}
+
+func (r *relay) health() health {
+	stats := r.client.Stats()
+	h := health{
+		Status:         "ok",
+		Uptime:         time.Since(r.started).Round(time.Second).String(),
+		Received:       atomic.LoadInt64(&r.received),
+		Invalid:        atomic.LoadInt64(&r.invalid),
+		MetricsFlushed: stats.MetricsFlushed,
+		MetricsDropped: stats.MetricsDropped,
+		FlushErrors:    stats.FlushErrors,
+	}
+
+	if r.failover != nil && !r.failover.Healthy(0) {
+		// the API is failing and the metrics are being written to the spool
+		h.Status = "degraded"
+		h.Spooling = true
+	}
+
+	return h
+}
+
+// ServeHTTP serves the relay health and throughput counters as JSON.
+func (r *relay) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(r.health())
+}
+
+// reportSelfMetrics sends the relay throughput as counters prefixed by prefix every interval until done is closed.
+func (r *relay) reportSelfMetrics(prefix string, interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last health
+	for {
+		select {
+		case <-ticker.C:
+			h := r.health()
+			r.client.Counter(prefix+".received", float64(h.Received-last.Received), nil)
+			r.client.Counter(prefix+".invalid", float64(h.Invalid-last.Invalid), nil)
+			r.client.Counter(prefix+".flushed", float64(h.MetricsFlushed-last.MetricsFlushed), nil)
+			r.client.Counter(prefix+".dropped", float64(h.MetricsDropped-last.MetricsDropped), nil)
+			r.client.Counter(prefix+".flush_errors", float64(h.FlushErrors-last.FlushErrors), nil)
+			last = h
+		case <-done:
+			return
+		}
+	}
+}
+
+// retrySender retries failed sends up to retries times, doubling the wait between attempts.
+// The attempts and the waits stop once the context of the send is done.
+type retrySender struct {
+	sender  statful.Sender
+	retries int
+	backoff time.Duration
+	sleep   func(context.Context, time.Duration) error
+}
+
+func (s *retrySender) Send(data io.Reader) error {
+	return s.SendContext(context.Background(), data)
+}
+
+func (s *retrySender) SendContext(ctx context.Context, data io.Reader) error {
+	return s.retry(ctx, data, func(r io.Reader) error {
+		if cs, ok := s.sender.(statful.ContextSender); ok {
+			return cs.SendContext(ctx, r)
+		}
+		return s.sender.Send(r)
+	})
+}
+
+func (s *retrySender) SendAggregated(data io.Reader, agg statful.Aggregation, freq statful.AggregationFrequency) error {
+	return s.SendAggregatedContext(context.Background(), data, agg, freq)
+}
+
+func (s *retrySender) SendAggregatedContext(ctx context.Context, data io.Reader, agg statful.Aggregation, freq statful.AggregationFrequency) error {
+	return s.retry(ctx, data, func(r io.Reader) error {
+		if cs, ok := s.sender.(statful.ContextSender); ok {
+			return cs.SendAggregatedContext(ctx, r, agg, freq)
+		}
+		return s.sender.SendAggregated(r, agg, freq)
+	})
+}
+
+func (s *retrySender) SendEvents(data io.Reader) error {
+	return s.SendEventsContext(context.Background(), data)
+}
+
+func (s *retrySender) SendEventsContext(ctx context.Context, data io.Reader) error {
+	return s.retry(ctx, data, func(r io.Reader) error {
+		if cs, ok := s.sender.(statful.ContextSender); ok {
+			return cs.SendEventsContext(ctx, r)
+		}
+		return s.sender.SendEvents(r)
+	})
+}
+
+func (s *retrySender) retry(ctx context.Context, data io.Reader, send func(io.Reader) error) error {
+	payload, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+
+	sleep := s.sleep
+	if sleep == nil {
+		sleep = sleepContext
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	backoff := s.backoff
+	for attempt := 0; ; attempt++ {
+		err = send(bytes.NewReader(payload))
+		if err == nil || attempt >= s.retries {
+			return err
+		}
+
+		// the last failure is more useful than the context error
+		if sleep(ctx, backoff) != nil {
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// sleepContext waits for d, it returns the context error if ctx is done first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
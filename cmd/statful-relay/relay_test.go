@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/statful/statful-client-golang"
+	"github.com/statful/statful-client-golang/statfultest"
+)
+
+func newTestRelay(sender statful.Sender) *relay {
+	logger := log.New(ioutil.Discard, "", 0)
+
+	return &relay{
+		client:  statful.New(statful.Configuration{DisableAutoFlush: true, Logger: logger, Sender: sender}),
+		parser:  statful.MetricParser{Lenient: true},
+		logger:  logger,
+		started: time.Now(),
+	}
+}
+
+func waitForLines(t *testing.T, r *relay, n int64) {
+	deadline := time.Now().Add(2 * time.Second)
+	for atomic.LoadInt64(&r.received)+atomic.LoadInt64(&r.invalid) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("received %d lines, expected %d", atomic.LoadInt64(&r.received)+atomic.LoadInt64(&r.invalid), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRelay_Listeners(t *testing.T) {
+	recorder := &statfultest.Recorder{}
+	r := newTestRelay(recorder)
+
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.servePacket(udp, r.handleLine)
+
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.serveStream(tcp)
+
+	udpConn, err := net.Dial("udp", udp.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udpConn.Close()
+	udpConn.Write([]byte("udp.a,env=prod 1.000000 1585161000 count,sum,10\nudp.b 2.000000 1585161000"))
+
+	tcpConn, err := net.Dial("tcp", tcp.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcpConn.Close()
+	tcpConn.Write([]byte("tcp.a value=3.000000,user_id=jdoe 1585161000\nnot a metric\n"))
+
+	waitForLines(t, r, 4)
+	if err := r.close(); err != nil {
+		t.Fatalf("close() returned error: %v", err)
+	}
+
+	expected := []statful.Metric{
+		{Name: "udp.a", Value: 1, Tags: statful.Tags{"env": "prod"}, Timestamp: 1585161000, Aggregations: statful.Aggregations{statful.AggCount: struct{}{}, statful.AggSum: struct{}{}}, Frequency: statful.Freq10s},
+		{Name: "udp.b", Value: 2, Tags: statful.Tags{}, Timestamp: 1585161000},
+		{Name: "tcp.a", Value: 3, User: "jdoe", Tags: statful.Tags{}, Timestamp: 1585161000},
+	}
+	for _, m := range expected {
+		found := recorder.Find(m.Name, nil)
+		if len(found) != 1 || !reflect.DeepEqual(found[0], m) {
+			t.Errorf("relayed %+v, expected %+v", found, m)
+		}
+	}
+
+	h := r.health()
+	if h.Received != 3 || h.Invalid != 1 || h.MetricsFlushed != 3 || h.Status != "ok" {
+		t.Errorf("health: %+v", h)
+	}
+}
+
+func TestRelay_StatsD(t *testing.T) {
+	recorder := &statfultest.Recorder{}
+	r := newTestRelay(recorder)
+
+	r.handleStatsD("requests:1|c|#env:prod")
+	r.handleStatsD("queue.size:12|g")
+	r.handleStatsD("queue.size:+1|g")
+	if err := r.close(); err != nil {
+		t.Fatalf("close() returned error: %v", err)
+	}
+
+	recorder.AssertCounter(t, "requests", statful.Tags{"env": "prod"})
+	recorder.AssertGauge(t, "queue.size", nil)
+	if h := r.health(); h.Received != 2 || h.Invalid != 1 {
+		t.Errorf("health: %+v", h)
+	}
+}
+
+func TestRelay_Spool(t *testing.T) {
+	srv := statfultest.NewServer("token")
+	defer srv.Close()
+	srv.FailNext(2, http.StatusServiceUnavailable)
+
+	dir, err := ioutil.TempDir("", "statful-relay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	spool := &statful.FileSender{Path: filepath.Join(dir, "spool.log")}
+	defer spool.Close()
+
+	failover := &statful.FailoverSender{
+		Senders:          []statful.Sender{&retrySender{sender: srv.Sender()}, spool},
+		FailureThreshold: 1,
+		Cooldown:         time.Hour,
+	}
+	r := newTestRelay(failover)
+	r.failover = failover
+
+	r.handleLine("spooled.metric 1.000000 1585161000")
+	if err := r.client.FlushError(); err != nil {
+		t.Fatalf("FlushError() returned error: %v", err)
+	}
+
+	h := r.health()
+	if h.Status != "degraded" || !h.Spooling {
+		t.Errorf("health: %+v, expected degraded", h)
+	}
+
+	data, err := ioutil.ReadFile(spool.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanner := statful.NewCaptureScanner(bytes.NewReader(data))
+	if !scanner.Scan() {
+		t.Fatalf("empty spool")
+	}
+	if record, err := scanner.Record(); err != nil || record.Line != "spooled.metric 1.000000 1585161000" {
+		t.Errorf("spooled record: %+v, %v", record, err)
+	}
+}
+
+func TestRelay_ServeHTTP(t *testing.T) {
+	r := newTestRelay(&statfultest.Recorder{})
+	r.handleLine("test.metric 1 1585161000")
+	r.handleLine("test.metric one 1585161000")
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	var h health
+	if err := json.Unmarshal(rec.Body.Bytes(), &h); err != nil {
+		t.Fatalf("invalid health response %s: %v", rec.Body.String(), err)
+	}
+	if h.Status != "ok" || h.Received != 1 || h.Invalid != 1 {
+		t.Errorf("health: %+v", h)
+	}
+}
+
+func TestRetrySender(t *testing.T) {
+	scenarios := []struct {
+		description string
+		failures    int
+		retries     int
+		expectErr   bool
+		expectWaits []time.Duration
+	}{
+		{description: "succeeds without retries", failures: 0, retries: 2},
+		{description: "succeeds after retries", failures: 2, retries: 2, expectWaits: []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}},
+		{description: "gives up after retries", failures: 3, retries: 1, expectErr: true, expectWaits: []time.Duration{10 * time.Millisecond}},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			var payloads []string
+			var waits []time.Duration
+
+			calls := 0
+			sender := &retrySender{
+				sender: senderFunc(func(data io.Reader) error {
+					all, _ := ioutil.ReadAll(data)
+					payloads = append(payloads, string(all))
+					if calls++; calls <= s.failures {
+						return errors.New("api down")
+					}
+					return nil
+				}),
+				retries: s.retries,
+				backoff: 10 * time.Millisecond,
+				sleep: func(_ context.Context, d time.Duration) error {
+					waits = append(waits, d)
+					return nil
+				},
+			}
+
+			err := sender.Send(strings.NewReader("payload"))
+			if (err != nil) != s.expectErr {
+				t.Errorf("Send() returned: %v", err)
+			}
+			if !reflect.DeepEqual(waits, s.expectWaits) {
+				t.Errorf("waited %v, expected %v", waits, s.expectWaits)
+			}
+			for _, p := range payloads {
+				if p != "payload" {
+					t.Errorf("sent %q on retry", p)
+				}
+			}
+		})
+	}
+}
+
+func TestRetrySender_Context(t *testing.T) {
+	failing := senderFunc(func(io.Reader) error {
+		return errors.New("api down")
+	})
+
+	t.Run("canceled before the first attempt", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		calls := 0
+		sender := &retrySender{
+			sender: senderFunc(func(io.Reader) error {
+				calls++
+				return nil
+			}),
+			retries: 2,
+		}
+		if err := sender.SendContext(ctx, strings.NewReader("payload")); err != context.Canceled {
+			t.Errorf("SendContext() returned: %v, expected: %v", err, context.Canceled)
+		}
+		if calls != 0 {
+			t.Errorf("sent %d times after the context was canceled", calls)
+		}
+	})
+
+	t.Run("canceled during the backoff", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+
+		sender := &retrySender{sender: failing, retries: 5, backoff: time.Minute}
+		start := time.Now()
+		if err := sender.SendContext(ctx, strings.NewReader("payload")); err == nil || err.Error() != "api down" {
+			t.Errorf("SendContext() returned: %v, expected the last failure", err)
+		}
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Errorf("the backoff ignored the context, took %v", elapsed)
+		}
+	})
+}
+
+func TestRun_InvalidFlags(t *testing.T) {
+	os.Unsetenv("STATFUL_TOKEN")
+
+	var stderr bytes.Buffer
+	if code := run([]string{}, &stderr, nil); code != 2 {
+		t.Errorf("run() returned %d, expected 2", code)
+	}
+	if !strings.Contains(stderr.String(), "missing api token") {
+		t.Errorf("stderr: %s", stderr.String())
+	}
+}
+
+type senderFunc func(data io.Reader) error
+
+func (f senderFunc) Send(data io.Reader) error {
+	return f(data)
+}
+
+func (f senderFunc) SendAggregated(data io.Reader, agg statful.Aggregation, freq statful.AggregationFrequency) error {
+	return f(data)
+}
+
+func (f senderFunc) SendEvents(data io.Reader) error {
+	return f(data)
+}
+
+func TestIsClosed(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = l.Close()
+
+	_, err = l.Accept()
+	if !isClosed(err) {
+		t.Errorf("isClosed(%v) returned false for a closed listener", err)
+	}
+	if isClosed(errors.New("connection reset by peer")) {
+		t.Error("isClosed() returned true for another error")
+	}
+}
@@ -0,0 +1,123 @@
+// Command statful-replay re-sends the metrics and events captured by a FileSender, WriterSender or a relay spool
+// to the Statful API, optionally rewriting timestamps and tags and limiting the send rate.
+//
+// Usage:
+//
+//	statful-replay [flags] file...
+//
+// Files ending in .gz are decompressed. Records that fail to parse or to send are reported on stderr and,
+// with -failed, written to a capture file that can be replayed again.
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/statful/statful-client-golang"
+	"github.com/statful/statful-client-golang/internal/cliflag"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+func run(args []string, stderr io.Writer) int {
+	logger := log.New(stderr, "statful-replay: ", 0)
+
+	flags := flag.NewFlagSet("statful-replay", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	url := flags.String("url", envOr("STATFUL_URL", statful.DefaultUrl), "Statful API url, defaults to $STATFUL_URL")
+	basePath := flags.String("base-path", "", "Statful API base path")
+	token := flags.String("token", os.Getenv("STATFUL_TOKEN"), "Statful API token, defaults to $STATFUL_TOKEN")
+	timeout := flags.Duration("timeout", statful.DefaultHttpTimeout, "HTTP request timeout")
+	noCompression := flags.Bool("no-compression", false, "disable gzip compression of the requests")
+	batchSize := flags.Int("batch", 1000, "maximum records per request")
+	rate := flags.Float64("rate", 0, "maximum records sent per second, caps -batch, 0 for unlimited")
+	shift := flags.Duration("shift", 0, "shift the metric timestamps by this duration")
+	now := flags.Bool("now", false, "rewrite the metric timestamps to the current time")
+	progress := flags.Duration("progress", 10*time.Second, "progress report interval, 0 to disable")
+	failedPath := flags.String("failed", "", "write the records that failed to this capture file")
+	tags := cliflag.Tags{}
+	flags.Var(tags, "tag", "add or override a metric tag as key=value, can be repeated")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		logger.Println("no files to replay")
+		flags.Usage()
+		return 2
+	}
+	if *token == "" {
+		logger.Println("missing api token, set -token or $STATFUL_TOKEN")
+		return 2
+	}
+	if *batchSize <= 0 {
+		logger.Println("-batch must be positive")
+		return 2
+	}
+
+	r := &replayer{
+		sender: &statful.HttpSender{
+			Http:          &http.Client{Timeout: *timeout},
+			Url:           *url,
+			BasePath:      *basePath,
+			Token:         *token,
+			NoCompression: *noCompression,
+		},
+		batchSize:        *batchSize,
+		rate:             *rate,
+		tags:             statful.Tags(tags),
+		shift:            *shift,
+		now:              *now,
+		progressInterval: *progress,
+		logger:           logger,
+	}
+
+	if *failedPath != "" {
+		failed, err := os.OpenFile(*failedPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			logger.Println("failed to open failed records file:", err)
+			return 1
+		}
+		defer failed.Close()
+		r.failed = failed
+	}
+
+	for _, path := range flags.Args() {
+		if err := replayFile(r, path); err != nil {
+			logger.Printf("%s: %v", path, err)
+			r.failedCount++
+		}
+	}
+
+	logger.Printf("done: %d records sent, %d failed", r.sentCount, r.failedCount)
+	if r.failedCount > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+func replayFile(r *replayer, path string) error {
+	f, err := statful.OpenCapture(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return r.replay(path, f)
+}
+
+func envOr(key string, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return fallback
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/statful/statful-client-golang"
+)
+
+type replayer struct {
+	sender           statful.Sender
+	batchSize        int
+	rate             float64
+	tags             statful.Tags
+	shift            time.Duration
+	now              bool
+	progressInterval time.Duration
+	failed           io.Writer
+	logger           *log.Logger
+
+	clock func() time.Time
+	sleep func(time.Duration)
+
+	started      time.Time
+	lastProgress time.Time
+	sentCount    int
+	failedCount  int
+}
+
+func (r *replayer) replay(name string, reader io.Reader) error {
+	if r.started.IsZero() {
+		r.started = r.time()
+		r.lastProgress = r.started
+	}
+
+	batcher := &statful.CaptureBatcher{Size: r.maxBatch()}
+	scanner := statful.NewCaptureScanner(reader)
+	for scanner.Scan() {
+		record, err := scanner.Record()
+		if err == nil && record.Kind != statful.CaptureEvent {
+			var line string
+			if line, err = r.rewrite(record.Line); err == nil {
+				record.Line = line
+			}
+		}
+		if err != nil {
+			r.logger.Printf("%s:%d: %v", name, record.LineNumber, err)
+			r.fail([]statful.CaptureRecord{record}, err)
+			continue
+		}
+
+		if b, full := batcher.Add(record); full {
+			r.send(name, b)
+		}
+	}
+
+	for _, b := range batcher.Flush() {
+		r.send(name, b)
+	}
+
+	return scanner.Err()
+}
+
+func (r *replayer) send(name string, b statful.CaptureBatch) {
+	records := b.Records
+	if err := b.Send(r.sender); err != nil {
+		r.logger.Printf("%s:%d-%d: failed to send %d records: %v", name, records[0].LineNumber, records[len(records)-1].LineNumber, len(records), err)
+		r.fail(records, err)
+	} else {
+		r.sentCount += len(records)
+	}
+
+	r.throttle()
+	r.reportProgress()
+}
+
+// fail counts the records as failed and writes them to the failed records capture file.
+func (r *replayer) fail(records []statful.CaptureRecord, err error) {
+	r.failedCount += len(records)
+	if r.failed == nil {
+		return
+	}
+
+	for _, record := range records {
+		line := record.Line
+		if captureErr, ok := err.(*statful.CaptureError); ok {
+			line = captureErr.Line
+		} else if record.Kind == statful.CaptureAggregated {
+			line = fmt.Sprintf("@%s,%d %s", record.Aggregation, record.Frequency, line)
+		}
+		fmt.Fprintln(r.failed, line)
+	}
+}
+
+// maxBatch returns the batch size, capped by the rate so a batch is at most a second worth of records.
+func (r *replayer) maxBatch() int {
+	if r.rate > 0 && float64(r.batchSize) > r.rate {
+		return int(math.Max(1, r.rate))
+	}
+
+	return r.batchSize
+}
+
+// throttle sleeps until the records processed so far fit in the configured rate.
+func (r *replayer) throttle() {
+	if r.rate <= 0 {
+		return
+	}
+
+	processed := float64(r.sentCount + r.failedCount)
+	expected := r.started.Add(time.Duration(processed / r.rate * float64(time.Second)))
+	if wait := expected.Sub(r.time()); wait > 0 {
+		if r.sleep != nil {
+			r.sleep(wait)
+		} else {
+			time.Sleep(wait)
+		}
+	}
+}
+
+func (r *replayer) reportProgress() {
+	if r.progressInterval <= 0 || r.time().Sub(r.lastProgress) < r.progressInterval {
+		return
+	}
+
+	r.lastProgress = r.time()
+	r.logger.Printf("progress: %d records sent, %d failed", r.sentCount, r.failedCount)
+}
+
+// rewrite applies the timestamp and tag rewrites to a metric line. The value and aggregations are kept as captured,
+// re-encoding the value would round it to the six decimals of Metric.String.
+func (r *replayer) rewrite(line string) (string, error) {
+	if len(r.tags) == 0 && r.shift == 0 && !r.now {
+		return line, nil
+	}
+
+	m, err := statful.MetricParser{Lenient: true}.Parse(line)
+	if err != nil {
+		return "", err
+	}
+
+	if len(r.tags) > 0 {
+		m.Tags = r.tags.Merge(m.Tags)
+	}
+	if r.now {
+		m.Timestamp = r.time().Unix()
+	}
+	m.Timestamp += int64(r.shift / time.Second)
+
+	// the lenient parser accepted the line, so it has the name, value, timestamp and optional aggregations fields
+	fields := strings.Fields(line)
+	head := []string{m.Name}
+	for _, k := range sortedKeys(m.Tags) {
+		head = append(head, k+"="+m.Tags[k])
+	}
+	fields[0] = strings.Join(head, ",")
+	fields[2] = strconv.FormatInt(m.Timestamp, 10)
+
+	return strings.Join(fields, " "), nil
+}
+
+func sortedKeys(tags statful.Tags) []string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func (r *replayer) time() time.Time {
+	if r.clock != nil {
+		return r.clock()
+	}
+
+	return time.Now()
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/statful/statful-client-golang"
+)
+
+type sent struct {
+	kind    string
+	payload string
+	agg     statful.Aggregation
+	freq    statful.AggregationFrequency
+}
+
+type recordingSender struct {
+	sent []sent
+	err  error
+}
+
+func (s *recordingSender) record(kind string, data io.Reader, agg statful.Aggregation, freq statful.AggregationFrequency) error {
+	all, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	s.sent = append(s.sent, sent{kind: kind, payload: string(all), agg: agg, freq: freq})
+
+	return s.err
+}
+
+func (s *recordingSender) Send(data io.Reader) error {
+	return s.record("metrics", data, "", 0)
+}
+
+func (s *recordingSender) SendAggregated(data io.Reader, agg statful.Aggregation, freq statful.AggregationFrequency) error {
+	return s.record("aggregated", data, agg, freq)
+}
+
+func (s *recordingSender) SendEvents(data io.Reader) error {
+	return s.record("events", data, "", 0)
+}
+
+// sameSent compares metric payloads line by line as parsed metrics, the tag order of an encoded line is not stable.
+func sameSent(t *testing.T, got, expected sent) bool {
+	if got.kind == "events" || got.kind != expected.kind {
+		return got == expected
+	}
+
+	gotMetrics, err := statful.MetricParser{}.ParseMetrics(strings.NewReader(got.payload))
+	if err != nil {
+		t.Errorf("sent invalid metrics %q: %v", got.payload, err)
+		return false
+	}
+	expectedMetrics, _ := statful.MetricParser{}.ParseMetrics(strings.NewReader(expected.payload))
+
+	return got.agg == expected.agg && got.freq == expected.freq && reflect.DeepEqual(gotMetrics, expectedMetrics)
+}
+
+const capture = `test.demo.metric,env=test 1.000000 1585161000 count,10
+test.demo.metric 2.000000 1585161001
+@avg,30 test.demo.aggregated 3.000000 1585161002
+{"eventId":"1"}
+@broken test.demo.aggregated 4.000000 1585161003
+{"eventId":"2"}
+test.demo.metric 5.000000 1585161004
+`
+
+func TestReplayer_Replay(t *testing.T) {
+	var logs, failed bytes.Buffer
+	sender := &recordingSender{}
+	r := &replayer{
+		sender:    sender,
+		batchSize: 2,
+		tags:      statful.Tags{"replayed": "true", "env": "prod"},
+		shift:     time.Hour,
+		failed:    &failed,
+		logger:    log.New(&logs, "", 0),
+	}
+
+	if err := r.replay("capture.log", strings.NewReader(capture)); err != nil {
+		t.Fatalf("replay() returned error: %v", err)
+	}
+
+	expected := []sent{
+		{kind: "metrics", payload: "test.demo.metric,env=prod,replayed=true 1.000000 1585164600 count,10\ntest.demo.metric,env=prod,replayed=true 2.000000 1585164601"},
+		{kind: "events", payload: `[{"eventId":"1"},{"eventId":"2"}]`},
+		{kind: "metrics", payload: "test.demo.metric,env=prod,replayed=true 5.000000 1585164604"},
+		{kind: "aggregated", payload: "test.demo.aggregated,env=prod,replayed=true 3.000000 1585164602", agg: statful.AggAvg, freq: statful.Freq30s},
+	}
+	if len(sender.sent) != len(expected) {
+		t.Fatalf("sent %+v, expected %+v", sender.sent, expected)
+	}
+	for idx := range expected {
+		if !sameSent(t, sender.sent[idx], expected[idx]) {
+			t.Errorf("request %d: sent %+v, expected %+v", idx, sender.sent[idx], expected[idx])
+		}
+	}
+
+	if r.sentCount != 6 || r.failedCount != 1 {
+		t.Errorf("sent %d and failed %d records, expected 6 and 1", r.sentCount, r.failedCount)
+	}
+	if failed.String() != "@broken test.demo.aggregated 4.000000 1585161003\n" {
+		t.Errorf("failed records: %q", failed.String())
+	}
+	if !strings.Contains(logs.String(), "capture.log:5:") {
+		t.Errorf("failed line not reported: %q", logs.String())
+	}
+}
+
+func TestReplayer_RewriteKeepsValue(t *testing.T) {
+	scenarios := []struct {
+		description string
+		replayer    replayer
+		line        string
+		expected    string
+	}{
+		{
+			description: "tags keep a small value",
+			replayer:    replayer{tags: statful.Tags{"replayed": "true"}},
+			line:        "test.demo.metric,env=test 1e-07 1585161000",
+			expected:    "test.demo.metric,env=test,replayed=true 1e-07 1585161000",
+		},
+		{
+			description: "shift keeps a precise value and the aggregations",
+			replayer:    replayer{shift: time.Minute},
+			line:        "test.demo.metric 0.123456789 1585161000 avg,p90,10",
+			expected:    "test.demo.metric 0.123456789 1585161060 avg,p90,10",
+		},
+		{
+			description: "user value is kept",
+			replayer:    replayer{shift: time.Minute},
+			line:        "test.demo.metric value=2.5e-09,user_id=john 1585161000",
+			expected:    "test.demo.metric value=2.5e-09,user_id=john 1585161060",
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			line, err := s.replayer.rewrite(s.line)
+			if err != nil {
+				t.Fatalf("rewrite() returned error: %v", err)
+			}
+			if line != s.expected {
+				t.Errorf("rewrite() returned: %q, expected: %q", line, s.expected)
+			}
+		})
+	}
+}
+
+func TestReplayer_SendFailure(t *testing.T) {
+	var failed bytes.Buffer
+	r := &replayer{
+		sender:    &recordingSender{err: errors.New("api down")},
+		batchSize: 10,
+		failed:    &failed,
+		logger:    log.New(ioutil.Discard, "", 0),
+	}
+
+	if err := r.replay("capture.log", strings.NewReader(capture)); err != nil {
+		t.Fatalf("replay() returned error: %v", err)
+	}
+
+	if r.sentCount != 0 || r.failedCount != 7 {
+		t.Errorf("sent %d and failed %d records, expected 0 and 7", r.sentCount, r.failedCount)
+	}
+
+	// the failed records file can be replayed again
+	replayed := &recordingSender{}
+	again := &replayer{sender: replayed, batchSize: 10, logger: log.New(ioutil.Discard, "", 0)}
+	if err := again.replay("failed.log", &failed); err != nil {
+		t.Fatalf("replay() returned error: %v", err)
+	}
+	if again.sentCount != 6 || again.failedCount != 1 {
+		t.Errorf("replaying failed records sent %d and failed %d, expected 6 and 1", again.sentCount, again.failedCount)
+	}
+}
+
+func TestReplayer_Rate(t *testing.T) {
+	now := time.Unix(1585161000, 0)
+	var slept time.Duration
+	r := &replayer{
+		sender:    &recordingSender{},
+		batchSize: 1,
+		rate:      2,
+		logger:    log.New(ioutil.Discard, "", 0),
+		clock:     func() time.Time { return now },
+		sleep: func(d time.Duration) {
+			slept += d
+			now = now.Add(d)
+		},
+	}
+
+	if err := r.replay("capture.log", strings.NewReader("a 1 1\nb 2 2\nc 3 3\nd 4 4\n")); err != nil {
+		t.Fatalf("replay() returned error: %v", err)
+	}
+
+	if slept != 2*time.Second {
+		t.Errorf("slept %v, expected %v", slept, 2*time.Second)
+	}
+}
+
+func TestReplayer_RateCapsBatch(t *testing.T) {
+	now := time.Unix(1585161000, 0)
+	var slept []time.Duration
+	sender := &recordingSender{}
+	r := &replayer{
+		sender:    sender,
+		batchSize: 1000,
+		rate:      2,
+		logger:    log.New(ioutil.Discard, "", 0),
+		clock:     func() time.Time { return now },
+		sleep: func(d time.Duration) {
+			slept = append(slept, d)
+			now = now.Add(d)
+		},
+	}
+
+	if err := r.replay("capture.log", strings.NewReader("a 1 1\nb 2 2\nc 3 3\nd 4 4\ne 5 5\n")); err != nil {
+		t.Fatalf("replay() returned error: %v", err)
+	}
+
+	// batches of at most rate records, so no more than rate records are sent in any second
+	if len(sender.sent) != 3 {
+		t.Fatalf("sent %d requests, expected 3: %+v", len(sender.sent), sender.sent)
+	}
+	expected := []time.Duration{time.Second, time.Second, 500 * time.Millisecond}
+	if !reflect.DeepEqual(slept, expected) {
+		t.Errorf("slept %v, expected %v", slept, expected)
+	}
+}
+
+func TestRun(t *testing.T) {
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("M-API-Token") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "statful-replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "capture.log.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := gzip.NewWriter(f)
+	_, _ = gw.Write([]byte("test.demo.metric 1.000000 1585161000\n{\"eventId\":\"1\"}\n"))
+	_ = gw.Close()
+	_ = f.Close()
+
+	var stderr bytes.Buffer
+	if code := run([]string{"-url", srv.URL, "-token", "token", path}, &stderr); code != 0 {
+		t.Errorf("run() returned %d, expected 0: %s", code, stderr.String())
+	}
+	if requests != 2 {
+		t.Errorf("server received %d requests, expected 2", requests)
+	}
+
+	if code := run([]string{"-url", srv.URL, "-token", "wrong", path}, &stderr); code != 1 {
+		t.Errorf("run() returned %d, expected 1", code)
+	}
+
+	if code := run([]string{"-url", srv.URL, "-token", "token"}, &stderr); code != 2 {
+		t.Errorf("run() without files returned %d, expected 2", code)
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/statful/statful-client-golang"
+	"github.com/statful/statful-client-golang/internal/cliflag"
+)
+
+type command struct {
+	name   string
+	args   []string
+	client *statful.Client
+	stdout io.Writer
+	stderr io.Writer
+	logger *log.Logger
+}
+
+var commands = map[string]func(*command) int{
+	"counter":    metricCommand("count,sum", true),
+	"gauge":      metricCommand("last", false),
+	"timer":      metricCommand("avg,count,p90", false),
+	"put":        metricCommand("", false),
+	"event":      eventCommand,
+	"flush-file": flushFileCommand,
+}
+
+func (c *command) flagSet(usage string) *flag.FlagSet {
+	flags := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	flags.SetOutput(c.stderr)
+	flags.Usage = func() {
+		fmt.Fprintf(c.stderr, "Usage: statful %s [flags] %s\n", c.name, usage)
+		flags.PrintDefaults()
+	}
+
+	return flags
+}
+
+// metricCommand sends a single metric, aggregations default to defaultAggs and the value is optional
+// when optionalValue is set.
+func metricCommand(defaultAggs string, optionalValue bool) func(*command) int {
+	return func(c *command) int {
+		usage := "name value"
+		if optionalValue {
+			usage = "name [value]"
+		}
+
+		flags := c.flagSet(usage)
+		tags := cliflag.Tags{}
+		flags.Var(tags, "tag", "metric tag as key=value, can be repeated")
+		aggs := flags.String("agg", defaultAggs, "comma separated aggregations")
+		freq := flags.Int("freq", statful.Freq10s, "aggregation frequency in seconds")
+		aggregated := flags.String("aggregated", "", "send an already aggregated metric with this aggregation")
+		user := flags.String("user", "", "user the metric belongs to")
+		timestamp := flags.Int64("timestamp", 0, "unix timestamp, defaults to now")
+
+		if err := flags.Parse(c.args); err != nil {
+			return 2
+		}
+		if flags.NArg() < 1 || flags.NArg() > 2 || (flags.NArg() == 1 && !optionalValue) {
+			flags.Usage()
+			return 2
+		}
+
+		name := flags.Arg(0)
+		value := 1.0
+		if flags.NArg() == 2 {
+			var err error
+			if value, err = parseValue(flags.Arg(1)); err != nil {
+				c.logger.Println(err)
+				return 2
+			}
+		}
+
+		if !statful.ValidFrequency(statful.AggregationFrequency(*freq)) {
+			c.logger.Printf("invalid frequency %d", *freq)
+			return 2
+		}
+
+		if *timestamp == 0 {
+			*timestamp = time.Now().Unix()
+		}
+
+		var opts []statful.PutOption
+		if *user != "" {
+			opts = append(opts, statful.WithUser(*user))
+		}
+
+		if *aggregated != "" {
+			agg := statful.Aggregation(*aggregated)
+			if !statful.ValidAggregation(agg) {
+				c.logger.Printf("invalid aggregation %q", *aggregated)
+				return 2
+			}
+			_ = c.client.PutAggregated(name, value, statful.Tags(tags), *timestamp, agg, statful.AggregationFrequency(*freq), opts...)
+		} else {
+			parsed, err := parseAggregations(*aggs)
+			if err != nil {
+				c.logger.Println(err)
+				return 2
+			}
+			_ = c.client.Put(name, value, statful.Tags(tags), *timestamp, parsed, statful.AggregationFrequency(*freq), opts...)
+		}
+
+		if err := c.client.FlushError(); err != nil {
+			c.logger.Println(err)
+			return 1
+		}
+
+		return 0
+	}
+}
+
+func parseAggregations(s string) (statful.Aggregations, error) {
+	aggs := statful.Aggregations{}
+	for _, agg := range strings.Split(s, ",") {
+		agg = strings.TrimSpace(agg)
+		if agg == "" {
+			continue
+		}
+		if !statful.ValidAggregation(statful.Aggregation(agg)) {
+			return nil, fmt.Errorf("invalid aggregation %q", agg)
+		}
+		aggs.Add(statful.Aggregation(agg))
+	}
+
+	return aggs, nil
+}
+
+type attributesFlag struct {
+	attributes *[]statful.Attribute
+}
+
+func (a attributesFlag) String() string {
+	return ""
+}
+
+func (a attributesFlag) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("invalid attribute %q, expected key=value", value)
+	}
+	*a.attributes = append(*a.attributes, statful.Attribute{Attribute: kv[0], Value: kv[1]})
+
+	return nil
+}
+
+func eventCommand(c *command) int {
+	flags := c.flagSet("")
+	event := statful.Event{VariableAttributes: []statful.Attribute{}}
+	rawJson := flags.String("json", "", "event JSON, - to read it from stdin, overrides the other flags")
+	flags.StringVar(&event.EventId, "id", "", "event id")
+	flags.StringVar(&event.EventType, "type", "", "event type")
+	flags.StringVar(&event.UserId, "user-id", "", "user id")
+	flags.StringVar(&event.ExtUserId, "ext-user-id", "", "external user id")
+	flags.StringVar(&event.GameId, "game", "", "game id")
+	flags.StringVar(&event.OperatorId, "operator", "", "operator id")
+	flags.StringVar(&event.AggregatorId, "aggregator", "", "aggregator id")
+	flags.StringVar(&event.PublisherId, "publisher", "", "publisher id")
+	flags.IntVar(&event.Amount.Value, "amount", 0, "amount value")
+	flags.StringVar(&event.Amount.Currency, "currency", "", "amount currency")
+	flags.IntVar(&event.Timestamp, "timestamp", 0, "unix timestamp, defaults to now")
+	flags.Var(attributesFlag{attributes: &event.VariableAttributes}, "attr", "variable attribute as key=value, can be repeated")
+
+	if err := flags.Parse(c.args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if *rawJson != "" {
+		data := []byte(*rawJson)
+		if *rawJson == "-" {
+			var err error
+			if data, err = ioutil.ReadAll(os.Stdin); err != nil {
+				c.logger.Println(err)
+				return 1
+			}
+		}
+		event = statful.Event{}
+		if err := json.Unmarshal(data, &event); err != nil {
+			c.logger.Printf("invalid event json: %v", err)
+			return 2
+		}
+	}
+
+	if event.Timestamp == 0 {
+		event.Timestamp = int(time.Now().Unix())
+	}
+
+	c.client.Event(event)
+	if err := c.client.FlushEvents(); err != nil {
+		c.logger.Println(err)
+		return 1
+	}
+
+	return 0
+}
+
+func flushFileCommand(c *command) int {
+	flags := c.flagSet("file...")
+	batchSize := flags.Int("batch", 1000, "maximum records per request")
+
+	if err := flags.Parse(c.args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 || *batchSize <= 0 {
+		flags.Usage()
+		return 2
+	}
+
+	failed := 0
+	for _, path := range flags.Args() {
+		n, err := c.flushFile(path, *batchSize)
+		if err != nil {
+			c.logger.Printf("%s: %v", path, err)
+			n++
+		}
+		failed += n
+	}
+
+	if failed > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+// flushFile puts the records of a capture file in the client, flushing every batchSize records of a kind.
+// Malformed records are reported and skipped so the rest of the file is still sent. It returns the number
+// of records that failed.
+func (c *command) flushFile(path string, batchSize int) (int, error) {
+	f, err := statful.OpenCapture(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	failed := 0
+	batcher := &statful.CaptureBatcher{Size: batchSize}
+	scanner := statful.NewCaptureScanner(f)
+	for scanner.Scan() {
+		record, err := scanner.Record()
+		if err != nil {
+			c.logger.Printf("%s:%d: %v", path, record.LineNumber, err)
+			failed++
+			continue
+		}
+
+		if b, full := batcher.Add(record); full {
+			failed += c.flushBatch(path, b)
+		}
+	}
+
+	for _, b := range batcher.Flush() {
+		failed += c.flushBatch(path, b)
+	}
+
+	return failed, scanner.Err()
+}
+
+// flushBatch puts the records of the batch in the client and flushes them, it returns the number of records
+// that failed.
+func (c *command) flushBatch(path string, b statful.CaptureBatch) int {
+	failed := 0
+	for _, record := range b.Records {
+		if err := c.putRecord(record); err != nil {
+			c.logger.Printf("%s:%d: %v", path, record.LineNumber, err)
+			failed++
+		}
+	}
+
+	put := len(b.Records) - failed
+	if put == 0 {
+		return failed
+	}
+
+	var err error
+	if b.Kind == statful.CaptureEvent {
+		err = c.client.FlushEvents()
+	} else {
+		err = c.client.FlushError()
+	}
+	if err != nil {
+		first, last := b.Records[0].LineNumber, b.Records[len(b.Records)-1].LineNumber
+		c.logger.Printf("%s:%d-%d: failed to send %d records: %v", path, first, last, put, err)
+		failed += put
+	}
+
+	return failed
+}
+
+func (c *command) putRecord(record statful.CaptureRecord) error {
+	if record.Kind == statful.CaptureEvent {
+		var event statful.Event
+		if err := json.Unmarshal([]byte(record.Line), &event); err != nil {
+			return fmt.Errorf("invalid event json: %v", err)
+		}
+		c.client.Event(event)
+		return nil
+	}
+
+	m, err := statful.MetricParser{Lenient: true}.Parse(record.Line)
+	if err != nil {
+		return err
+	}
+
+	var opts []statful.PutOption
+	if m.User != "" {
+		opts = append(opts, statful.WithUser(m.User))
+	}
+
+	if record.Kind == statful.CaptureAggregated {
+		return c.client.PutAggregated(m.Name, m.Value, m.Tags, m.Timestamp, record.Aggregation, record.Frequency, opts...)
+	}
+
+	return c.client.Put(m.Name, m.Value, m.Tags, m.Timestamp, m.Aggregations, m.Frequency, opts...)
+}
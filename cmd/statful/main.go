@@ -0,0 +1,184 @@
+// Command statful sends metrics and events to Statful from shell scripts and cron jobs.
+//
+// Usage:
+//
+//	statful [global flags] <command> [flags] [arguments]
+//
+// Commands:
+//
+//	counter name [value]       send a counter, value defaults to 1
+//	gauge name value           send a gauge
+//	timer name value           send a timer
+//	put name value             send a metric with custom aggregations
+//	event                      send an event
+//	flush-file file...         send the metrics and events of capture files
+//
+// The configuration is read from a JSON -config file with statful.ConfigFromFile or else from the STATFUL_
+// environment variables with statful.ConfigFromEnv, the -url, -base-path, -token, -timeout and -dry-run flags
+// take precedence over both.
+// The command exits with a non-zero code when the metrics fail to be sent.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/statful/statful-client-golang"
+	"github.com/statful/statful-client-golang/internal/cliflag"
+)
+
+const usage = `Usage: statful [global flags] <command> [flags] [arguments]
+
+Commands:
+  counter name [value]    send a counter, value defaults to 1
+  gauge name value        send a gauge
+  timer name value        send a timer
+  put name value          send a metric with custom aggregations
+  event                   send an event
+  flush-file file...      send the metrics and events of capture files
+
+Run "statful <command> -h" for the command flags.
+
+Global flags:
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	logger := log.New(stderr, "statful: ", 0)
+
+	flags := flag.NewFlagSet("statful", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	configPath := flags.String("config", os.Getenv("STATFUL_CONFIG"), "JSON config file read with statful.ConfigFromFile instead of the environment, defaults to $STATFUL_CONFIG")
+	flags.String("url", "", "Statful API url, defaults to $STATFUL_URL or https://api.statful.com")
+	flags.String("base-path", "", "Statful API base path, defaults to $STATFUL_BASE_PATH")
+	flags.String("token", "", "Statful API token, defaults to $STATFUL_TOKEN")
+	flags.Duration("timeout", 0, "HTTP request timeout, defaults to $STATFUL_TIMEOUT or 2s")
+	flags.Bool("dry-run", false, "print the metrics instead of sending them")
+	globalTags := cliflag.Tags{}
+	flags.Var(globalTags, "tag", "global tag as key=value, can be repeated")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	overrides := map[string]string{}
+	flags.Visit(func(f *flag.Flag) {
+		if _, ok := flagEnvKeys[f.Name]; ok {
+			overrides[f.Name] = f.Value.String()
+		}
+	})
+
+	cfg, err := loadConfig(*configPath, overrides)
+	if err != nil {
+		logger.Println(err)
+		return 2
+	}
+	tags := statful.Tags{}.Merge(cfg.Tags).Merge(statful.Tags(globalTags))
+
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		logger.Printf("unknown command %q", flags.Arg(0))
+		flags.Usage()
+		return 2
+	}
+
+	client := statful.New(statful.Configuration{
+		DisableAutoFlush: true,
+		DryRun:           cfg.DryRun,
+		Tags:             tags,
+		Logger:           log.New(stdout, "", 0),
+		Sender:           cfg.Sender,
+		Processors:       cfg.Processors,
+	})
+
+	return cmd(&command{
+		name:   flags.Arg(0),
+		args:   flags.Args()[1:],
+		client: client,
+		stdout: stdout,
+		stderr: stderr,
+		logger: logger,
+	})
+}
+
+// flagEnvKeys maps the global flags to the environment variables they take precedence over.
+var flagEnvKeys = map[string]string{
+	"url":       "STATFUL_URL",
+	"base-path": "STATFUL_BASE_PATH",
+	"token":     "STATFUL_TOKEN",
+	"timeout":   "STATFUL_TIMEOUT",
+	"dry-run":   "STATFUL_DRY_RUN",
+}
+
+// loadConfig reads the configuration from the file at path or, without a path, from the STATFUL_ environment
+// variables. The flags set in overrides, keyed by flag name, take precedence over both.
+func loadConfig(path string, overrides map[string]string) (statful.Configuration, error) {
+	if path == "" {
+		env := map[string]string{}
+		for name, v := range overrides {
+			env[flagEnvKeys[name]] = v
+		}
+
+		return statful.ConfigFromLookup("STATFUL", func(key string) (string, bool) {
+			if v, ok := env[key]; ok {
+				return v, true
+			}
+			return os.LookupEnv(key)
+		})
+	}
+
+	cfg, err := statful.ConfigFromFile(path)
+	if err != nil || len(overrides) == 0 {
+		return cfg, err
+	}
+
+	sender, ok := cfg.Sender.(*statful.HttpSender)
+	if !ok {
+		return cfg, fmt.Errorf("the url, base-path, token, timeout and dry-run flags require the http sender")
+	}
+	for name, v := range overrides {
+		switch name {
+		case "url":
+			sender.Url = v
+		case "base-path":
+			sender.BasePath = v
+		case "token":
+			sender.Token = v
+		case "timeout":
+			// already validated by the flag
+			timeout, _ := time.ParseDuration(v)
+			sender.Http = &http.Client{Timeout: timeout}
+		case "dry-run":
+			cfg.DryRun = v == "true"
+		}
+	}
+
+	return cfg, nil
+}
+
+func parseValue(s string) (float64, error) {
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", s)
+	}
+
+	return value, nil
+}
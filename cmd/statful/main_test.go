@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type request struct {
+	path string
+	body string
+}
+
+func newServer(t *testing.T, status int) (*httptest.Server, func() []request) {
+	var mu sync.Mutex
+	var requests []request
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error("Failed to read request body:", err)
+		}
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gr, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				t.Error("Failed to unzip request body:", err)
+			}
+			body, _ = ioutil.ReadAll(gr)
+		}
+
+		mu.Lock()
+		requests = append(requests, request{path: r.URL.Path, body: string(body)})
+		mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+
+	return srv, func() []request {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests
+	}
+}
+
+func TestRun_Metrics(t *testing.T) {
+	srv, requests := newServer(t, http.StatusOK)
+	defer srv.Close()
+
+	scenarios := []struct {
+		description string
+		args        []string
+		path        string
+		body        *regexp.Regexp
+	}{
+		{
+			description: "counter with default value",
+			args:        []string{"counter", "-tag", "job=backup", "jobs.run"},
+			path:        "/tel/v2.0/metrics",
+			body:        regexp.MustCompile(`^jobs\.run(,(job=backup|env=test))+ 1\.000000 [0-9]+ ((count|sum),)+10$`),
+		},
+		{
+			description: "gauge",
+			args:        []string{"gauge", "disk.usage", "0.75"},
+			path:        "/tel/v2.0/metrics",
+			body:        regexp.MustCompile(`^disk\.usage,env=test 0\.750000 [0-9]+ last,10$`),
+		},
+		{
+			description: "timer with user and frequency",
+			args:        []string{"timer", "-user", "u1", "-freq", "60", "-timestamp", "1585161000", "backup.duration", "12.5"},
+			path:        "/tel/v2.0/metrics",
+			body:        regexp.MustCompile(`^backup\.duration,env=test value=12\.500000,user_id=u1 1585161000 ((avg|count|p90),)+60$`),
+		},
+		{
+			description: "aggregated put",
+			args:        []string{"put", "-aggregated", "avg", "-freq", "30", "-timestamp", "1585161000", "queue.size", "3"},
+			path:        "/tel/v2.0/aggregation/avg/frequency/30",
+			body:        regexp.MustCompile(`^queue\.size,env=test 3\.000000 1585161000$`),
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			before := len(requests())
+
+			var stderr bytes.Buffer
+			args := append([]string{"-url", srv.URL, "-token", "token", "-tag", "env=test"}, s.args...)
+			if code := run(args, ioutil.Discard, &stderr); code != 0 {
+				t.Fatalf("run() returned %d: %s", code, stderr.String())
+			}
+
+			sent := requests()[before:]
+			if len(sent) != 1 {
+				t.Fatalf("expected 1 request, got %v", sent)
+			}
+			if sent[0].path != s.path || !s.body.MatchString(sent[0].body) {
+				t.Errorf("sent %s %q, expected %s %s", sent[0].path, sent[0].body, s.path, s.body)
+			}
+		})
+	}
+}
+
+func TestRun_Event(t *testing.T) {
+	srv, requests := newServer(t, http.StatusOK)
+	defer srv.Close()
+
+	var stderr bytes.Buffer
+	args := []string{"-url", srv.URL, "-token", "token", "event", "-type", "deploy", "-attr", "version=1.2.3", "-timestamp", "1585161000"}
+	if code := run(args, ioutil.Discard, &stderr); code != 0 {
+		t.Fatalf("run() returned %d: %s", code, stderr.String())
+	}
+
+	sent := requests()
+	if len(sent) != 1 || sent[0].path != "/insights/event" {
+		t.Fatalf("unexpected requests: %v", sent)
+	}
+
+	var events []map[string]interface{}
+	if err := json.Unmarshal([]byte(sent[0].body), &events); err != nil {
+		t.Fatalf("invalid events payload %q: %v", sent[0].body, err)
+	}
+	if len(events) != 1 || events[0]["eventType"] != "deploy" || events[0]["timestamp"] != 1585161000.0 {
+		t.Errorf("unexpected events: %v", events)
+	}
+}
+
+func TestRun_FlushFile(t *testing.T) {
+	srv, requests := newServer(t, http.StatusOK)
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "statful-cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "metrics.log")
+	capture := "jobs.run 1.000000 1585161000\n@sum,10 jobs.items 10.000000 1585161000\n{\"eventType\":\"deploy\"}\n"
+	if err := ioutil.WriteFile(path, []byte(capture), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stderr bytes.Buffer
+	if code := run([]string{"-url", srv.URL, "-token", "token", "flush-file", path}, ioutil.Discard, &stderr); code != 0 {
+		t.Fatalf("run() returned %d: %s", code, stderr.String())
+	}
+
+	var paths []string
+	for _, r := range requests() {
+		paths = append(paths, r.path)
+	}
+	expected := "/tel/v2.0/metrics /tel/v2.0/aggregation/sum/frequency/10 /insights/event"
+	if strings.Join(paths, " ") != expected {
+		t.Errorf("requests to %v, expected %s", paths, expected)
+	}
+
+	// gzipped files go through the client with the global tags, malformed records don't stop the file
+	gzPath := filepath.Join(dir, "metrics.log.gz")
+	f, err := os.Create(gzPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := gzip.NewWriter(f)
+	_, _ = gw.Write([]byte("jobs.run 1.000000 1585161000\njobs.run broken 1585161001\njobs.run 2.000000 1585161002\n"))
+	_ = gw.Close()
+	_ = f.Close()
+
+	stderr.Reset()
+	if code := run([]string{"-url", srv.URL, "-token", "token", "-tag", "host=cron", "flush-file", "-batch", "1", gzPath}, ioutil.Discard, &stderr); code != 1 {
+		t.Errorf("run() returned %d, expected 1: %s", code, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "metrics.log.gz:2:") {
+		t.Errorf("malformed record not reported: %q", stderr.String())
+	}
+
+	sent := requests()[3:]
+	if len(sent) != 2 {
+		t.Fatalf("sent %d requests, expected 2: %v", len(sent), sent)
+	}
+	for idx, value := range []string{"1.000000 1585161000", "2.000000 1585161002"} {
+		if expected := "jobs.run,host=cron " + value; sent[idx].body != expected {
+			t.Errorf("request %d body: %q, expected: %q", idx, sent[idx].body, expected)
+		}
+	}
+}
+
+func TestRun_Failures(t *testing.T) {
+	srv, _ := newServer(t, http.StatusInternalServerError)
+	defer srv.Close()
+
+	scenarios := []struct {
+		description string
+		args        []string
+		code        int
+	}{
+		{description: "api failure", args: []string{"-url", srv.URL, "-token", "token", "gauge", "disk.usage", "1"}, code: 1},
+		{description: "event api failure", args: []string{"-url", srv.URL, "-token", "token", "event", "-type", "deploy"}, code: 1},
+		{description: "missing command", args: []string{"-token", "token"}, code: 2},
+		{description: "unknown command", args: []string{"-token", "token", "histogram", "x", "1"}, code: 2},
+		{description: "missing value", args: []string{"-token", "token", "gauge", "disk.usage"}, code: 2},
+		{description: "invalid value", args: []string{"-token", "token", "gauge", "disk.usage", "full"}, code: 2},
+		{description: "invalid aggregation", args: []string{"-token", "token", "put", "-agg", "median", "x", "1"}, code: 2},
+		{description: "invalid frequency", args: []string{"-token", "token", "put", "-freq", "15", "x", "1"}, code: 2},
+		{description: "missing token", args: []string{"-url", srv.URL, "gauge", "disk.usage", "1"}, code: 2},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			if code := run(s.args, ioutil.Discard, ioutil.Discard); code != s.code {
+				t.Errorf("run() returned %d, expected %d", code, s.code)
+			}
+		})
+	}
+}
+
+func TestRun_ConfigFileAndDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statful-cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "statful.json")
+	if err := ioutil.WriteFile(path, []byte(`{"dryRun": true, "tags": {"host": "cron"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Unsetenv("STATFUL_TOKEN")
+
+	var stdout bytes.Buffer
+	if code := run([]string{"-config", path, "gauge", "-timestamp", "1585161000", "disk.usage", "1"}, &stdout, ioutil.Discard); code != 0 {
+		t.Fatalf("run() returned %d", code)
+	}
+
+	expected := "Dry metric: disk.usage,host=cron 1.000000 1585161000 last,10\n"
+	if stdout.String() != expected {
+		t.Errorf("output: %q, expected: %q", stdout.String(), expected)
+	}
+}
+
+func TestRun_ConfigFileOverrides(t *testing.T) {
+	srv, requests := newServer(t, http.StatusOK)
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "statful-cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "statful.json")
+	config := `{"url": "http://127.0.0.1:1", "token": "file-token", "dryRun": true, "processors": [{"type": "addTags", "tags": {"team": "ops"}}]}`
+	if err := ioutil.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var stderr bytes.Buffer
+	args := []string{"-config", path, "-url", srv.URL, "-dry-run=false", "gauge", "-timestamp", "1585161000", "disk.usage", "1"}
+	if code := run(args, ioutil.Discard, &stderr); code != 0 {
+		t.Fatalf("run() returned %d: %s", code, stderr.String())
+	}
+
+	sent := requests()
+	if len(sent) != 1 || sent[0].body != "disk.usage,team=ops 1.000000 1585161000 last,10" {
+		t.Errorf("sent %v", sent)
+	}
+}
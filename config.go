@@ -0,0 +1,423 @@
+package statful
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultUrl         = "https://api.statful.com"
+	DefaultHttpTimeout = 2 * time.Second
+	DefaultFlushSize   = 1000
+
+	// DefaultFlushInterval is applied by NewWithError when auto flush is enabled and no FlushInterval is set.
+	DefaultFlushInterval = 5 * time.Second
+)
+
+// ConfigError reports an invalid configuration value, Key is the environment variable or the file key.
+type ConfigError struct {
+	Source string
+	Key    string
+	Msg    string
+}
+
+func (c *ConfigError) Error() string {
+	if c.Source != "" {
+		return fmt.Sprintf("%s: %s %s", c.Source, c.Key, c.Msg)
+	}
+
+	return fmt.Sprintf("%s %s", c.Key, c.Msg)
+}
+
+// fileConfig is the JSON configuration file, every key is optional.
+type fileConfig struct {
+	Sender           string            `json:"sender"`
+	Url              string            `json:"url"`
+	BasePath         string            `json:"basePath"`
+	Token            string            `json:"token"`
+	NoCompression    bool              `json:"noCompression"`
+	Timeout          string            `json:"timeout"`
+	Address          string            `json:"address"`
+	Tags             map[string]string `json:"tags"`
+	FlushSize        int               `json:"flushSize"`
+	FlushInterval    string            `json:"flushInterval"`
+	DisableAutoFlush bool              `json:"disableAutoFlush"`
+	DryRun           bool              `json:"dryRun"`
+	LogLevel         string            `json:"logLevel"`
+	Processors       []processorConfig `json:"processors"`
+}
+
+// processorConfig is a processor of the configuration file, the keys used depend on the type.
+type processorConfig struct {
+	Type        string            `json:"type"`
+	Pattern     string            `json:"pattern"`
+	Replacement string            `json:"replacement"`
+	Patterns    []string          `json:"patterns"`
+	Tags        map[string]string `json:"tags"`
+	Names       []string          `json:"names"`
+	Tag         string            `json:"tag"`
+	Mapping     map[string]string `json:"mapping"`
+}
+
+// ConfigFromFile reads a Configuration from a JSON file:
+//
+//	{
+//	  "sender": "http",
+//	  "url": "https://api.statful.com",
+//	  "basePath": "",
+//	  "token": "12345678-90ab-cdef-1234-567890abcdef",
+//	  "noCompression": false,
+//	  "timeout": "2s",
+//	  "address": "127.0.0.1:2013",
+//	  "tags": {"env": "production"},
+//	  "flushSize": 1000,
+//	  "flushInterval": "5s",
+//	  "disableAutoFlush": false,
+//	  "dryRun": false,
+//	  "logLevel": "info",
+//	  "processors": [
+//	    {"type": "denyMetrics", "patterns": ["^debug\\."]},
+//	    {"type": "renameMetric", "pattern": "^app\\.", "replacement": "service."},
+//	    {"type": "addTags", "tags": {"team": "platform"}},
+//	    {"type": "dropTags", "names": ["host"]},
+//	    {"type": "renameTags", "mapping": {"environment": "env"}},
+//	    {"type": "mapTagValues", "tag": "env", "mapping": {"prd": "production"}}
+//	  ]
+//	}
+//
+// The sender is one of http, the default, udp or tcp. The flush size defaults to DefaultFlushSize and the timeout
+// to DefaultHttpTimeout. The http sender requires a token, unless dryRun is set,
+// and the udp and tcp senders an address. Durations use the time.ParseDuration format. The Logger is a StdLogger
+// writing to standard error the entries of logLevel or above, one of debug, info, the default, warn or error.
+// Processors, run in order, are one of renameMetric, addTags, dropTags, renameTags, mapTagValues, allowMetrics
+// and denyMetrics, see the Processor implementations. Invalid values are reported as a *ConfigError naming the key.
+func ConfigFromFile(path string) (Configuration, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Configuration{}, err
+	}
+
+	var fc fileConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&fc); err != nil {
+		return Configuration{}, fileConfigError(path, err)
+	}
+
+	processors, err := buildProcessors(path, fc.Processors)
+	if err != nil {
+		return Configuration{}, err
+	}
+
+	return buildConfig(path, map[string]string{
+		"sender":        fc.Sender,
+		"url":           fc.Url,
+		"basePath":      fc.BasePath,
+		"token":         fc.Token,
+		"timeout":       fc.Timeout,
+		"address":       fc.Address,
+		"flushInterval": fc.FlushInterval,
+		"logLevel":      fc.LogLevel,
+	}, configValues{
+		noCompression:    fc.NoCompression,
+		tags:             fc.Tags,
+		flushSize:        fc.FlushSize,
+		disableAutoFlush: fc.DisableAutoFlush,
+		dryRun:           fc.DryRun,
+		processors:       processors,
+	}, func(key string) string {
+		return key
+	})
+}
+
+func fileConfigError(path string, err error) error {
+	switch e := err.(type) {
+	case *json.UnmarshalTypeError:
+		return &ConfigError{Source: path, Key: e.Field, Msg: fmt.Sprintf("must be a %s, got %s", e.Type, e.Value)}
+	case *json.SyntaxError:
+		return &ConfigError{Source: path, Key: "json", Msg: fmt.Sprintf("syntax error at offset %d: %v", e.Offset, e)}
+	}
+
+	if msg := err.Error(); strings.HasPrefix(msg, "json: unknown field ") {
+		return &ConfigError{Source: path, Key: strings.Trim(strings.TrimPrefix(msg, "json: unknown field "), `"`), Msg: "is not a configuration key"}
+	}
+
+	return &ConfigError{Source: path, Key: "json", Msg: err.Error()}
+}
+
+// ConfigFromEnv reads a Configuration from environment variables named after the configuration file keys
+// with the prefix, e.g. with the STATFUL prefix:
+//
+//	STATFUL_SENDER, STATFUL_URL, STATFUL_BASE_PATH, STATFUL_TOKEN, STATFUL_NO_COMPRESSION, STATFUL_TIMEOUT,
+//	STATFUL_ADDRESS, STATFUL_TAGS, STATFUL_FLUSH_SIZE, STATFUL_FLUSH_INTERVAL, STATFUL_DISABLE_AUTO_FLUSH,
+//	STATFUL_DRY_RUN, STATFUL_LOG_LEVEL
+//
+// Tags are a comma separated list of key=value pairs. See ConfigFromFile for the defaults and validation,
+// invalid values are reported as a *ConfigError naming the variable.
+func ConfigFromEnv(prefix string) (Configuration, error) {
+	return ConfigFromLookup(prefix, os.LookupEnv)
+}
+
+// ConfigFromLookup reads a Configuration like ConfigFromEnv with lookup returning the value of a variable,
+// e.g. to give command line flags precedence over the environment.
+func ConfigFromLookup(prefix string, lookup func(key string) (string, bool)) (Configuration, error) {
+	if prefix != "" && !strings.HasSuffix(prefix, "_") {
+		prefix += "_"
+	}
+
+	envKeys := map[string]string{
+		"sender":           "SENDER",
+		"url":              "URL",
+		"basePath":         "BASE_PATH",
+		"token":            "TOKEN",
+		"noCompression":    "NO_COMPRESSION",
+		"timeout":          "TIMEOUT",
+		"address":          "ADDRESS",
+		"tags":             "TAGS",
+		"flushSize":        "FLUSH_SIZE",
+		"flushInterval":    "FLUSH_INTERVAL",
+		"disableAutoFlush": "DISABLE_AUTO_FLUSH",
+		"dryRun":           "DRY_RUN",
+		"logLevel":         "LOG_LEVEL",
+	}
+	keyOf := func(key string) string {
+		return prefix + envKeys[key]
+	}
+	env := func(key string) string {
+		v, _ := lookup(keyOf(key))
+		return strings.TrimSpace(v)
+	}
+
+	var values configValues
+	var err error
+	if values.noCompression, err = envBool(keyOf("noCompression"), env("noCompression")); err != nil {
+		return Configuration{}, err
+	}
+	if values.disableAutoFlush, err = envBool(keyOf("disableAutoFlush"), env("disableAutoFlush")); err != nil {
+		return Configuration{}, err
+	}
+	if values.dryRun, err = envBool(keyOf("dryRun"), env("dryRun")); err != nil {
+		return Configuration{}, err
+	}
+	if v := env("flushSize"); v != "" {
+		if values.flushSize, err = strconv.Atoi(v); err != nil {
+			return Configuration{}, &ConfigError{Key: keyOf("flushSize"), Msg: fmt.Sprintf("must be an integer, got %q", v)}
+		}
+	}
+	if v := env("tags"); v != "" {
+		values.tags = map[string]string{}
+		for _, tag := range strings.Split(v, ",") {
+			kv := strings.SplitN(strings.TrimSpace(tag), "=", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return Configuration{}, &ConfigError{Key: keyOf("tags"), Msg: fmt.Sprintf("must be a list of key=value, got %q", tag)}
+			}
+			values.tags[kv[0]] = kv[1]
+		}
+	}
+
+	strs := map[string]string{}
+	for _, key := range []string{"sender", "url", "basePath", "token", "timeout", "address", "flushInterval", "logLevel"} {
+		strs[key] = env(key)
+	}
+
+	return buildConfig("", strs, values, keyOf)
+}
+
+// configValues holds the settings that aren't strings.
+type configValues struct {
+	noCompression    bool
+	tags             map[string]string
+	flushSize        int
+	disableAutoFlush bool
+	dryRun           bool
+	processors       []Processor
+}
+
+func envBool(key string, value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, &ConfigError{Key: key, Msg: fmt.Sprintf("must be a boolean, got %q", value)}
+	}
+
+	return b, nil
+}
+
+// buildConfig validates the values and builds the Configuration, keyOf maps a file key to the name reported in errors.
+func buildConfig(source string, strs map[string]string, values configValues, keyOf func(string) string) (Configuration, error) {
+	invalid := func(key string, format string, args ...interface{}) (Configuration, error) {
+		return Configuration{}, &ConfigError{Source: source, Key: keyOf(key), Msg: fmt.Sprintf(format, args...)}
+	}
+
+	timeout := DefaultHttpTimeout
+	if v := strs["timeout"]; v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return invalid("timeout", "must be a positive duration like 2s, got %q", v)
+		}
+		timeout = d
+	}
+
+	var flushInterval time.Duration
+	if v := strs["flushInterval"]; v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return invalid("flushInterval", "must be a positive duration like 5s, got %q", v)
+		}
+		flushInterval = d
+	}
+
+	level := LevelInfo
+	switch v := strs["logLevel"]; v {
+	case "", "info":
+	case "debug":
+		level = LevelDebug
+	case "warn":
+		level = LevelWarn
+	case "error":
+		level = LevelError
+	default:
+		return invalid("logLevel", "must be debug, info, warn or error, got %q", v)
+	}
+
+	if values.flushSize < 0 {
+		return invalid("flushSize", "must not be negative, got %d", values.flushSize)
+	}
+	if values.flushSize == 0 {
+		values.flushSize = DefaultFlushSize
+	}
+
+	var sender Sender
+	switch kind := strs["sender"]; kind {
+	case "", "http":
+		u := strs["url"]
+		if u == "" {
+			u = DefaultUrl
+		}
+		if parsed, err := url.Parse(u); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return invalid("url", "must be an absolute url, got %q", u)
+		}
+		if strs["token"] == "" && !values.dryRun {
+			return invalid("token", "is required by the http sender")
+		}
+
+		sender = &HttpSender{
+			Http:          &http.Client{Timeout: timeout},
+			Url:           u,
+			BasePath:      strs["basePath"],
+			Token:         strs["token"],
+			NoCompression: values.noCompression,
+		}
+	case "udp", "tcp":
+		if strs["address"] == "" {
+			return invalid("address", "is required by the %s sender", kind)
+		}
+
+		if kind == "udp" {
+			sender = &UdpSender{Address: strs["address"], Timeout: timeout}
+		} else {
+			sender = &TcpSender{Address: strs["address"], Timeout: timeout}
+		}
+	default:
+		return invalid("sender", "must be http, udp or tcp, got %q", kind)
+	}
+
+	return Configuration{
+		DisableAutoFlush: values.disableAutoFlush,
+		DryRun:           values.dryRun,
+		Tags:             Tags(values.tags),
+		FlushSize:        values.flushSize,
+		FlushInterval:    flushInterval,
+		Logger:           StdLogger{Logger: log.New(os.Stderr, "statful: ", log.LstdFlags), Level: level},
+		Sender:           sender,
+		Processors:       values.processors,
+	}, nil
+}
+
+func buildProcessors(source string, configs []processorConfig) ([]Processor, error) {
+	var processors []Processor
+	for idx, pc := range configs {
+		configErr := func(key string, format string, args ...interface{}) error {
+			return &ConfigError{Source: source, Key: fmt.Sprintf("processors[%d].%s", idx, key), Msg: fmt.Sprintf(format, args...)}
+		}
+		invalid := func(key string, format string, args ...interface{}) ([]Processor, error) {
+			return nil, configErr(key, format, args...)
+		}
+		compile := func(key string, pattern string) (*regexp.Regexp, error) {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, configErr(key, "must be a regular expression, got %q", pattern)
+			}
+			return re, nil
+		}
+
+		switch pc.Type {
+		case "renameMetric":
+			if pc.Pattern == "" {
+				return invalid("pattern", "is required by the %s processor", pc.Type)
+			}
+			re, err := compile("pattern", pc.Pattern)
+			if err != nil {
+				return nil, err
+			}
+			processors = append(processors, RenameMetric{Pattern: re, Replacement: pc.Replacement})
+		case "addTags":
+			if len(pc.Tags) == 0 {
+				return invalid("tags", "is required by the %s processor", pc.Type)
+			}
+			processors = append(processors, AddTags{Tags: Tags(pc.Tags)})
+		case "dropTags":
+			if len(pc.Names) == 0 {
+				return invalid("names", "is required by the %s processor", pc.Type)
+			}
+			processors = append(processors, DropTags{Names: pc.Names})
+		case "renameTags":
+			if len(pc.Mapping) == 0 {
+				return invalid("mapping", "is required by the %s processor", pc.Type)
+			}
+			processors = append(processors, RenameTags{Names: pc.Mapping})
+		case "mapTagValues":
+			if pc.Tag == "" {
+				return invalid("tag", "is required by the %s processor", pc.Type)
+			}
+			if len(pc.Mapping) == 0 {
+				return invalid("mapping", "is required by the %s processor", pc.Type)
+			}
+			processors = append(processors, MapTagValues{Tag: pc.Tag, Values: pc.Mapping})
+		case "allowMetrics", "denyMetrics":
+			if len(pc.Patterns) == 0 {
+				return invalid("patterns", "is required by the %s processor", pc.Type)
+			}
+			var patterns []*regexp.Regexp
+			for i, p := range pc.Patterns {
+				re, err := compile(fmt.Sprintf("patterns[%d]", i), p)
+				if err != nil {
+					return nil, err
+				}
+				patterns = append(patterns, re)
+			}
+			if pc.Type == "allowMetrics" {
+				processors = append(processors, AllowMetrics{Patterns: patterns})
+			} else {
+				processors = append(processors, DenyMetrics{Patterns: patterns})
+			}
+		default:
+			return invalid("type", "must be renameMetric, addTags, dropTags, renameTags, mapTagValues, allowMetrics or denyMetrics, got %q", pc.Type)
+		}
+	}
+
+	return processors, nil
+}
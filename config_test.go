@@ -0,0 +1,235 @@
+package statful
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes content to a temporary config file, the returned function removes it.
+func writeConfigFile(t *testing.T, content string) (string, func()) {
+	dir, err := ioutil.TempDir("", "statful-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	remove := func() { os.RemoveAll(dir) }
+
+	path := filepath.Join(dir, "statful.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		remove()
+		t.Fatal(err)
+	}
+
+	return path, remove
+}
+
+func TestConfigFromFile(t *testing.T) {
+	path, remove := writeConfigFile(t, `{
+		"url": "https://api.example.com",
+		"basePath": "/statful",
+		"token": "token",
+		"noCompression": true,
+		"timeout": "500ms",
+		"tags": {"env": "prod"},
+		"flushInterval": "5s",
+		"dryRun": true,
+		"logLevel": "debug"
+	}`)
+	defer remove()
+
+	cfg, err := ConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("ConfigFromFile() returned error: %v", err)
+	}
+
+	expected := &HttpSender{
+		Http:          &http.Client{Timeout: 500 * time.Millisecond},
+		Url:           "https://api.example.com",
+		BasePath:      "/statful",
+		Token:         "token",
+		NoCompression: true,
+	}
+	if !reflect.DeepEqual(cfg.Sender, expected) {
+		t.Errorf("sender: %+v, expected: %+v", cfg.Sender, expected)
+	}
+	if !reflect.DeepEqual(cfg.Tags, Tags{"env": "prod"}) || cfg.FlushSize != DefaultFlushSize || cfg.FlushInterval != 5*time.Second || !cfg.DryRun || cfg.DisableAutoFlush {
+		t.Errorf("configuration: %+v", cfg)
+	}
+	if logger, ok := cfg.Logger.(StdLogger); !ok || logger.Logger == nil || logger.Level != LevelDebug {
+		t.Errorf("logger: %+v", cfg.Logger)
+	}
+}
+
+func TestConfigFromFile_Processors(t *testing.T) {
+	path, remove := writeConfigFile(t, `{
+		"dryRun": true,
+		"processors": [
+			{"type": "denyMetrics", "patterns": ["^debug\\."]},
+			{"type": "renameMetric", "pattern": "^app\\.", "replacement": "service."},
+			{"type": "addTags", "tags": {"team": "platform"}},
+			{"type": "dropTags", "names": ["host"]},
+			{"type": "renameTags", "mapping": {"environment": "env"}},
+			{"type": "mapTagValues", "tag": "env", "mapping": {"prd": "production"}}
+		]
+	}`)
+	defer remove()
+
+	cfg, err := ConfigFromFile(path)
+	if err != nil {
+		t.Fatalf("ConfigFromFile() returned: %v", err)
+	}
+	if len(cfg.Processors) != 6 {
+		t.Fatalf("expected 6 processors, got: %v", cfg.Processors)
+	}
+
+	m := Metric{Name: "app.requests", Tags: Tags{"host": "a", "environment": "prd"}}
+	if !process(cfg.Processors, &m) {
+		t.Fatal("expected the metric to be kept")
+	}
+	expected := Metric{Name: "service.requests", Tags: Tags{"team": "platform", "env": "production"}}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("unexpected metric:\n\texpected: %v\n\tactual: %v", expected, m)
+	}
+
+	if process(cfg.Processors, &Metric{Name: "debug.requests", Tags: Tags{}}) {
+		t.Error("expected the debug metric to be dropped")
+	}
+}
+
+func TestConfigFromFile_Errors(t *testing.T) {
+	scenarios := []struct {
+		description string
+		content     string
+		key         string
+	}{
+		{description: "unknown key", content: `{"token": "t", "flush_size": 10}`, key: "flush_size"},
+		{description: "wrong type", content: `{"token": "t", "flushSize": "10"}`, key: "flushSize"},
+		{description: "invalid json", content: `{"token": }`, key: "json"},
+		{description: "missing token", content: `{}`, key: "token"},
+		{description: "invalid url", content: `{"token": "t", "url": "api.statful.com"}`, key: "url"},
+		{description: "invalid timeout", content: `{"token": "t", "timeout": "2"}`, key: "timeout"},
+		{description: "negative flush size", content: `{"token": "t", "flushSize": -1}`, key: "flushSize"},
+		{description: "unknown sender", content: `{"sender": "carrier-pigeon"}`, key: "sender"},
+		{description: "udp without address", content: `{"sender": "udp"}`, key: "address"},
+		{description: "unknown log level", content: `{"token": "t", "logLevel": "verbose"}`, key: "logLevel"},
+		{description: "unknown processor", content: `{"token": "t", "processors": [{"type": "uppercase"}]}`, key: "processors[0].type"},
+		{description: "invalid processor pattern", content: `{"token": "t", "processors": [{"type": "dropTags", "names": ["host"]}, {"type": "denyMetrics", "patterns": ["("]}]}`, key: "processors[1].patterns[0]"},
+		{description: "processor without tag", content: `{"token": "t", "processors": [{"type": "mapTagValues", "mapping": {"a": "b"}}]}`, key: "processors[0].tag"},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			path, remove := writeConfigFile(t, s.content)
+			defer remove()
+
+			_, err := ConfigFromFile(path)
+			configErr, ok := err.(*ConfigError)
+			if !ok {
+				t.Fatalf("ConfigFromFile() returned: %v, expected a *ConfigError", err)
+			}
+			if configErr.Key != s.key || configErr.Source != path {
+				t.Errorf("ConfigFromFile() returned: %v, expected an error for key %s", err, s.key)
+			}
+		})
+	}
+}
+
+// setEnv sets the environment variables, the returned function restores their previous values.
+func setEnv(env map[string]string) func() {
+	var restore []func()
+	for k, v := range env {
+		previous, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+
+		k := k
+		restore = append(restore, func() {
+			if ok {
+				os.Setenv(k, previous)
+			} else {
+				os.Unsetenv(k)
+			}
+		})
+	}
+
+	return func() {
+		for _, r := range restore {
+			r()
+		}
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	defer setEnv(map[string]string{
+		"TEST_STATFUL_SENDER":             "tcp",
+		"TEST_STATFUL_ADDRESS":            "127.0.0.1:2013",
+		"TEST_STATFUL_TIMEOUT":            "1s",
+		"TEST_STATFUL_TAGS":               "env=prod, host=a",
+		"TEST_STATFUL_FLUSH_SIZE":         "50",
+		"TEST_STATFUL_DISABLE_AUTO_FLUSH": "true",
+		"TEST_STATFUL_LOG_LEVEL":          "warn",
+	})()
+
+	cfg, err := ConfigFromEnv("TEST_STATFUL")
+	if err != nil {
+		t.Fatalf("ConfigFromEnv() returned error: %v", err)
+	}
+
+	if sender, ok := cfg.Sender.(*TcpSender); !ok || sender.Address != "127.0.0.1:2013" || sender.Timeout != time.Second {
+		t.Errorf("sender: %+v", cfg.Sender)
+	}
+	if !reflect.DeepEqual(cfg.Tags, Tags{"env": "prod", "host": "a"}) || cfg.FlushSize != 50 || !cfg.DisableAutoFlush || cfg.DryRun {
+		t.Errorf("configuration: %+v", cfg)
+	}
+	if logger, ok := cfg.Logger.(StdLogger); !ok || logger.Level != LevelWarn {
+		t.Errorf("logger: %+v", cfg.Logger)
+	}
+}
+
+func TestConfigFromLookup(t *testing.T) {
+	env := map[string]string{"APP_TOKEN": "token", "APP_URL": "https://statful.example.com"}
+	cfg, err := ConfigFromLookup("APP", func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	})
+	if err != nil {
+		t.Fatalf("ConfigFromLookup() returned error: %v", err)
+	}
+
+	if sender, ok := cfg.Sender.(*HttpSender); !ok || sender.Url != "https://statful.example.com" || sender.Token != "token" {
+		t.Errorf("sender: %+v", cfg.Sender)
+	}
+}
+
+func TestConfigFromEnv_Errors(t *testing.T) {
+	scenarios := []struct {
+		description string
+		env         map[string]string
+		key         string
+	}{
+		{description: "missing token", env: map[string]string{}, key: "TEST_STATFUL_TOKEN"},
+		{description: "invalid boolean", env: map[string]string{"TEST_STATFUL_DRY_RUN": "maybe"}, key: "TEST_STATFUL_DRY_RUN"},
+		{description: "invalid flush size", env: map[string]string{"TEST_STATFUL_TOKEN": "t", "TEST_STATFUL_FLUSH_SIZE": "many"}, key: "TEST_STATFUL_FLUSH_SIZE"},
+		{description: "invalid tags", env: map[string]string{"TEST_STATFUL_TOKEN": "t", "TEST_STATFUL_TAGS": "env"}, key: "TEST_STATFUL_TAGS"},
+		{description: "invalid flush interval", env: map[string]string{"TEST_STATFUL_TOKEN": "t", "TEST_STATFUL_FLUSH_INTERVAL": "-1s"}, key: "TEST_STATFUL_FLUSH_INTERVAL"},
+		{description: "invalid log level", env: map[string]string{"TEST_STATFUL_TOKEN": "t", "TEST_STATFUL_LOG_LEVEL": "loud"}, key: "TEST_STATFUL_LOG_LEVEL"},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			defer setEnv(s.env)()
+
+			_, err := ConfigFromEnv("TEST_STATFUL_")
+			configErr, ok := err.(*ConfigError)
+			if !ok {
+				t.Fatalf("ConfigFromEnv() returned: %v, expected a *ConfigError", err)
+			}
+			if configErr.Key != s.key {
+				t.Errorf("ConfigFromEnv() returned: %v, expected an error for %s", err, s.key)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package statful
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// deltaTracker converts cumulative values, like Prometheus counters, into the increase since the previous value.
+// Series that stop being reported are removed by expire, so the tracker doesn't grow with every series ever seen.
+type deltaTracker struct {
+	mu       sync.Mutex
+	previous map[string]deltaSeries
+	swept    time.Time
+
+	now func() time.Time
+}
+
+type deltaSeries struct {
+	value    float64
+	lastSeen time.Time
+}
+
+// delta returns the increase of the series since its previous value, a decrease is a counter reset and the whole
+// value is the increase. It returns false for the first value of the series.
+func (d *deltaTracker) delta(key string, value float64) (float64, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.previous == nil {
+		d.previous = map[string]deltaSeries{}
+	}
+	previous, ok := d.previous[key]
+	d.previous[key] = deltaSeries{value: value, lastSeen: d.time()}
+	if !ok {
+		return 0, false
+	}
+
+	if value < previous.value {
+		return value, true
+	}
+
+	return value - previous.value, true
+}
+
+// expire removes the series with a key starting with prefix that were last seen before the given time.
+func (d *deltaTracker) expire(prefix string, before time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key, series := range d.previous {
+		if strings.HasPrefix(key, prefix) && series.lastSeen.Before(before) {
+			delete(d.previous, key)
+		}
+	}
+}
+
+// expireIdle removes the series not seen for ttl, walking the series at most once per ttl.
+func (d *deltaTracker) expireIdle(ttl time.Duration) {
+	now := d.time()
+
+	d.mu.Lock()
+	if now.Sub(d.swept) < ttl {
+		d.mu.Unlock()
+		return
+	}
+	d.swept = now
+	d.mu.Unlock()
+
+	d.expire("", now.Add(-ttl))
+}
+
+func (d *deltaTracker) time() time.Time {
+	if d.now != nil {
+		return d.now()
+	}
+
+	return time.Now()
+}
+
+// seriesKey identifies a series by name and tags, independently of the tags order.
+func seriesKey(name string, tags Tags) string {
+	keys := make([]string, 0, len(tags))
+	for k, v := range tags {
+		keys = append(keys, k+"="+v)
+	}
+	sort.Strings(keys)
+
+	return name + "{" + strings.Join(keys, ",") + "}"
+}
@@ -0,0 +1,173 @@
+package statful
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Encoder encodes a metric into a single line of the payload handed to the sender.
+// An empty line drops a metric the format can't represent.
+type Encoder interface {
+	Encode(m Metric) string
+}
+
+// EncoderSender is implemented by senders that need metrics in a specific format.
+// A non nil encoder returned by the sender takes precedence over Configuration.Encoder.
+type EncoderSender interface {
+	Encoder() Encoder
+}
+
+// metricsSender is implemented by the senders wrapping other senders, so the buffered metrics are encoded
+// for each wrapped sender with its own encoder, and by the senders converting the metrics to another protocol.
+type metricsSender interface {
+	sendMetrics(ctx context.Context, b metricBatch) error
+}
+
+// metricBatch holds buffered metrics until the destination sender is known, encoder is the configured one.
+type metricBatch struct {
+	metrics    []Metric
+	encoder    Encoder
+	aggregated bool
+	agg        Aggregation
+	freq       AggregationFrequency
+}
+
+// lines encodes the metrics of the batch, skipping the ones the encoder drops.
+func (b metricBatch) lines(encoder Encoder) []string {
+	lines := make([]string, 0, len(b.metrics))
+	for _, m := range b.metrics {
+		if line := encoder.Encode(m); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+// sendMetricsContext encodes the batch for sender and sends it, wrapping senders forward the batch to the
+// senders they wrap.
+func sendMetricsContext(ctx context.Context, sender Sender, b metricBatch) error {
+	if ms, ok := sender.(metricsSender); ok {
+		return ms.sendMetrics(ctx, b)
+	}
+
+	data := strings.NewReader(strings.Join(b.lines(encoderFor(sender, b.encoder)), "\n"))
+	if b.aggregated {
+		return sendAggregatedContext(ctx, sender, data, b.agg, b.freq)
+	}
+
+	return sendContext(ctx, sender, data)
+}
+
+// StatfulEncoder encodes metrics in the Statful format, see MetricToString.
+type StatfulEncoder struct{}
+
+func (StatfulEncoder) Encode(m Metric) string {
+	return m.String()
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, " ", `\ `, "\n", `\n`)
+	influxTagEscaper         = strings.NewReplacer(`\`, `\\`, ",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+)
+
+// InfluxEncoder encodes metrics in the InfluxDB line protocol, with the value in the value field and the timestamp
+// in nanoseconds: measurement[,tag=value] value=1.5 1585161000000000000
+// Tags are sorted by key. Aggregations and users have no equivalent and are dropped, as are NaN and infinite
+// values which the line protocol doesn't accept.
+type InfluxEncoder struct{}
+
+func (InfluxEncoder) Encode(m Metric) string {
+	if math.IsNaN(m.Value) || math.IsInf(m.Value, 0) {
+		return ""
+	}
+
+	var b strings.Builder
+
+	b.WriteString(influxMeasurementEscaper.Replace(m.Name))
+	for _, k := range sortedKeys(m.Tags) {
+		if k == "" || m.Tags[k] == "" {
+			// empty tag keys and values are invalid in the line protocol
+			continue
+		}
+		b.WriteByte(',')
+		b.WriteString(influxTagEscaper.Replace(k))
+		b.WriteByte('=')
+		b.WriteString(influxTagEscaper.Replace(m.Tags[k]))
+	}
+
+	b.WriteString(" value=")
+	b.WriteString(strconv.FormatFloat(m.Value, 'f', -1, 64))
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(m.Timestamp*1000000000, 10))
+
+	return b.String()
+}
+
+var (
+	graphitePathEscaper     = strings.NewReplacer(" ", "_", "\t", "_", "\n", "_", ";", "_")
+	graphiteTagNameEscaper  = strings.NewReplacer(" ", "_", "\t", "_", "\n", "_", ";", "_", "!", "_", "^", "_", "=", "_", "~", "_")
+	graphiteTagValueEscaper = strings.NewReplacer(" ", "_", "\t", "_", "\n", "_", ";", "_", "~", "_")
+)
+
+// GraphiteEncoder encodes metrics in the Graphite plaintext protocol with Graphite 1.1 tags:
+// path[;tag=value] value timestamp
+// Characters not allowed in paths, tag names or tag values, like spaces and semicolons, are replaced by underscores.
+// With DisableTags the tags are dropped for backends without tag support.
+// Aggregations and users have no equivalent and are dropped.
+type GraphiteEncoder struct {
+	DisableTags bool
+}
+
+func (g GraphiteEncoder) Encode(m Metric) string {
+	var b strings.Builder
+
+	b.WriteString(graphitePathEscaper.Replace(m.Name))
+	if !g.DisableTags {
+		for _, k := range sortedKeys(m.Tags) {
+			if k == "" || m.Tags[k] == "" {
+				continue
+			}
+			b.WriteByte(';')
+			b.WriteString(graphiteTagNameEscaper.Replace(k))
+			b.WriteByte('=')
+			b.WriteString(graphiteTagValueEscaper.Replace(m.Tags[k]))
+		}
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatFloat(m.Value, 'f', -1, 64))
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatInt(m.Timestamp, 10))
+
+	return b.String()
+}
+
+// encoderFor returns the encoder requested by the sender, falling back to the configured one
+// and finally to StatfulEncoder.
+func encoderFor(sender Sender, configured Encoder) Encoder {
+	if s, ok := sender.(EncoderSender); ok {
+		if encoder := s.Encoder(); encoder != nil {
+			return encoder
+		}
+	}
+
+	if configured != nil {
+		return configured
+	}
+
+	return StatfulEncoder{}
+}
+
+func sortedKeys(tags Tags) []string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,277 @@
+package statful
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEncoders(t *testing.T) {
+	metric := Metric{
+		Name:         "http.requests",
+		Value:        1.5,
+		Tags:         Tags{"status": "200", "path": "/a b,c=d;e~f"},
+		Timestamp:    1585161000,
+		Aggregations: Aggregations{AggCount: nothing},
+		Frequency:    Freq10s,
+	}
+
+	scenarios := []struct {
+		description string
+		encoder     Encoder
+		metric      Metric
+		expected    string
+	}{
+		{
+			description: "statful",
+			encoder:     StatfulEncoder{},
+			metric:      Metric{Name: "http.requests", Value: 1.5, Tags: Tags{"status": "200"}, Timestamp: 1585161000, Aggregations: Aggregations{AggCount: nothing}, Frequency: Freq10s},
+			expected:    "http.requests,status=200 1.500000 1585161000 count,10",
+		},
+		{
+			description: "influx with escaped tags",
+			encoder:     InfluxEncoder{},
+			metric:      metric,
+			expected:    `http.requests,path=/a\ b\,c\=d;e~f,status=200 value=1.5 1585161000000000000`,
+		},
+		{
+			description: "influx with escaped measurement and empty tag",
+			encoder:     InfluxEncoder{},
+			metric:      Metric{Name: "disk usage,sda", Value: 1e21, Tags: Tags{"empty": ""}, Timestamp: 1},
+			expected:    `disk\ usage\,sda value=1000000000000000000000 1000000000`,
+		},
+		{
+			description: "influx with escaped backslashes",
+			encoder:     InfluxEncoder{},
+			metric:      Metric{Name: `c:\disk`, Value: 1, Tags: Tags{`path`: `c:\temp\`}, Timestamp: 1},
+			expected:    `c:\\disk,path=c:\\temp\\ value=1 1000000000`,
+		},
+		{
+			description: "influx drops NaN",
+			encoder:     InfluxEncoder{},
+			metric:      Metric{Name: "m", Value: math.NaN(), Timestamp: 1},
+			expected:    "",
+		},
+		{
+			description: "influx drops infinite values",
+			encoder:     InfluxEncoder{},
+			metric:      Metric{Name: "m", Value: math.Inf(-1), Timestamp: 1},
+			expected:    "",
+		},
+		{
+			description: "graphite with escaped tags",
+			encoder:     GraphiteEncoder{},
+			metric:      metric,
+			expected:    "http.requests;path=/a_b,c=d_e_f;status=200 1.5 1585161000",
+		},
+		{
+			description: "graphite without tags",
+			encoder:     GraphiteEncoder{DisableTags: true},
+			metric:      Metric{Name: "disk usage;sda", Value: -2, Tags: Tags{"status": "200"}, Timestamp: 1585161000},
+			expected:    "disk_usage_sda -2 1585161000",
+		},
+		{
+			description: "graphite escaped tag name",
+			encoder:     GraphiteEncoder{},
+			metric:      Metric{Name: "m", Value: 1, Tags: Tags{"a=b!c": "x"}, Timestamp: 1},
+			expected:    "m;a_b_c=x 1 1",
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			if line := s.encoder.Encode(s.metric); line != s.expected {
+				t.Errorf("Encode() returned: %s, expected: %s", line, s.expected)
+			}
+		})
+	}
+}
+
+type encodingChannelSender struct {
+	ChannelSender
+	encoder Encoder
+}
+
+func (e *encodingChannelSender) Encoder() Encoder {
+	return e.encoder
+}
+
+func TestBuffer_Encoder(t *testing.T) {
+	scenarios := []struct {
+		description string
+		sender      func(chan<- []byte) Sender
+		configured  Encoder
+		expected    string
+	}{
+		{
+			description: "defaults to statful",
+			sender: func(data chan<- []byte) Sender {
+				return &ChannelSender{data: data}
+			},
+			expected: "test.metric,env=prod 1.000000 1585161000",
+		},
+		{
+			description: "uses the configured encoder",
+			sender: func(data chan<- []byte) Sender {
+				return &ChannelSender{data: data}
+			},
+			configured: GraphiteEncoder{},
+			expected:   "test.metric;env=prod 1 1585161000",
+		},
+		{
+			description: "sender encoder takes precedence",
+			sender: func(data chan<- []byte) Sender {
+				return &encodingChannelSender{ChannelSender: ChannelSender{data: data}, encoder: InfluxEncoder{}}
+			},
+			configured: GraphiteEncoder{},
+			expected:   "test.metric,env=prod value=1 1585161000000000000",
+		},
+		{
+			description: "sender without encoder uses the configured one",
+			sender: func(data chan<- []byte) Sender {
+				return &encodingChannelSender{ChannelSender: ChannelSender{data: data}}
+			},
+			configured: GraphiteEncoder{DisableTags: true},
+			expected:   "test.metric 1 1585161000",
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			data := make(chan []byte, 1)
+			client := New(Configuration{
+				DisableAutoFlush: true,
+				Sender:           s.sender(data),
+				Encoder:          s.configured,
+				Logger:           fmtLogger(fmt.Println),
+			})
+
+			_ = client.Put("test.metric", 1, Tags{"env": "prod"}, 1585161000, nil, 0)
+			if err := client.FlushError(); err != nil {
+				t.Fatal(err)
+			}
+
+			if payload := string(<-data); payload != s.expected {
+				t.Errorf("sent: %s, expected: %s", payload, s.expected)
+			}
+		})
+	}
+}
+
+type encodingRecordingSender struct {
+	recordingSender
+	encoder Encoder
+}
+
+func (e *encodingRecordingSender) Encoder() Encoder {
+	return e.encoder
+}
+
+func TestBuffer_EncoderPerSender(t *testing.T) {
+	influx := &encodingRecordingSender{encoder: InfluxEncoder{}}
+	graphite := &encodingRecordingSender{encoder: GraphiteEncoder{}}
+	statful := &encodingRecordingSender{encoder: StatfulEncoder{}}
+	configured := &recordingSender{}
+	failing := &encodingRecordingSender{recordingSender: recordingSender{err: errors.New("boom")}, encoder: InfluxEncoder{}}
+
+	client := New(Configuration{
+		DisableAutoFlush: true,
+		Encoder:          GraphiteEncoder{DisableTags: true},
+		Sender: &MultiSender{Senders: []Sender{
+			&CircuitBreakerSender{Sender: influx},
+			graphite,
+			statful,
+			&FailoverSender{Senders: []Sender{failing, configured}},
+		}},
+		Logger: fmtLogger(fmt.Println),
+	})
+
+	_ = client.Put("test.metric", 1, Tags{"env": "prod"}, 1585161000, nil, 0)
+	_ = client.PutAggregated("test.metric", math.NaN(), Tags{"env": "prod"}, 1585161000, AggAvg, Freq10s)
+	_ = client.PutAggregated("test.metric", 2, Tags{"env": "prod"}, 1585161000, AggAvg, Freq10s)
+	if err := client.FlushError(); err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []struct {
+		description string
+		sender      *recordingSender
+		expected    []string
+	}{
+		{
+			description: "influx behind a circuit breaker",
+			sender:      &influx.recordingSender,
+			expected:    []string{"test.metric,env=prod value=1 1585161000000000000", "test.metric,env=prod value=2 1585161000000000000"},
+		},
+		{
+			description: "graphite",
+			sender:      &graphite.recordingSender,
+			expected:    []string{"test.metric;env=prod 1 1585161000", "test.metric;env=prod NaN 1585161000\ntest.metric;env=prod 2 1585161000"},
+		},
+		{
+			description: "statful",
+			sender:      &statful.recordingSender,
+			expected:    []string{"test.metric,env=prod 1.000000 1585161000", "test.metric,env=prod NaN 1585161000\ntest.metric,env=prod 2.000000 1585161000"},
+		},
+		{
+			description: "failed over influx sender",
+			sender:      &failing.recordingSender,
+			expected:    []string{"test.metric,env=prod value=1 1585161000000000000", "test.metric,env=prod value=2 1585161000000000000"},
+		},
+		{
+			description: "configured encoder after a failover",
+			sender:      configured,
+			expected:    []string{"test.metric 1 1585161000", "test.metric NaN 1585161000\ntest.metric 2 1585161000"},
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			if !reflect.DeepEqual(s.sender.payloads, s.expected) {
+				t.Errorf("sent: %q, expected: %q", s.sender.payloads, s.expected)
+			}
+		})
+	}
+}
+
+func TestClient_EncoderStatfulSenders(t *testing.T) {
+	data := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		data <- body
+	}))
+	defer srv.Close()
+
+	client := New(Configuration{
+		DisableAutoFlush: true,
+		Encoder:          InfluxEncoder{},
+		Sender:           &HttpSender{Http: &http.Client{Timeout: time.Second}, Url: srv.URL, NoCompression: true},
+		Logger:           fmtLogger(fmt.Println),
+	})
+
+	_ = client.Put("test.metric", 1, Tags{"env": "prod"}, 1585161000, nil, 0)
+	if err := client.FlushError(); err != nil {
+		t.Fatal(err)
+	}
+
+	if payload, expected := string(<-data), "test.metric,env=prod 1.000000 1585161000"; payload != expected {
+		t.Errorf("sent: %s, expected: %s", payload, expected)
+	}
+}
+
+var (
+	_ EncoderSender = &HttpSender{}
+	_ EncoderSender = &StatsDSender{}
+	_ EncoderSender = &OtlpSender{}
+	_ EncoderSender = &WriterSender{}
+	_ EncoderSender = &FileSender{}
+	_ EncoderSender = &TcpSender{}
+	_ EncoderSender = &UdpSender{}
+	_ EncoderSender = &UnixSender{}
+)
@@ -22,7 +22,16 @@ func (f FlushErr) Error() string {
 	return fmt.Sprintf("%s: %s", flushErrors, strings.Join(errStrs, flushErrorsSep))
 }
 
+// Errors returns the individual errors that caused the flush to fail.
+func (f FlushErr) Errors() []error {
+	return f.errors
+}
+
 func (f FlushErr) appendErr(err error) FlushErr {
+	if nested, ok := err.(FlushErr); ok {
+		f.errors = append(f.errors, nested.errors...)
+		return f
+	}
 	f.errors = append(f.errors, err)
 	return f
 }
@@ -30,3 +39,17 @@ func (f FlushErr) appendErr(err error) FlushErr {
 func (f FlushErr) hasErrors() bool {
 	return len(f.errors) > 0
 }
+
+// SenderErr identifies which of the senders wrapped by a MultiSender failed.
+type SenderErr struct {
+	Index int
+	Err   error
+}
+
+func (s SenderErr) Error() string {
+	return fmt.Sprintf("sender %d: %v", s.Index, s.Err)
+}
+
+func (s SenderErr) Unwrap() error {
+	return s.Err
+}
@@ -25,3 +25,22 @@ func TestFlushErr_Error(t *testing.T) {
 		t.Errorf("Error() returned: %s, expected: %s", flushErrStr, expectedErrStr)
 	}
 }
+
+func TestFlushErr_AppendFlushErr(t *testing.T) {
+	var nested FlushErr
+	nested = nested.appendErr(SenderErr{Index: 0, Err: errors.New("err 1")})
+	nested = nested.appendErr(SenderErr{Index: 2, Err: errors.New("err 2")})
+
+	var flushErr FlushErr
+	flushErr = flushErr.appendErr(errors.New("err 0"))
+	flushErr = flushErr.appendErr(nested)
+
+	if len(flushErr.Errors()) != 3 {
+		t.Errorf("Errors() returned: %v, expected 3 errors", flushErr.Errors())
+	}
+
+	expectedErrStr := fmt.Sprintf("%s: err 0%ssender 0: err 1%ssender 2: err 2", flushErrors, flushErrorsSep, flushErrorsSep)
+	if flushErr.Error() != expectedErrStr {
+		t.Errorf("Error() returned: %s, expected: %s", flushErr.Error(), expectedErrStr)
+	}
+}
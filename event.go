@@ -1,5 +1,9 @@
 package statful
 
+import (
+	"context"
+)
+
 type Amount struct {
 	Value    int    `json:"value"`
 	Currency string `json:"currency"`
@@ -33,3 +37,8 @@ func (c *Client) Event(event Event) {
 func (c *Client) FlushEvents() error {
 	return c.eventBuffer.Flush()
 }
+
+// Send all events in event buffer, cancelling the send when ctx is done.
+func (c *Client) FlushEventsContext(ctx context.Context) error {
+	return c.eventBuffer.FlushContext(ctx)
+}
@@ -1,8 +1,7 @@
 package statful
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"sync"
 )
 
@@ -12,9 +11,13 @@ type eventBuffer struct {
 	eventCount int
 	flushSize  int
 	mu         sync.Mutex
+	// flushing tracks the flushes of the events drained for the current sender, see buffer.flushing.
+	flushing *sync.WaitGroup
 
-	Logger Logger
-	Sender Sender
+	Logger     Logger
+	Sender     Sender
+	Serializer EventSerializer
+	Stats      *Stats
 }
 
 func (e *eventBuffer) Event(event Event) {
@@ -27,30 +30,45 @@ func (e *eventBuffer) Event(event Event) {
 }
 
 func (e *eventBuffer) Flush() error {
+	return e.FlushContext(context.Background())
+}
+
+func (e *eventBuffer) FlushContext(ctx context.Context) error {
 	e.mu.Lock()
 
 	events := e.drainBuffers()
+	sender, dryRun, flushing := e.Sender, e.dryRun, e.flushingGroup()
+	flushing.Add(1)
 
 	e.mu.Unlock()
 
-	return e.flushBuffers(events)
+	defer flushing.Done()
+	return e.flushBuffers(ctx, events, sender, dryRun)
 }
 
-func (e *eventBuffer) flushBuffers(buffer []Event) error {
+func (e *eventBuffer) flushingGroup() *sync.WaitGroup {
+	if e.flushing == nil {
+		e.flushing = &sync.WaitGroup{}
+	}
+
+	return e.flushing
+}
+
+func (e *eventBuffer) flushBuffers(ctx context.Context, buffer []Event, sender Sender, dryRun bool) error {
 	if len(buffer) > 0 {
-		if e.dryRun {
+		logger := structuredLoggerFor(e.Logger)
+		if dryRun {
 			for _, event := range buffer {
-				e.Logger.Println("Dry event: ", event)
+				logLegacy(logger, []interface{}{"Dry event: ", event}, LevelInfo, "Dry event: ", "event", event)
 			}
 		} else {
-			events, err := json.Marshal(buffer)
-			if err != nil {
-				return err
-			}
-			err = e.Sender.SendEvents(bytes.NewBuffer(events))
+			err := sendEventBatchContext(contextWithStats(ctx, e.Stats), sender, eventBatch{events: buffer, serializer: e.Serializer})
+			e.Stats.eventsFlushed(len(buffer), err)
 			if err != nil {
+				logger.Log(LevelError, "Failed to send events", "error", err, "dropped", len(buffer))
 				return err
 			}
+			logger.Log(LevelDebug, "Flushed events", "count", len(buffer))
 		}
 	}
 	return nil
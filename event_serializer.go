@@ -0,0 +1,164 @@
+package statful
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+)
+
+const (
+	EventEnvelopeVersion = 1
+)
+
+// EventSerializer encodes a batch of events into the payload handed to Sender.SendEvents.
+type EventSerializer interface {
+	Serialize(w io.Writer, events []Event) error
+}
+
+// ContentTypeSerializer is implemented by serializers that know the media type of their payload, used for the
+// Content-Type header of HttpSender. The payloads of other serializers are sent as application/json.
+type ContentTypeSerializer interface {
+	ContentType() string
+}
+
+// EventSerializerSender is implemented by senders that need events in a specific format.
+// A non nil serializer returned by the sender takes precedence over Configuration.EventSerializer.
+type EventSerializerSender interface {
+	EventSerializer() EventSerializer
+}
+
+// JsonArraySerializer encodes events as a single JSON array, the format expected by the insights endpoint.
+type JsonArraySerializer struct{}
+
+func (JsonArraySerializer) ContentType() string {
+	return jsonEncoding
+}
+
+func (JsonArraySerializer) Serialize(w io.Writer, events []Event) error {
+	data, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// NdjsonSerializer encodes events as newline delimited JSON, one event per line.
+type NdjsonSerializer struct{}
+
+func (NdjsonSerializer) ContentType() string {
+	return ndjsonEncoding
+}
+
+func (NdjsonSerializer) Serialize(w io.Writer, events []Event) error {
+	enc := json.NewEncoder(w)
+	for _, event := range events {
+		if err := enc.Encode(event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// EnvelopeSerializer wraps events in a compact envelope carrying the schema version and the event count:
+// {"v":1,"n":2,"events":[...]}
+// A zero Version defaults to EventEnvelopeVersion.
+type EnvelopeSerializer struct {
+	Version int
+}
+
+type eventEnvelope struct {
+	Version int     `json:"v"`
+	Count   int     `json:"n"`
+	Events  []Event `json:"events"`
+}
+
+func (EnvelopeSerializer) ContentType() string {
+	return jsonEncoding
+}
+
+func (e EnvelopeSerializer) Serialize(w io.Writer, events []Event) error {
+	version := e.Version
+	if version == 0 {
+		version = EventEnvelopeVersion
+	}
+
+	if events == nil {
+		events = []Event{}
+	}
+
+	data, err := json.Marshal(eventEnvelope{Version: version, Count: len(events), Events: events})
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// eventSerializerFor returns the serializer requested by the sender, falling back to the configured one
+// and finally to JsonArraySerializer.
+func eventSerializerFor(sender Sender, configured EventSerializer) EventSerializer {
+	if s, ok := sender.(EventSerializerSender); ok {
+		if serializer := s.EventSerializer(); serializer != nil {
+			return serializer
+		}
+	}
+
+	if configured != nil {
+		return configured
+	}
+
+	return JsonArraySerializer{}
+}
+
+// contentTypeOf returns the media type of the payloads of serializer.
+func contentTypeOf(serializer EventSerializer) string {
+	if s, ok := serializer.(ContentTypeSerializer); ok {
+		return s.ContentType()
+	}
+
+	return jsonEncoding
+}
+
+// eventsSender is implemented by the senders wrapping other senders, so the buffered events are serialized
+// for each wrapped sender with its own serializer, and by the senders that depend on the serializer used.
+type eventsSender interface {
+	sendEvents(ctx context.Context, b eventBatch) error
+}
+
+// eventBatch holds buffered events until the destination sender is known, serializer is the configured one.
+type eventBatch struct {
+	events     []Event
+	serializer EventSerializer
+}
+
+// serialize serializes the events for sender and returns the payload along with the serializer used.
+func (b eventBatch) serialize(sender Sender) (*bytes.Buffer, EventSerializer, error) {
+	serializer := eventSerializerFor(sender, b.serializer)
+
+	var data bytes.Buffer
+	if err := serializer.Serialize(&data, b.events); err != nil {
+		return nil, nil, err
+	}
+
+	return &data, serializer, nil
+}
+
+// sendEventBatchContext serializes the batch for sender and sends it, wrapping senders forward the batch to
+// the senders they wrap.
+func sendEventBatchContext(ctx context.Context, sender Sender, b eventBatch) error {
+	if es, ok := sender.(eventsSender); ok {
+		return es.sendEvents(ctx, b)
+	}
+
+	data, _, err := b.serialize(sender)
+	if err != nil {
+		return err
+	}
+
+	return sendEventsContext(ctx, sender, data)
+}
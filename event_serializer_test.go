@@ -0,0 +1,221 @@
+package statful
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEventSerializers(t *testing.T) {
+	scenarios := []struct {
+		description string
+		serializer  EventSerializer
+		events      []Event
+		expected    string
+	}{
+		{
+			description: "json array with a single event",
+			serializer:  JsonArraySerializer{},
+			events:      []Event{expectedEvent},
+			expected:    expectedJson,
+		},
+		{
+			description: "ndjson with two events",
+			serializer:  NdjsonSerializer{},
+			events:      []Event{expectedEvent, expectedEvent},
+			expected:    strings.Trim(expectedJson, "[]") + "\n" + strings.Trim(expectedJson, "[]") + "\n",
+		},
+		{
+			description: "ndjson without events",
+			serializer:  NdjsonSerializer{},
+			events:      []Event{},
+			expected:    "",
+		},
+		{
+			description: "envelope with default version",
+			serializer:  EnvelopeSerializer{},
+			events:      []Event{expectedEvent},
+			expected:    `{"v":1,"n":1,"events":` + expectedJson + `}`,
+		},
+		{
+			description: "envelope with explicit version and no events",
+			serializer:  EnvelopeSerializer{Version: 3},
+			events:      nil,
+			expected:    `{"v":3,"n":0,"events":[]}`,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := s.serializer.Serialize(&b, s.events); err != nil {
+				t.Fatalf("Serialize() returned error: %v", err)
+			}
+
+			if b.String() != s.expected {
+				t.Errorf("Serialize() returned: %s, expected: %s", b.String(), s.expected)
+			}
+		})
+	}
+}
+
+type serializingChannelSender struct {
+	ChannelSender
+	serializer EventSerializer
+}
+
+func (s *serializingChannelSender) EventSerializer() EventSerializer {
+	return s.serializer
+}
+
+func TestEventBuffer_Serializer(t *testing.T) {
+	scenarios := []struct {
+		description string
+		sender      func(chan<- []byte) Sender
+		configured  EventSerializer
+		expected    string
+	}{
+		{
+			description: "defaults to json array",
+			sender: func(data chan<- []byte) Sender {
+				return &ChannelSender{data: data}
+			},
+			expected: expectedJson,
+		},
+		{
+			description: "uses the configured serializer",
+			sender: func(data chan<- []byte) Sender {
+				return &ChannelSender{data: data}
+			},
+			configured: NdjsonSerializer{},
+			expected:   strings.Trim(expectedJson, "[]") + "\n",
+		},
+		{
+			description: "sender serializer takes precedence",
+			sender: func(data chan<- []byte) Sender {
+				return &serializingChannelSender{ChannelSender: ChannelSender{data: data}, serializer: EnvelopeSerializer{}}
+			},
+			configured: NdjsonSerializer{},
+			expected:   `{"v":1,"n":1,"events":` + expectedJson + `}`,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			data := make(chan []byte, 1)
+
+			testBuffer := eventBuffer{
+				buffer:     []Event{},
+				mu:         sync.Mutex{},
+				Sender:     s.sender(data),
+				Serializer: s.configured,
+			}
+
+			testBuffer.Event(expectedEvent)
+			if err := testBuffer.Flush(); err != nil {
+				t.Fatalf("Error returned sending event: %s ", err)
+			}
+
+			payload := <-data
+			if string(payload) != s.expected {
+				t.Errorf("Sent payload: %s, expected: %s", payload, s.expected)
+			}
+
+			if !json.Valid(bytes.Split(payload, []byte("\n"))[0]) {
+				t.Errorf("Sent payload is not valid json: %s", payload)
+			}
+		})
+	}
+}
+
+func TestHttpSender_EventSerializer(t *testing.T) {
+	ndjson := strings.Trim(expectedJson, "[]") + "\n"
+	envelope := `{"v":1,"n":1,"events":` + expectedJson + `}`
+
+	scenarios := []struct {
+		description         string
+		configured          EventSerializer
+		sender              func(url string) Sender
+		expectedContentType string
+		expectedBody        string
+	}{
+		{
+			description: "sender serializer takes precedence",
+			configured:  EnvelopeSerializer{},
+			sender: func(url string) Sender {
+				return &HttpSender{Url: url, Token: apiToken, Serializer: NdjsonSerializer{}}
+			},
+			expectedContentType: ndjsonEncoding,
+			expectedBody:        ndjson,
+		},
+		{
+			description: "pointer serializer",
+			sender: func(url string) Sender {
+				return &HttpSender{Url: url, Token: apiToken, Serializer: &NdjsonSerializer{}}
+			},
+			expectedContentType: ndjsonEncoding,
+			expectedBody:        ndjson,
+		},
+		{
+			description: "configured serializer",
+			configured:  NdjsonSerializer{},
+			sender: func(url string) Sender {
+				return &HttpSender{Url: url, Token: apiToken}
+			},
+			expectedContentType: ndjsonEncoding,
+			expectedBody:        ndjson,
+		},
+		{
+			description: "configured serializer through a wrapping sender",
+			configured:  NdjsonSerializer{},
+			sender: func(url string) Sender {
+				return &MultiSender{Senders: []Sender{&CircuitBreakerSender{Sender: &HttpSender{Url: url, Token: apiToken}}}}
+			},
+			expectedContentType: ndjsonEncoding,
+			expectedBody:        ndjson,
+		},
+		{
+			description: "envelope",
+			configured:  EnvelopeSerializer{},
+			sender: func(url string) Sender {
+				return &HttpSender{Url: url, Token: apiToken}
+			},
+			expectedContentType: jsonEncoding,
+			expectedBody:        envelope,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			var contentType, body string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contentType = r.Header.Get("Content-Type")
+				all, _ := ioutil.ReadAll(r.Body)
+				body = string(all)
+			}))
+			defer srv.Close()
+
+			client := New(Configuration{
+				DisableAutoFlush: true,
+				EventSerializer:  s.configured,
+				Sender:           s.sender(srv.URL),
+			})
+			client.Event(expectedEvent)
+			if err := client.FlushEvents(); err != nil {
+				t.Fatalf("Error returned sending event: %s ", err)
+			}
+
+			if contentType != s.expectedContentType {
+				t.Errorf("Sent content type: %s, expected: %s", contentType, s.expectedContentType)
+			}
+			if body != s.expectedBody {
+				t.Errorf("Sent payload: %s, expected: %s", body, s.expectedBody)
+			}
+		})
+	}
+}
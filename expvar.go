@@ -0,0 +1,176 @@
+package statful
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultExpvarInterval = 10 * time.Second
+)
+
+var ErrExpvarExists = errors.New("expvar name already published")
+
+// ExpvarCollector periodically walks the vars published with the expvar package and reports their numeric values,
+// including the ones nested in maps like memstats, as gauges named after their path joined with dots.
+// Names are prefixed by Prefix followed by a dot when set. Vars limits the walk to the listed top level vars,
+// by default every var is reported. Whitespace, commas and equal signs in the keys are replaced by underscores.
+// Arrays, strings and booleans are ignored.
+type ExpvarCollector struct {
+	Client   *Client
+	Interval time.Duration
+	Prefix   string
+	Vars     []string
+	Tags     Tags
+
+	Logger Logger
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Start collects the vars every Interval until Stop is called.
+func (e *ExpvarCollector) Start() {
+	interval := e.Interval
+	if interval <= 0 {
+		interval = DefaultExpvarInterval
+	}
+
+	e.stop = make(chan struct{})
+	e.done = make(chan struct{})
+
+	go func() {
+		defer close(e.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			e.Collect()
+
+			select {
+			case <-ticker.C:
+			case <-e.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the collection started by Start.
+func (e *ExpvarCollector) Stop() {
+	if e.stop != nil {
+		close(e.stop)
+		<-e.done
+		e.stop = nil
+	}
+}
+
+// Collect reports the current value of the vars once.
+func (e *ExpvarCollector) Collect() {
+	include := map[string]bool{}
+	for _, name := range e.Vars {
+		include[name] = true
+	}
+
+	expvar.Do(func(kv expvar.KeyValue) {
+		if len(include) > 0 && !include[kv.Key] {
+			return
+		}
+
+		dec := json.NewDecoder(strings.NewReader(kv.Value.String()))
+		dec.UseNumber()
+
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			structuredLoggerFor(e.Logger).Log(LevelWarn, "Failed to decode expvar", "var", kv.Key, "error", err)
+			return
+		}
+
+		name := sanitizeName(kv.Key)
+		if e.Prefix != "" {
+			name = e.Prefix + "." + name
+		}
+		e.walk(name, value)
+	})
+}
+
+func (e *ExpvarCollector) walk(name string, value interface{}) {
+	switch v := value.(type) {
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			e.Client.Gauge(name, f, e.Tags)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			e.walk(name+"."+sanitizeName(k), v[k])
+		}
+	}
+}
+
+// expvarPublishMu serializes the check and the publication of PublishExpvar, expvar.Publish panics on an existing name.
+var expvarPublishMu sync.Mutex
+
+// expvarClient is the var published by PublishExpvar.
+type expvarClient struct {
+	Stats      Stats
+	Sender     string
+	Observers  []string
+	Processors []string
+}
+
+// PublishExpvar publishes the client Stats along with the types of its sender and registered observers and
+// processors under name, to be served by the expvar handler on /debug/vars.
+// It returns ErrExpvarExists when a var with the same name was already published.
+func (c *Client) PublishExpvar(name string) (err error) {
+	expvarPublishMu.Lock()
+	defer expvarPublishMu.Unlock()
+
+	if expvar.Get(name) != nil {
+		return ErrExpvarExists
+	}
+
+	defer func() {
+		// published concurrently without PublishExpvar
+		if recover() != nil {
+			err = ErrExpvarExists
+		}
+	}()
+
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return c.expvar()
+	}))
+
+	return nil
+}
+
+func (c *Client) expvar() expvarClient {
+	published := expvarClient{Stats: c.Stats(), Observers: []string{}, Processors: []string{}}
+
+	c.mu.RLock()
+	for _, o := range c.observers {
+		published.Observers = append(published.Observers, fmt.Sprintf("%T", o))
+	}
+	for _, p := range c.processors {
+		published.Processors = append(published.Processors, fmt.Sprintf("%T", p))
+	}
+	c.mu.RUnlock()
+
+	c.buffer.mu.Lock()
+	published.Sender = fmt.Sprintf("%T", c.buffer.Sender)
+	c.buffer.mu.Unlock()
+
+	return published
+}
@@ -0,0 +1,115 @@
+package statful
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestExpvarCollector_Collect(t *testing.T) {
+	requests := expvar.NewMap("statful_test_requests")
+	requests.Add("ok", 3)
+	requests.AddFloat("latency", 0.5)
+	requests.Add("GET /a,b=c", 1)
+	expvar.Publish("statful_test_nested", expvar.Func(func() interface{} {
+		return map[string]interface{}{
+			"pool":    map[string]interface{}{"idle": 2, "busy": 1},
+			"name":    "db",
+			"enabled": true,
+			"history": []int{1, 2, 3},
+		}
+	}))
+
+	sender := &recordingSender{}
+	client := New(Configuration{DisableAutoFlush: true, Sender: sender, Logger: fmtLogger(fmt.Println)})
+	collector := &ExpvarCollector{
+		Client: client,
+		Prefix: "app",
+		Vars:   []string{"statful_test_requests", "statful_test_nested"},
+		Tags:   Tags{"host": "a"},
+	}
+
+	collector.Collect()
+	if err := client.FlushError(); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, err := MetricParser{}.ParseMetrics(strings.NewReader(strings.Join(sender.payloads, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gauges []string
+	for _, m := range metrics {
+		if _, ok := m.Aggregations[AggLast]; !ok || m.Tags["host"] != "a" {
+			t.Errorf("not a gauge with the collector tags: %+v", m)
+		}
+		gauges = append(gauges, fmt.Sprintf("%s=%v", m.Name, m.Value))
+	}
+	sort.Strings(gauges)
+
+	expected := "app.statful_test_nested.pool.busy=1 app.statful_test_nested.pool.idle=2 app.statful_test_requests.GET_/a_b_c=1 app.statful_test_requests.latency=0.5 app.statful_test_requests.ok=3"
+	if strings.Join(gauges, " ") != expected {
+		t.Errorf("collected: %v, expected: %s", gauges, expected)
+	}
+}
+
+func TestClient_PublishExpvar(t *testing.T) {
+	client := New(Configuration{
+		DisableAutoFlush: true,
+		Sender:           &recordingSender{},
+		Observers:        []MetricObserver{&PrometheusHandler{}},
+		Processors:       []Processor{AddTags{Tags: Tags{"team": "platform"}}},
+	})
+	_ = client.Put("test.metric", 1, nil, 0, nil, 0)
+
+	if err := client.PublishExpvar("statful_test_stats"); err != nil {
+		t.Fatalf("PublishExpvar() returned error: %v", err)
+	}
+	if err := client.PublishExpvar("statful_test_stats"); err != ErrExpvarExists {
+		t.Errorf("PublishExpvar() of an existing name returned: %v", err)
+	}
+
+	var published expvarClient
+	if err := json.Unmarshal([]byte(expvar.Get("statful_test_stats").String()), &published); err != nil {
+		t.Fatal(err)
+	}
+	expected := expvarClient{
+		Stats:      Stats{MetricsPut: 1},
+		Sender:     "*statful.recordingSender",
+		Observers:  []string{"*statful.PrometheusHandler"},
+		Processors: []string{"statful.AddTags"},
+	}
+	if !reflect.DeepEqual(published, expected) {
+		t.Errorf("published: %+v, expected: %+v", published, expected)
+	}
+}
+
+func TestClient_PublishExpvar_Concurrent(t *testing.T) {
+	client := New(Configuration{DisableAutoFlush: true, Sender: &recordingSender{}})
+
+	errs := make(chan error, 10)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			errs <- client.PublishExpvar("statful_test_concurrent")
+		}()
+	}
+
+	published := 0
+	for i := 0; i < cap(errs); i++ {
+		switch err := <-errs; err {
+		case nil:
+			published++
+		case ErrExpvarExists:
+		default:
+			t.Errorf("PublishExpvar() returned error: %v", err)
+		}
+	}
+	if published != 1 {
+		t.Errorf("published %d times, expected once", published)
+	}
+}
@@ -0,0 +1,232 @@
+package statful
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultFailureThreshold = 3
+	DefaultFailoverCooldown = 30 * time.Second
+)
+
+var ErrNoHealthySender = errors.New("no healthy sender available")
+
+// FailoverSender routes every payload to the first healthy sender in Senders order.
+// A sender is marked unhealthy after FailureThreshold consecutive failures and is probed again
+// once Cooldown has elapsed, when the probe succeeds it becomes healthy and active again.
+type FailoverSender struct {
+	Senders          []Sender
+	FailureThreshold int
+	Cooldown         time.Duration
+
+	Logger Logger
+
+	mu     sync.Mutex
+	health []senderHealth
+	now    func() time.Time
+}
+
+type senderHealth struct {
+	failures    int
+	unhealthy   bool
+	unhealthyAt time.Time
+}
+
+func (f *FailoverSender) Send(data io.Reader) error {
+	return f.SendContext(context.Background(), data)
+}
+
+func (f *FailoverSender) SendAggregated(data io.Reader, agg Aggregation, freq AggregationFrequency) error {
+	return f.SendAggregatedContext(context.Background(), data, agg, freq)
+}
+
+func (f *FailoverSender) SendEvents(data io.Reader) error {
+	return f.SendEventsContext(context.Background(), data)
+}
+
+func (f *FailoverSender) SendContext(ctx context.Context, data io.Reader) error {
+	return f.failoverPayload(ctx, data, func(s Sender, r io.Reader) error {
+		return sendContext(ctx, s, r)
+	})
+}
+
+func (f *FailoverSender) SendAggregatedContext(ctx context.Context, data io.Reader, agg Aggregation, freq AggregationFrequency) error {
+	return f.failoverPayload(ctx, data, func(s Sender, r io.Reader) error {
+		return sendAggregatedContext(ctx, s, r, agg, freq)
+	})
+}
+
+func (f *FailoverSender) SendEventsContext(ctx context.Context, data io.Reader) error {
+	return f.failoverPayload(ctx, data, func(s Sender, r io.Reader) error {
+		return sendEventsContext(ctx, s, r)
+	})
+}
+
+// Active returns the sender currently receiving traffic or nil if every sender is unhealthy.
+func (f *FailoverSender) Active() Sender {
+	idx := f.ActiveIndex()
+	if idx < 0 {
+		return nil
+	}
+
+	return f.Senders[idx]
+}
+
+// ActiveIndex returns the index in Senders of the sender currently receiving traffic or -1 if every sender is unhealthy.
+func (f *FailoverSender) ActiveIndex() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.initHealth()
+	for idx := range f.Senders {
+		if !f.health[idx].unhealthy {
+			return idx
+		}
+	}
+
+	return -1
+}
+
+// Healthy reports whether the sender at index idx is currently considered healthy,
+// it returns false for an index out of Senders range.
+func (f *FailoverSender) Healthy(idx int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.initHealth()
+	if idx < 0 || idx >= len(f.health) {
+		return false
+	}
+
+	return !f.health[idx].unhealthy
+}
+
+func (f *FailoverSender) sendMetrics(ctx context.Context, b metricBatch) error {
+	return f.failover(ctx, func(s Sender) error {
+		return sendMetricsContext(ctx, s, b)
+	})
+}
+
+func (f *FailoverSender) sendEvents(ctx context.Context, b eventBatch) error {
+	return f.failover(ctx, func(s Sender) error {
+		return sendEventBatchContext(ctx, s, b)
+	})
+}
+
+// failoverPayload reads data once so it can be sent again to the next sender.
+func (f *FailoverSender) failoverPayload(ctx context.Context, data io.Reader, send func(Sender, io.Reader) error) error {
+	payload, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+
+	return f.failover(ctx, func(s Sender) error {
+		return send(s, bytes.NewReader(payload))
+	})
+}
+
+func (f *FailoverSender) failover(ctx context.Context, send func(Sender) error) error {
+	var flushErr FlushErr
+	for idx, sender := range f.Senders {
+		if !f.available(idx) {
+			continue
+		}
+
+		err := send(sender)
+		if err != nil && ctx.Err() != nil {
+			// cancelled by the caller, not a sender failure
+			return err
+		}
+
+		f.report(idx, err)
+		if err == nil || err == ErrSendBuffered {
+			// buffered data is still sent by this sender, failing over would duplicate it
+			return err
+		}
+
+		flushErr = flushErr.appendErr(SenderErr{Index: idx, Err: err})
+		if idx < len(f.Senders)-1 {
+			structuredLoggerFor(f.Logger).Log(LevelDebug, "Sender failed, retrying with the next sender", "sender", idx, "error", err)
+		}
+	}
+
+	if !flushErr.hasErrors() {
+		return ErrNoHealthySender
+	}
+
+	return flushErr
+}
+
+// available tells if the sender at idx is healthy or its cooldown elapsed and it should be probed.
+func (f *FailoverSender) available(idx int) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.initHealth()
+	h := f.health[idx]
+
+	return !h.unhealthy || f.clock().Sub(h.unhealthyAt) >= f.cooldown()
+}
+
+func (f *FailoverSender) report(idx int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	h := &f.health[idx]
+	if err == nil {
+		if h.unhealthy {
+			structuredLoggerFor(f.Logger).Log(LevelInfo, "Sender recovered, marking it healthy", "sender", idx)
+		}
+		*h = senderHealth{}
+		return
+	}
+
+	h.failures++
+	if h.unhealthy {
+		// failed probe, wait for another cooldown
+		h.unhealthyAt = f.clock()
+		return
+	}
+
+	if h.failures >= f.threshold() {
+		h.unhealthy = true
+		h.unhealthyAt = f.clock()
+		structuredLoggerFor(f.Logger).Log(LevelWarn, "Sender failed, marking it unhealthy", "sender", idx, "failures", h.failures, "error", err)
+	}
+}
+
+func (f *FailoverSender) initHealth() {
+	if len(f.health) != len(f.Senders) {
+		f.health = make([]senderHealth, len(f.Senders))
+	}
+}
+
+func (f *FailoverSender) threshold() int {
+	if f.FailureThreshold <= 0 {
+		return DefaultFailureThreshold
+	}
+
+	return f.FailureThreshold
+}
+
+func (f *FailoverSender) cooldown() time.Duration {
+	if f.Cooldown <= 0 {
+		return DefaultFailoverCooldown
+	}
+
+	return f.Cooldown
+}
+
+func (f *FailoverSender) clock() time.Time {
+	if f.now != nil {
+		return f.now()
+	}
+
+	return time.Now()
+}
@@ -0,0 +1,95 @@
+package statful
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFailoverSender(t *testing.T) {
+	now := time.Unix(1585161000, 0)
+	primary := &recordingSender{err: errors.New("primary down")}
+	backup := &recordingSender{}
+
+	failover := &FailoverSender{
+		Senders:          []Sender{primary, backup},
+		FailureThreshold: 2,
+		Cooldown:         time.Minute,
+		now:              func() time.Time { return now },
+	}
+
+	send := func() error {
+		return failover.Send(bytes.NewBufferString("metric 1 1"))
+	}
+
+	if failover.ActiveIndex() != 0 {
+		t.Fatalf("ActiveIndex() returned: %d, expected: 0", failover.ActiveIndex())
+	}
+
+	// failures below the threshold keep the primary active
+	for i := 0; i < 2; i++ {
+		if err := send(); err != nil {
+			t.Fatalf("Send() returned error: %v", err)
+		}
+	}
+	if len(primary.payloads) != 2 || len(backup.payloads) != 2 {
+		t.Errorf("expected both senders to receive 2 payloads, got primary: %d backup: %d", len(primary.payloads), len(backup.payloads))
+	}
+	if failover.Healthy(0) || failover.Active() != backup {
+		t.Fatal("expected primary to be unhealthy and backup to be active")
+	}
+
+	// unhealthy primary is skipped during the cooldown
+	if err := send(); err != nil {
+		t.Fatalf("Send() returned error: %v", err)
+	}
+	if len(primary.payloads) != 2 || len(backup.payloads) != 3 {
+		t.Errorf("expected primary to be skipped, got primary: %d backup: %d", len(primary.payloads), len(backup.payloads))
+	}
+
+	// failed probe after the cooldown keeps the primary unhealthy
+	now = now.Add(time.Minute)
+	if err := send(); err != nil {
+		t.Fatalf("Send() returned error: %v", err)
+	}
+	if len(primary.payloads) != 3 || failover.Healthy(0) {
+		t.Errorf("expected primary to be probed and stay unhealthy, got %d payloads", len(primary.payloads))
+	}
+
+	// successful probe restores the primary
+	now = now.Add(time.Minute)
+	primary.err = nil
+	if err := send(); err != nil {
+		t.Fatalf("Send() returned error: %v", err)
+	}
+	if !failover.Healthy(0) || failover.ActiveIndex() != 0 {
+		t.Error("expected primary to be healthy and active after a successful probe")
+	}
+	if len(backup.payloads) != 4 {
+		t.Errorf("expected backup to receive 4 payloads, got %d", len(backup.payloads))
+	}
+	if failover.Healthy(-1) || failover.Healthy(2) {
+		t.Error("expected senders out of range to be reported unhealthy")
+	}
+}
+
+func TestFailoverSender_AllUnhealthy(t *testing.T) {
+	failover := &FailoverSender{
+		Senders:          []Sender{&recordingSender{err: errors.New("down")}},
+		FailureThreshold: 1,
+	}
+
+	err := failover.SendEvents(bytes.NewBufferString("[]"))
+	var flushErr FlushErr
+	if !errors.As(err, &flushErr) {
+		t.Fatalf("expected FlushErr, got: %v", err)
+	}
+
+	if err := failover.SendAggregated(bytes.NewBufferString("metric 1 1"), AggAvg, Freq10s); err != ErrNoHealthySender {
+		t.Errorf("expected ErrNoHealthySender, got: %v", err)
+	}
+	if failover.Active() != nil || failover.ActiveIndex() != -1 {
+		t.Error("expected no active sender")
+	}
+}
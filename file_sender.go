@@ -0,0 +1,287 @@
+package statful
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rotatedFileTimeFormat = "20060102T150405.000000000"
+)
+
+// FileSender appends metrics and events to the file at Path in the replayable capture format.
+// The file is rotated once it reaches MaxSize bytes or has been open for RotateInterval, rotated files are renamed
+// with a timestamp suffix, gzipped when Compress is set, and only the newest MaxBackups are kept when it is set.
+type FileSender struct {
+	Path           string
+	MaxSize        int64
+	RotateInterval time.Duration
+	Compress       bool
+	MaxBackups     int
+
+	once   sync.Once
+	file   *rotatingFile
+	sender *WriterSender
+}
+
+func (f *FileSender) Send(data io.Reader) error {
+	return f.writer().Send(data)
+}
+
+func (f *FileSender) SendContext(ctx context.Context, data io.Reader) error {
+	return f.writer().SendContext(ctx, data)
+}
+
+func (f *FileSender) SendAggregated(data io.Reader, agg Aggregation, freq AggregationFrequency) error {
+	return f.writer().SendAggregated(data, agg, freq)
+}
+
+func (f *FileSender) SendAggregatedContext(ctx context.Context, data io.Reader, agg Aggregation, freq AggregationFrequency) error {
+	return f.writer().SendAggregatedContext(ctx, data, agg, freq)
+}
+
+func (f *FileSender) SendEvents(data io.Reader) error {
+	return f.writer().SendEvents(data)
+}
+
+func (f *FileSender) SendEventsContext(ctx context.Context, data io.Reader) error {
+	return f.writer().SendEventsContext(ctx, data)
+}
+
+func (f *FileSender) EventSerializer() EventSerializer {
+	return NdjsonSerializer{}
+}
+
+// Encoder returns StatfulEncoder, the capture format is replayed as Statful lines.
+func (f *FileSender) Encoder() Encoder {
+	return StatfulEncoder{}
+}
+
+// Close closes the current file.
+func (f *FileSender) Close() error {
+	f.writer()
+	return f.file.Close()
+}
+
+func (f *FileSender) writer() *WriterSender {
+	f.once.Do(func() {
+		f.file = &rotatingFile{
+			path:       f.Path,
+			maxSize:    f.MaxSize,
+			interval:   f.RotateInterval,
+			compress:   f.Compress,
+			maxBackups: f.MaxBackups,
+		}
+		f.sender = &WriterSender{Writer: f.file}
+	})
+
+	return f.sender
+}
+
+// rotatingFile is an io.Writer appending to a file that is rotated by size or age.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	interval   time.Duration
+	compress   bool
+	maxBackups int
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+
+	// archiveMu serializes the compression and removal of the rotated files, done outside of mu
+	archiveMu sync.Mutex
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	n, rotated, err := r.write(p)
+	if rotated != "" {
+		if archiveErr := r.archive(rotated); err == nil {
+			err = archiveErr
+		}
+	}
+
+	return n, err
+}
+
+// write writes p to the current file, rotating it first when needed. It returns the path of the rotated file.
+func (r *rotatingFile) write(p []byte) (int, string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var rotated string
+	if r.file != nil && r.shouldRotate(len(p)) {
+		var err error
+		if rotated, err = r.rotate(); err != nil {
+			return 0, "", err
+		}
+	}
+
+	if r.file == nil {
+		if err := r.open(); err != nil {
+			return 0, rotated, err
+		}
+	}
+
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+
+	return n, rotated, err
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return nil
+	}
+
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+func (r *rotatingFile) shouldRotate(size int) bool {
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(size) > r.maxSize {
+		return true
+	}
+
+	return r.interval > 0 && time.Since(r.openedAt) >= r.interval
+}
+
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	r.file = file
+	r.size = info.Size()
+	r.openedAt = time.Now()
+
+	return nil
+}
+
+func (r *rotatingFile) rotate() (string, error) {
+	if err := r.file.Close(); err != nil {
+		return "", err
+	}
+	r.file = nil
+
+	rotated := r.path + "." + time.Now().UTC().Format(rotatedFileTimeFormat)
+	if err := os.Rename(r.path, rotated); err != nil {
+		return "", err
+	}
+
+	return rotated, nil
+}
+
+// archive compresses the rotated file and removes the backups over maxBackups.
+func (r *rotatingFile) archive(rotated string) error {
+	r.archiveMu.Lock()
+	defer r.archiveMu.Unlock()
+
+	if r.compress {
+		if err := gzipFile(rotated); err != nil {
+			return err
+		}
+	}
+
+	return r.removeOldBackups()
+}
+
+func (r *rotatingFile) removeOldBackups() error {
+	if r.maxBackups <= 0 {
+		return nil
+	}
+
+	backups, err := r.backups()
+	if err != nil {
+		return err
+	}
+
+	// the timestamp suffix sorts the backups from oldest to newest
+	sort.Strings(backups)
+	for len(backups) > r.maxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+
+	return nil
+}
+
+// backups lists the rotated files, named after path with a rotation timestamp suffix optionally followed by .gz.
+func (r *rotatingFile) backups() ([]string, error) {
+	files, err := ioutil.ReadDir(filepath.Dir(r.path))
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := filepath.Base(r.path) + "."
+	var backups []string
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+
+		suffix := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".gz")
+		if _, err := time.Parse(rotatedFileTimeFormat, suffix); err != nil {
+			continue
+		}
+		backups = append(backups, filepath.Join(filepath.Dir(r.path), name))
+	}
+
+	return backups, nil
+}
+
+func gzipFile(path string) error {
+	if err := gzipCopy(path, path+".gz"); err != nil {
+		return err
+	}
+
+	return os.Remove(path)
+}
+
+func gzipCopy(srcPath string, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(dstPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	gw := gzip.NewWriter(dst)
+	if _, err := io.Copy(gw, src); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+
+	return dst.Close()
+}
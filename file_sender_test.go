@@ -0,0 +1,86 @@
+package statful
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestFileSender_Rotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statful-file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "metrics.log")
+
+	sender := &FileSender{
+		Path:       path,
+		MaxSize:    40,
+		Compress:   true,
+		MaxBackups: 2,
+	}
+	defer sender.Close()
+
+	// files sharing the path prefix are not backups
+	lock := path + ".lock"
+	if err := ioutil.WriteFile(lock, nil, 0644); err != nil {
+		t.Fatalf("Failed to create lock file: %v", err)
+	}
+
+	lines := []string{
+		"test.demo.metric 1.000000 1585161000",
+		"test.demo.metric 2.000000 1585161001",
+		"test.demo.metric 3.000000 1585161002",
+		"test.demo.metric 4.000000 1585161003",
+	}
+	for _, line := range lines {
+		if err := sender.Send(bytes.NewBufferString(line)); err != nil {
+			t.Fatalf("Send() returned error: %v", err)
+		}
+	}
+
+	current, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read current file: %v", err)
+	}
+	if string(current) != lines[3]+"\n" {
+		t.Errorf("current file: %q, expected: %q", current, lines[3]+"\n")
+	}
+
+	backups, err := filepath.Glob(path + ".*.gz")
+	if err != nil {
+		t.Fatalf("Failed to list backups: %v", err)
+	}
+	sort.Strings(backups)
+	if _, err := os.Stat(lock); err != nil {
+		t.Errorf("expected %s to be kept, got: %v", lock, err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups, got: %v", backups)
+	}
+
+	for idx, backup := range backups {
+		f, err := os.Open(backup)
+		if err != nil {
+			t.Fatalf("Failed to open backup: %v", err)
+		}
+		r, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("Failed to unzip backup: %v", err)
+		}
+		content, err := ioutil.ReadAll(r)
+		_ = f.Close()
+		if err != nil {
+			t.Fatalf("Failed to read backup: %v", err)
+		}
+
+		if string(content) != lines[idx+1]+"\n" {
+			t.Errorf("backup %s: %q, expected: %q", backup, content, lines[idx+1]+"\n")
+		}
+	}
+}
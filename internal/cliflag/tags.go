@@ -0,0 +1,26 @@
+// Package cliflag holds the flag.Value types shared by the statful commands.
+package cliflag
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/statful/statful-client-golang"
+)
+
+// Tags is a flag.Value adding a key=value tag on every Set, for repeatable -tag command line flags.
+type Tags statful.Tags
+
+func (t Tags) String() string {
+	return statful.Tags(t).String()
+}
+
+func (t Tags) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("invalid tag %q, expected key=value", value)
+	}
+	t[kv[0]] = kv[1]
+
+	return nil
+}
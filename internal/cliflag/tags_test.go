@@ -0,0 +1,52 @@
+package cliflag
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/statful/statful-client-golang"
+)
+
+func TestTags_Set(t *testing.T) {
+	scenarios := []struct {
+		description string
+		values      []string
+		expected    statful.Tags
+		err         bool
+	}{
+		{
+			description: "Repeated flags add tags",
+			values:      []string{"env=prod", "host=a=b"},
+			expected:    statful.Tags{"env": "prod", "host": "a=b"},
+		}, {
+			description: "Missing value is an error",
+			values:      []string{"env"},
+			expected:    statful.Tags{},
+			err:         true,
+		}, {
+			description: "Missing key is an error",
+			values:      []string{"=prod"},
+			expected:    statful.Tags{},
+			err:         true,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			tags := Tags{}
+			var err error
+			for _, v := range s.values {
+				if err = tags.Set(v); err != nil {
+					break
+				}
+			}
+
+			if (err != nil) != s.err {
+				t.Errorf("Set() returned error: %v, expected error: %v", err, s.err)
+			}
+			if !reflect.DeepEqual(statful.Tags(tags), s.expected) {
+				t.Errorf("tags: %v, expected: %v", tags, s.expected)
+			}
+		})
+	}
+}
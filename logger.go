@@ -1,5 +1,149 @@
 package statful
 
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
 type Logger interface {
 	Println(v ...interface{})
 }
+
+// Level is the severity of a log entry.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return "level(" + strconv.Itoa(int(l)) + ")"
+	}
+}
+
+// StructuredLogger receives leveled log entries with alternating key and value fields, e.g.
+// Log(LevelError, "Failed to send metrics", "error", err, "count", 10).
+// A Logger that also implements StructuredLogger, like StdLogger or SlogLogger, is logged to through Log,
+// other loggers receive the message followed by the field values through Println and no debug entries.
+type StructuredLogger interface {
+	Log(level Level, msg string, keyvals ...interface{})
+}
+
+func structuredLoggerFor(l Logger) StructuredLogger {
+	switch logger := l.(type) {
+	case nil:
+		return noopLogger{}
+	case StructuredLogger:
+		return logger
+	default:
+		return printlnLogger{Logger: l}
+	}
+}
+
+// noopLogger discards everything, it is used when no Logger is configured.
+type noopLogger struct{}
+
+func (noopLogger) Println(...interface{}) {}
+
+func (noopLogger) Log(Level, string, ...interface{}) {}
+
+// printlnLogger logs to loggers only implementing Println the message followed by the field values.
+// The entries that predate StructuredLogger keep their Println output, see logLegacy.
+type printlnLogger struct {
+	Logger Logger
+}
+
+func (p printlnLogger) Log(level Level, msg string, keyvals ...interface{}) {
+	if level < LevelInfo {
+		return
+	}
+
+	v := []interface{}{msg}
+	for i := 1; i < len(keyvals); i += 2 {
+		v = append(v, keyvals[i])
+	}
+	if len(keyvals)%2 == 1 {
+		v = append(v, keyvals[len(keyvals)-1])
+	}
+
+	p.Logger.Println(v...)
+}
+
+// logLegacy logs an entry that predates StructuredLogger, loggers only implementing Println receive the println
+// values they were logged with before, e.g. "Dry metric:" and the line, instead of the message and field values.
+func logLegacy(logger StructuredLogger, println []interface{}, level Level, msg string, keyvals ...interface{}) {
+	if p, ok := logger.(printlnLogger); ok {
+		p.Logger.Println(println...)
+		return
+	}
+
+	logger.Log(level, msg, keyvals...)
+}
+
+var defaultStdLogger = log.New(os.Stderr, "", log.LstdFlags)
+
+// StdLogger adapts a log.Logger, defaulting to standard error, writing entries as
+// level=error msg="Failed to send metrics" error="api down" count=10. Entries below Level are discarded.
+type StdLogger struct {
+	Logger *log.Logger
+	Level  Level
+}
+
+func (s StdLogger) Println(v ...interface{}) {
+	s.Log(LevelInfo, strings.TrimSuffix(fmt.Sprintln(v...), "\n"))
+}
+
+func (s StdLogger) Log(level Level, msg string, keyvals ...interface{}) {
+	if level < s.Level {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("level=")
+	b.WriteString(level.String())
+	b.WriteString(" msg=")
+	b.WriteString(logfmtValue(msg))
+	for i := 0; i < len(keyvals); i += 2 {
+		key, value := fmt.Sprint(keyvals[i]), interface{}(nil)
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		} else {
+			key, value = "!BADKEY", keyvals[i]
+		}
+
+		b.WriteByte(' ')
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(logfmtValue(fmt.Sprint(value)))
+	}
+
+	logger := s.Logger
+	if logger == nil {
+		logger = defaultStdLogger
+	}
+	logger.Println(b.String())
+}
+
+func logfmtValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " =\"\t\n") {
+		return strconv.Quote(v)
+	}
+
+	return v
+}
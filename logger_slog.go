@@ -0,0 +1,42 @@
+//go:build go1.21
+// +build go1.21
+
+package statful
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// SlogLogger adapts a slog.Logger, defaulting to slog.Default, the key and value fields become slog attributes.
+type SlogLogger struct {
+	Logger *slog.Logger
+}
+
+func (s SlogLogger) Println(v ...interface{}) {
+	s.Log(LevelInfo, strings.TrimSuffix(fmt.Sprintln(v...), "\n"))
+}
+
+func (s SlogLogger) Log(level Level, msg string, keyvals ...interface{}) {
+	logger := s.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	logger.Log(context.Background(), slogLevel(level), msg, keyvals...)
+}
+
+func slogLevel(level Level) slog.Level {
+	switch level {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelInfo:
+		return slog.LevelInfo
+	case LevelWarn:
+		return slog.LevelWarn
+	default:
+		return slog.LevelError
+	}
+}
@@ -0,0 +1,36 @@
+//go:build go1.21
+// +build go1.21
+
+package statful
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var out bytes.Buffer
+	handler := slog.NewTextHandler(&out, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+
+	client := New(Configuration{
+		DisableAutoFlush: true,
+		Sender:           &recordingSender{err: errors.New("api down")},
+		Logger:           SlogLogger{Logger: slog.New(handler)},
+	})
+	client.Put("test.demo.metric", 100, Tags{}, 1585161000, Aggregations{}, Freq10s)
+	_ = client.FlushError()
+
+	expected := "level=ERROR msg=\"Failed to send metrics\" error=\"api down\" dropped=1\n"
+	if out.String() != expected {
+		t.Errorf("unexpected output:\n\texpected: %q\n\tactual: %q", expected, out.String())
+	}
+}
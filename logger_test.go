@@ -0,0 +1,120 @@
+package statful
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+)
+
+type logEntry struct {
+	level   Level
+	msg     string
+	keyvals []interface{}
+}
+
+type recordingLogger struct {
+	entries []logEntry
+}
+
+func (r *recordingLogger) Println(v ...interface{}) {}
+
+func (r *recordingLogger) Log(level Level, msg string, keyvals ...interface{}) {
+	r.entries = append(r.entries, logEntry{level: level, msg: msg, keyvals: keyvals})
+}
+
+func TestStdLogger(t *testing.T) {
+	scenarios := []struct {
+		description string
+		level       Level
+		log         func(l StdLogger)
+		expected    string
+	}{
+		{
+			description: "fields",
+			log: func(l StdLogger) {
+				l.Log(LevelError, "Failed to send metrics", "error", errors.New("api down"), "dropped", 10)
+			},
+			expected: "level=error msg=\"Failed to send metrics\" error=\"api down\" dropped=10\n",
+		}, {
+			description: "missing value",
+			log: func(l StdLogger) {
+				l.Log(LevelWarn, "odd", "key", "value", "alone")
+			},
+			expected: "level=warn msg=odd key=value !BADKEY=alone\n",
+		}, {
+			description: "println",
+			log: func(l StdLogger) {
+				l.Println("Dry metric:", "test.demo.metric 100.000000 0")
+			},
+			expected: "level=info msg=\"Dry metric: test.demo.metric 100.000000 0\"\n",
+		}, {
+			description: "below level",
+			level:       LevelInfo,
+			log: func(l StdLogger) {
+				l.Log(LevelDebug, "Flushed metrics", "count", 10)
+			},
+			expected: "",
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			var out bytes.Buffer
+			s.log(StdLogger{Logger: log.New(&out, "", 0), Level: s.level})
+
+			if out.String() != s.expected {
+				t.Errorf("unexpected output:\n\texpected: %q\n\tactual: %q", s.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestPrintlnLogger(t *testing.T) {
+	var out bytes.Buffer
+	logger := structuredLoggerFor(log.New(&out, "", 0))
+
+	logger.Log(LevelDebug, "Flushed metrics", "count", 10)
+	logger.Log(LevelError, "Failed to send metrics", "error", errors.New("api down"), "dropped", 10)
+	logger.Log(LevelInfo, "Dry aggregated metric:", "metrics", []string{"a 1 1"}, "aggregation", AggAvg, "frequency", Freq10s)
+	logger.Log(LevelWarn, "Failed to send to some senders", "error", errors.New("api down"), "failed", 1)
+
+	logLegacy(logger, []interface{}{"Dry metric:", "a 1 1"}, LevelInfo, "Dry metric:", "metric", "a 1 1", "dropped", 0)
+
+	expected := "Failed to send metrics api down 10\nDry aggregated metric: [a 1 1] avg 10\nFailed to send to some senders api down 1\nDry metric: a 1 1\n"
+	if out.String() != expected {
+		t.Errorf("unexpected output:\n\texpected: %q\n\tactual: %q", expected, out.String())
+	}
+}
+
+func TestClient_StructuredLogging(t *testing.T) {
+	logger := &recordingLogger{}
+	client := New(Configuration{DisableAutoFlush: true, Sender: &recordingSender{err: errors.New("api down")}, Logger: logger})
+
+	client.Put("test.demo.metric", 100, Tags{}, 1585161000, Aggregations{}, Freq10s)
+	client.Put("test.demo.metric", 200, Tags{}, 1585161001, Aggregations{}, Freq10s)
+	_ = client.FlushError()
+
+	if len(logger.entries) != 1 {
+		t.Fatalf("expected a single log entry, got: %v", logger.entries)
+	}
+
+	e := logger.entries[0]
+	if e.level != LevelError || e.msg != "Failed to send metrics" {
+		t.Errorf("unexpected entry: %v %q", e.level, e.msg)
+	}
+	if !strings.Contains(stringify(e.keyvals), "error=api down dropped=2") {
+		t.Errorf("unexpected fields: %v", e.keyvals)
+	}
+}
+
+func stringify(keyvals []interface{}) string {
+	var parts []string
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		parts = append(parts, fmt.Sprint(keyvals[i], "=", keyvals[i+1]))
+	}
+
+	return strings.Join(parts, " ")
+}
@@ -5,6 +5,22 @@ import (
 	"strings"
 )
 
+// Metric is a single metric, as encoded by MetricToString.
+// Aggregations and Frequency are empty for metrics sent already aggregated.
+type Metric struct {
+	Name         string
+	Value        float64
+	User         string
+	Tags         Tags
+	Timestamp    int64
+	Aggregations Aggregations
+	Frequency    AggregationFrequency
+}
+
+func (m Metric) String() string {
+	return MetricToString(m.Name, m.Value, m.User, m.Tags, m.Timestamp, m.Aggregations, m.Frequency)
+}
+
 // metric[,tag1=value][,tag2=value] value unix_timestamp [aggregation1][,aggregation2][,aggregation_frequency]
 // metric[,tag1=value][,tag2=value] value,user unix_timestamp [aggregation1][,aggregation2][,aggregation_frequency]
 func MetricToString(name string, value float64, user string, tags Tags, timestamp int64, aggregations Aggregations, frequency AggregationFrequency) string {
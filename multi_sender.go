@@ -0,0 +1,115 @@
+package statful
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+var ErrNoSenders = errors.New("no senders configured")
+
+// MultiSender forwards every payload to all of its Senders concurrently.
+// By default a send fails when any of the senders fails, with AllowPartialFailure it only fails
+// when every sender fails and the remaining errors are reported to the Logger. Without Senders every send fails
+// with ErrNoSenders.
+type MultiSender struct {
+	Senders             []Sender
+	AllowPartialFailure bool
+
+	Logger Logger
+}
+
+func (m *MultiSender) Send(data io.Reader) error {
+	return m.SendContext(context.Background(), data)
+}
+
+func (m *MultiSender) SendAggregated(data io.Reader, agg Aggregation, freq AggregationFrequency) error {
+	return m.SendAggregatedContext(context.Background(), data, agg, freq)
+}
+
+func (m *MultiSender) SendEvents(data io.Reader) error {
+	return m.SendEventsContext(context.Background(), data)
+}
+
+func (m *MultiSender) SendContext(ctx context.Context, data io.Reader) error {
+	return m.fanOutPayload(data, func(s Sender, r io.Reader) error {
+		return sendContext(ctx, s, r)
+	})
+}
+
+func (m *MultiSender) SendAggregatedContext(ctx context.Context, data io.Reader, agg Aggregation, freq AggregationFrequency) error {
+	return m.fanOutPayload(data, func(s Sender, r io.Reader) error {
+		return sendAggregatedContext(ctx, s, r, agg, freq)
+	})
+}
+
+func (m *MultiSender) SendEventsContext(ctx context.Context, data io.Reader) error {
+	return m.fanOutPayload(data, func(s Sender, r io.Reader) error {
+		return sendEventsContext(ctx, s, r)
+	})
+}
+
+func (m *MultiSender) sendMetrics(ctx context.Context, b metricBatch) error {
+	return m.fanOut(func(s Sender) error {
+		return sendMetricsContext(ctx, s, b)
+	})
+}
+
+func (m *MultiSender) sendEvents(ctx context.Context, b eventBatch) error {
+	return m.fanOut(func(s Sender) error {
+		return sendEventBatchContext(ctx, s, b)
+	})
+}
+
+// fanOutPayload reads data once and sends a copy of it to every sender.
+func (m *MultiSender) fanOutPayload(data io.Reader, send func(Sender, io.Reader) error) error {
+	payload, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+
+	return m.fanOut(func(s Sender) error {
+		return send(s, bytes.NewReader(payload))
+	})
+}
+
+func (m *MultiSender) fanOut(send func(Sender) error) error {
+	if len(m.Senders) == 0 {
+		return ErrNoSenders
+	}
+
+	errs := make([]error, len(m.Senders))
+	wg := sync.WaitGroup{}
+	for idx, sender := range m.Senders {
+		wg.Add(1)
+		go func(idx int, sender Sender) {
+			defer wg.Done()
+			// buffered data is still sent by the sender once it reconnects
+			if err := send(sender); err != nil && err != ErrSendBuffered {
+				errs[idx] = SenderErr{Index: idx, Err: err}
+			}
+		}(idx, sender)
+	}
+	wg.Wait()
+
+	var flushErr FlushErr
+	for _, err := range errs {
+		if err != nil {
+			flushErr = flushErr.appendErr(err)
+		}
+	}
+
+	if !flushErr.hasErrors() {
+		return nil
+	}
+
+	if m.AllowPartialFailure && len(flushErr.errors) < len(m.Senders) {
+		structuredLoggerFor(m.Logger).Log(LevelWarn, "Failed to send to some senders", "error", flushErr, "failed", len(flushErr.errors))
+		return nil
+	}
+
+	return flushErr
+}
@@ -0,0 +1,139 @@
+package statful
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+)
+
+type recordingSender struct {
+	mu       sync.Mutex
+	err      error
+	payloads []string
+}
+
+func (r *recordingSender) record(data io.Reader) error {
+	all, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.payloads = append(r.payloads, string(all))
+
+	return r.err
+}
+
+func (r *recordingSender) Send(data io.Reader) error {
+	return r.record(data)
+}
+
+func (r *recordingSender) SendAggregated(data io.Reader, agg Aggregation, freq AggregationFrequency) error {
+	return r.record(data)
+}
+
+func (r *recordingSender) SendEvents(data io.Reader) error {
+	return r.record(data)
+}
+
+func TestMultiSender(t *testing.T) {
+	scenarios := []struct {
+		description         string
+		errs                []error
+		allowPartialFailure bool
+		expectedErrors      int
+	}{
+		{
+			description: "all senders succeed",
+			errs:        []error{nil, nil, nil},
+		},
+		{
+			description:    "one sender fails",
+			errs:           []error{nil, errors.New("boom"), nil},
+			expectedErrors: 1,
+		},
+		{
+			description:         "one sender fails with partial failure allowed",
+			errs:                []error{nil, errors.New("boom"), nil},
+			allowPartialFailure: true,
+		},
+		{
+			description:         "all senders fail with partial failure allowed",
+			errs:                []error{errors.New("boom"), errors.New("bang")},
+			allowPartialFailure: true,
+			expectedErrors:      2,
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			var children []*recordingSender
+			multi := &MultiSender{AllowPartialFailure: s.allowPartialFailure, Logger: fmtLogger(func(...interface{}) (int, error) { return 0, nil })}
+			for _, err := range s.errs {
+				child := &recordingSender{err: err}
+				children = append(children, child)
+				multi.Senders = append(multi.Senders, child)
+			}
+
+			sends := []func() error{
+				func() error { return multi.Send(bytes.NewBufferString("metric 1 1")) },
+				func() error { return multi.SendAggregated(bytes.NewBufferString("metric 1 1"), AggAvg, Freq10s) },
+				func() error { return multi.SendEvents(bytes.NewBufferString("[]")) },
+			}
+
+			for _, send := range sends {
+				err := send()
+				if s.expectedErrors == 0 {
+					if err != nil {
+						t.Errorf("expected no error, got: %v", err)
+					}
+					continue
+				}
+
+				var flushErr FlushErr
+				if !errors.As(err, &flushErr) {
+					t.Fatalf("expected FlushErr, got: %v", err)
+				}
+				if len(flushErr.Errors()) != s.expectedErrors {
+					t.Errorf("expected %d errors, got: %v", s.expectedErrors, flushErr.Errors())
+				}
+				for _, e := range flushErr.Errors() {
+					var senderErr SenderErr
+					if !errors.As(e, &senderErr) || senderErr.Err != s.errs[senderErr.Index] {
+						t.Errorf("error not attributed to the failing sender: %v", e)
+					}
+				}
+			}
+
+			for idx, child := range children {
+				if len(child.payloads) != len(sends) {
+					t.Errorf("sender %d received %d payloads, expected %d", idx, len(child.payloads), len(sends))
+				}
+			}
+		})
+	}
+}
+
+func TestMultiSender_NoSenders(t *testing.T) {
+	multi := &MultiSender{}
+
+	sends := []func() error{
+		func() error { return multi.Send(bytes.NewBufferString("metric 1 1")) },
+		func() error { return multi.SendAggregated(bytes.NewBufferString("metric 1 1"), AggAvg, Freq10s) },
+		func() error { return multi.SendEvents(bytes.NewBufferString("[]")) },
+		func() error {
+			return sendMetricsContext(context.Background(), multi, metricBatch{metrics: []Metric{{Name: "metric"}}})
+		},
+	}
+
+	for _, send := range sends {
+		if err := send(); err != ErrNoSenders {
+			t.Errorf("expected ErrNoSenders, got: %v", err)
+		}
+	}
+}
@@ -0,0 +1,630 @@
+package statful
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultOtlpMaxBodySize = 10 * 1024 * 1024
+)
+
+const (
+	otlpTemporalityDelta      = 1
+	otlpTemporalityCumulative = 2
+
+	// otlpSeriesExpiry is how long OtlpHandler keeps the previous value of a cumulative series not received
+	otlpSeriesExpiry = 10 * time.Minute
+)
+
+// The OTLP/HTTP JSON metrics payload, limited to the fields used by OtlpSender and OtlpHandler.
+// 64 bit integers are encoded as strings, as required by the protobuf JSON mapping.
+type otlpMetricsData struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpScope struct {
+	Name       string         `json:"name,omitempty"`
+	Version    string         `json:"version,omitempty"`
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpMetric struct {
+	Name      string         `json:"name"`
+	Unit      string         `json:"unit,omitempty"`
+	Sum       *otlpSum       `json:"sum,omitempty"`
+	Gauge     *otlpGauge     `json:"gauge,omitempty"`
+	Histogram *otlpHistogram `json:"histogram,omitempty"`
+	Summary   *otlpSummary   `json:"summary,omitempty"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int                   `json:"aggregationTemporality"`
+	IsMonotonic            bool                  `json:"isMonotonic"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+}
+
+type otlpHistogram struct {
+	DataPoints             []otlpHistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                      `json:"aggregationTemporality"`
+}
+
+type otlpSummary struct {
+	DataPoints []otlpSummaryDataPoint `json:"dataPoints"`
+}
+
+type otlpNumberDataPoint struct {
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+	TimeUnixNano otlpInt        `json:"timeUnixNano"`
+	AsDouble     *float64       `json:"asDouble,omitempty"`
+	AsInt        *otlpInt       `json:"asInt,omitempty"`
+}
+
+type otlpHistogramDataPoint struct {
+	Attributes     []otlpKeyValue `json:"attributes,omitempty"`
+	TimeUnixNano   otlpInt        `json:"timeUnixNano"`
+	Count          otlpInt        `json:"count"`
+	Sum            *float64       `json:"sum,omitempty"`
+	BucketCounts   []otlpInt      `json:"bucketCounts,omitempty"`
+	ExplicitBounds []float64      `json:"explicitBounds,omitempty"`
+	Min            *float64       `json:"min,omitempty"`
+	Max            *float64       `json:"max,omitempty"`
+}
+
+type otlpSummaryDataPoint struct {
+	Attributes     []otlpKeyValue      `json:"attributes,omitempty"`
+	TimeUnixNano   otlpInt             `json:"timeUnixNano"`
+	Count          otlpInt             `json:"count"`
+	Sum            float64             `json:"sum"`
+	QuantileValues []otlpQuantileValue `json:"quantileValues,omitempty"`
+}
+
+type otlpQuantileValue struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *otlpInt `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// otlpInt is a 64 bit integer encoded as a JSON string and decoded from either a string or a number.
+type otlpInt int64
+
+func (i otlpInt) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + strconv.FormatInt(int64(i), 10) + `"`), nil
+}
+
+func (i *otlpInt) UnmarshalJSON(data []byte) error {
+	// null leaves the value unchanged, like for the other JSON types
+	if string(data) == "null" {
+		return nil
+	}
+
+	v, err := strconv.ParseInt(strings.Trim(string(data), `"`), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid integer %s", data)
+	}
+	*i = otlpInt(v)
+
+	return nil
+}
+
+func (v otlpAnyValue) String() string {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.BoolValue != nil:
+		return strconv.FormatBool(*v.BoolValue)
+	case v.IntValue != nil:
+		return strconv.FormatInt(int64(*v.IntValue), 10)
+	case v.DoubleValue != nil:
+		return strconv.FormatFloat(*v.DoubleValue, 'g', -1, 64)
+	default:
+		return ""
+	}
+}
+
+func (p otlpNumberDataPoint) value() float64 {
+	if p.AsDouble != nil {
+		return *p.AsDouble
+	}
+	if p.AsInt != nil {
+		return float64(*p.AsInt)
+	}
+
+	return 0
+}
+
+func otlpAttributes(tags Tags) []otlpKeyValue {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attributes := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		v := tags[k]
+		attributes = append(attributes, otlpKeyValue{Key: k, Value: otlpAnyValue{StringValue: &v}})
+	}
+
+	return attributes
+}
+
+// otlpTags converts attributes to sanitized tags, skipping the attributes without a scalar value.
+func otlpTags(attributes []otlpKeyValue) Tags {
+	tags := Tags{}
+	for _, a := range attributes {
+		if k, v := sanitizeName(a.Key), sanitizeName(a.Value.String()); k != "" && v != "" {
+			tags[k] = v
+		}
+	}
+
+	return tags
+}
+
+// OtlpSender sends metrics as OTLP/HTTP JSON to the collector metrics endpoint at Url,
+// e.g. http://localhost:4318/v1/metrics, with Resource as the resource attributes, e.g. service.name.
+//
+// Counters, metrics with only the count and sum aggregations, are sent as delta sums, metrics with the last
+// aggregation or without aggregations as gauges and the other metrics, like timers, as single value histograms.
+// Already aggregated metrics are sent as delta sums for the count and sum aggregations and as gauges otherwise.
+// Tags become data point attributes. Events are not supported. A nil Http defaults to a client with
+// DefaultHttpTimeout.
+type OtlpSender struct {
+	Http          *http.Client
+	Url           string
+	Headers       map[string]string
+	Resource      Tags
+	NoCompression bool
+}
+
+// Encoder returns StatfulEncoder, the lines are converted to OTLP when sent.
+func (o *OtlpSender) Encoder() Encoder {
+	return StatfulEncoder{}
+}
+
+func (o *OtlpSender) Send(data io.Reader) error {
+	return o.SendContext(context.Background(), data)
+}
+
+func (o *OtlpSender) SendAggregated(data io.Reader, agg Aggregation, freq AggregationFrequency) error {
+	return o.SendAggregatedContext(context.Background(), data, agg, freq)
+}
+
+func (o *OtlpSender) SendEvents(io.Reader) error {
+	return ErrUnsupportedOperation
+}
+
+func (o *OtlpSender) SendContext(ctx context.Context, data io.Reader) error {
+	metrics, err := MetricParser{Lenient: true}.ParseMetrics(data)
+	if err != nil {
+		return err
+	}
+
+	return o.send(ctx, metrics, otlpKind)
+}
+
+func (o *OtlpSender) SendAggregatedContext(ctx context.Context, data io.Reader, agg Aggregation, freq AggregationFrequency) error {
+	metrics, err := MetricParser{Lenient: true}.ParseMetrics(data)
+	if err != nil {
+		return err
+	}
+
+	return o.send(ctx, metrics, otlpAggregatedKind(agg))
+}
+
+func (o *OtlpSender) SendEventsContext(context.Context, io.Reader) error {
+	return ErrUnsupportedOperation
+}
+
+// sendMetrics converts the buffered metrics to OTLP directly instead of parsing their Statful lines.
+func (o *OtlpSender) sendMetrics(ctx context.Context, b metricBatch) error {
+	if b.aggregated {
+		return o.send(ctx, b.metrics, otlpAggregatedKind(b.agg))
+	}
+
+	return o.send(ctx, b.metrics, otlpKind)
+}
+
+func (o *OtlpSender) send(ctx context.Context, metrics []Metric, kindOf func(Metric) promKind) error {
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(o.encode(metrics, kindOf))
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader = bytes.NewReader(payload)
+	headers := http.Header{}
+	if !o.NoCompression {
+		if body, err = gzipData(body); err != nil {
+			return err
+		}
+		headers.Set("Content-Encoding", "gzip")
+	}
+	headers.Set("Content-Type", jsonEncoding)
+	for k, v := range o.Headers {
+		headers.Set(k, v)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.Url, body)
+	if err != nil {
+		return err
+	}
+	req.Header = headers
+
+	resp, err := o.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("OTLP request failed with %v %v", resp.StatusCode, string(respBody))
+	}
+
+	return nil
+}
+
+func (o *OtlpSender) client() *http.Client {
+	if o.Http == nil {
+		return defaultHttpClient
+	}
+
+	return o.Http
+}
+
+// otlpKind returns the kind of a metric from its aggregations.
+func otlpKind(m Metric) promKind {
+	return promKindOf(m.Aggregations)
+}
+
+// otlpAggregatedKind returns the kind of the metrics aggregated with agg.
+func otlpAggregatedKind(agg Aggregation) func(Metric) promKind {
+	return func(Metric) promKind {
+		if agg == AggCount || agg == AggSum {
+			return promCounter
+		}
+		return promGauge
+	}
+}
+
+// encode groups the metrics by name and kind, keeping the order they were sent in.
+func (o *OtlpSender) encode(metrics []Metric, kindOf func(Metric) promKind) otlpMetricsData {
+	var encoded []otlpMetric
+	index := map[string]int{}
+
+	for _, m := range metrics {
+		kind := kindOf(m)
+		key := m.Name + " " + string(kind)
+
+		idx, ok := index[key]
+		if !ok {
+			idx = len(encoded)
+			index[key] = idx
+
+			om := otlpMetric{Name: m.Name}
+			switch kind {
+			case promCounter:
+				om.Sum = &otlpSum{AggregationTemporality: otlpTemporalityDelta, IsMonotonic: true}
+			case promGauge:
+				om.Gauge = &otlpGauge{}
+			default:
+				om.Histogram = &otlpHistogram{AggregationTemporality: otlpTemporalityDelta}
+			}
+			encoded = append(encoded, om)
+		}
+
+		tags := m.Tags
+		if m.User != "" {
+			tags = Tags{"user_id": m.User}.Merge(m.Tags)
+		}
+		attributes := otlpAttributes(tags)
+		timestamp := otlpInt(m.Timestamp * int64(time.Second))
+		value := m.Value
+
+		om := &encoded[idx]
+		switch {
+		case om.Sum != nil:
+			om.Sum.DataPoints = append(om.Sum.DataPoints, otlpNumberDataPoint{Attributes: attributes, TimeUnixNano: timestamp, AsDouble: &value})
+			om.Sum.IsMonotonic = om.Sum.IsMonotonic && value >= 0
+		case om.Gauge != nil:
+			om.Gauge.DataPoints = append(om.Gauge.DataPoints, otlpNumberDataPoint{Attributes: attributes, TimeUnixNano: timestamp, AsDouble: &value})
+		default:
+			om.Histogram.DataPoints = append(om.Histogram.DataPoints, otlpHistogramDataPoint{
+				Attributes:   attributes,
+				TimeUnixNano: timestamp,
+				Count:        1,
+				Sum:          &value,
+				BucketCounts: []otlpInt{1},
+				Min:          &value,
+				Max:          &value,
+			})
+		}
+	}
+
+	return otlpMetricsData{ResourceMetrics: []otlpResourceMetrics{{
+		Resource:     otlpResource{Attributes: otlpAttributes(o.Resource)},
+		ScopeMetrics: []otlpScopeMetrics{{Scope: otlpScope{Name: "github.com/statful/statful-client-golang"}, Metrics: encoded}},
+	}}}
+}
+
+// OtlpHandler is an http.Handler receiving OTLP/HTTP JSON metric payloads and putting them in Client.
+// Resource, scope and data point attributes are merged into the tags, the most specific taking precedence,
+// with whitespace, commas and equal signs in names and attributes replaced by underscores.
+//
+// Delta sums are sent with CounterAggregations and cumulative monotonic sums as the delta since the previous point,
+// gauges and non monotonic sums with GaugeAggregations. Histograms and summaries are sent as aggregated metrics:
+// their count and sum, as deltas when cumulative, the min and max of histograms and the 0.9, 0.95 and 0.99 quantiles
+// of summaries, all with Frequency. Cumulative series not received for otlpSeriesExpiry are forgotten.
+// Protobuf payloads are not supported.
+type OtlpHandler struct {
+	Client              *Client
+	CounterAggregations Aggregations
+	GaugeAggregations   Aggregations
+	Frequency           AggregationFrequency
+
+	// MaxBodySize limits the payload size in bytes, both as received and once decompressed, larger payloads are
+	// rejected with 413 Request Entity Too Large. It defaults to DefaultOtlpMaxBodySize.
+	MaxBodySize int64
+
+	deltas deltaTracker
+}
+
+func (o *OtlpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "" && !strings.HasPrefix(ct, jsonEncoding) {
+		http.Error(w, "only application/json payloads are supported", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	limit := o.MaxBodySize
+	if limit <= 0 {
+		limit = DefaultOtlpMaxBodySize
+	}
+
+	var body io.Reader = &limitedReader{Reader: http.MaxBytesReader(w, r.Body, limit), remaining: limit}
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gr, err := gzip.NewReader(body)
+		if err == errBodyTooLarge {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer gr.Close()
+		// the decompressed size is limited too, a small payload may expand to gigabytes
+		body = &limitedReader{Reader: gr, remaining: limit}
+	}
+
+	var data otlpMetricsData
+	if err := json.NewDecoder(body).Decode(&data); err == errBodyTooLarge {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	} else if err != nil {
+		http.Error(w, "invalid OTLP JSON payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	o.put(data)
+
+	w.Header().Set("Content-Type", jsonEncoding)
+	_, _ = w.Write([]byte("{}"))
+}
+
+var errBodyTooLarge = errors.New("request body too large")
+
+// limitedReader reads up to remaining bytes and returns errBodyTooLarge if the reader has more data.
+type limitedReader struct {
+	io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// any data, or error as returned by http.MaxBytesReader, past the limit means the body is too large
+		var probe [1]byte
+		if n, err := l.Reader.Read(probe[:]); n == 0 && err == io.EOF {
+			return 0, io.EOF
+		}
+		return 0, errBodyTooLarge
+	}
+
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.Reader.Read(p)
+	l.remaining -= int64(n)
+
+	return n, err
+}
+
+func (o *OtlpHandler) put(data otlpMetricsData) {
+	o.deltas.expireIdle(otlpSeriesExpiry)
+
+	now := time.Now().Unix()
+	timestamp := func(nanos otlpInt) int64 {
+		if nanos <= 0 {
+			return now
+		}
+		return int64(nanos) / int64(time.Second)
+	}
+
+	for _, rm := range data.ResourceMetrics {
+		resourceTags := otlpTags(rm.Resource.Attributes)
+
+		for _, sm := range rm.ScopeMetrics {
+			scopeTags := otlpTags(sm.Scope.Attributes).Merge(resourceTags)
+
+			for _, m := range sm.Metrics {
+				m.Name = sanitizeName(m.Name)
+
+				switch {
+				case m.Sum != nil:
+					for _, p := range m.Sum.DataPoints {
+						tags := otlpTags(p.Attributes).Merge(scopeTags)
+						value := p.value()
+
+						switch {
+						case !m.Sum.IsMonotonic:
+							o.putGauge(m.Name, value, tags, timestamp(p.TimeUnixNano))
+						case m.Sum.AggregationTemporality == otlpTemporalityCumulative:
+							if delta, ok := o.deltas.delta(seriesKey(m.Name, tags), value); ok {
+								o.putCounter(m.Name, delta, tags, timestamp(p.TimeUnixNano))
+							}
+						default:
+							o.putCounter(m.Name, value, tags, timestamp(p.TimeUnixNano))
+						}
+					}
+				case m.Gauge != nil:
+					for _, p := range m.Gauge.DataPoints {
+						o.putGauge(m.Name, p.value(), otlpTags(p.Attributes).Merge(scopeTags), timestamp(p.TimeUnixNano))
+					}
+				case m.Histogram != nil:
+					for _, p := range m.Histogram.DataPoints {
+						tags := otlpTags(p.Attributes).Merge(scopeTags)
+						ts := timestamp(p.TimeUnixNano)
+
+						var sum float64
+						if p.Sum != nil {
+							sum = *p.Sum
+						}
+						o.putCountAndSum(m.Name, float64(p.Count), sum, p.Sum != nil, m.Histogram.AggregationTemporality == otlpTemporalityCumulative, tags, ts)
+						if p.Min != nil {
+							o.putAggregated(m.Name, *p.Min, tags, ts, AggMin)
+						}
+						if p.Max != nil {
+							o.putAggregated(m.Name, *p.Max, tags, ts, AggMax)
+						}
+					}
+				case m.Summary != nil:
+					for _, p := range m.Summary.DataPoints {
+						tags := otlpTags(p.Attributes).Merge(scopeTags)
+						ts := timestamp(p.TimeUnixNano)
+
+						// summary count and sum are always cumulative
+						o.putCountAndSum(m.Name, float64(p.Count), p.Sum, true, true, tags, ts)
+						for _, q := range p.QuantileValues {
+							for agg, quantile := range prometheusQuantiles {
+								if q.Quantile == quantile {
+									o.putAggregated(m.Name, q.Value, tags, ts, agg)
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func (o *OtlpHandler) putCountAndSum(name string, count float64, sum float64, hasSum bool, cumulative bool, tags Tags, timestamp int64) {
+	if cumulative {
+		var ok bool
+		if count, ok = o.deltas.delta(seriesKey(name+" count", tags), count); !ok {
+			if hasSum {
+				o.deltas.delta(seriesKey(name+" sum", tags), sum)
+			}
+			return
+		}
+		if hasSum {
+			sum, _ = o.deltas.delta(seriesKey(name+" sum", tags), sum)
+		}
+	}
+
+	o.putAggregated(name, count, tags, timestamp, AggCount)
+	if hasSum {
+		o.putAggregated(name, sum, tags, timestamp, AggSum)
+	}
+}
+
+func (o *OtlpHandler) putCounter(name string, value float64, tags Tags, timestamp int64) {
+	aggs := o.CounterAggregations
+	if len(aggs) == 0 {
+		aggs = counterAggregations
+	}
+	o.putMetric(name, value, tags, timestamp, aggs)
+}
+
+func (o *OtlpHandler) putGauge(name string, value float64, tags Tags, timestamp int64) {
+	aggs := o.GaugeAggregations
+	if len(aggs) == 0 {
+		aggs = gaugeAggregations
+	}
+	o.putMetric(name, value, tags, timestamp, aggs)
+}
+
+func (o *OtlpHandler) putMetric(name string, value float64, tags Tags, timestamp int64, aggs Aggregations) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+
+	_ = o.Client.Put(name, value, tags, timestamp, aggs, o.frequency())
+}
+
+func (o *OtlpHandler) putAggregated(name string, value float64, tags Tags, timestamp int64, agg Aggregation) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+
+	_ = o.Client.PutAggregated(name, value, tags, timestamp, agg, o.frequency())
+}
+
+func (o *OtlpHandler) frequency() AggregationFrequency {
+	if o.Frequency == 0 {
+		return Freq10s
+	}
+
+	return o.Frequency
+}
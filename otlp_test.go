@@ -0,0 +1,319 @@
+package statful
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// aggregatedSender records the metrics as "aggregation name tags value", with - as the aggregation of plain metrics.
+type aggregatedSender struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+func (a *aggregatedSender) record(data io.Reader, agg Aggregation) error {
+	metrics, err := MetricParser{}.ParseMetrics(data)
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, m := range metrics {
+		a.lines = append(a.lines, fmt.Sprintf("%s %s %v %v", agg, m.Name, map[string]string(m.Tags), m.Value))
+	}
+
+	return nil
+}
+
+func (a *aggregatedSender) Send(data io.Reader) error {
+	return a.record(data, "-")
+}
+
+func (a *aggregatedSender) SendAggregated(data io.Reader, agg Aggregation, freq AggregationFrequency) error {
+	return a.record(data, agg)
+}
+
+func (a *aggregatedSender) SendEvents(data io.Reader) error {
+	return nil
+}
+
+func (a *aggregatedSender) sorted() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	lines := append([]string(nil), a.lines...)
+	sort.Strings(lines)
+	return lines
+}
+
+func jsonBody(r *http.Request, v interface{}) error {
+	body := r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return err
+		}
+		body = gr
+	}
+
+	return json.NewDecoder(body).Decode(v)
+}
+
+func TestOtlpSender_Send(t *testing.T) {
+	var payload otlpMetricsData
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" || r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("unexpected headers: %v", r.Header)
+		}
+		if err := jsonBody(r, &payload); err != nil {
+			t.Errorf("invalid payload: %v", err)
+		}
+	}))
+	defer srv.Close()
+
+	sender := &OtlpSender{Url: srv.URL, Headers: map[string]string{"Authorization": "Bearer token"}, Resource: Tags{"service.name": "api"}}
+	err := sender.Send(strings.NewReader(strings.Join([]string{
+		"requests,status=200 2.000000 1585161000 count,sum,10",
+		"requests,status=500 1.000000 1585161000 count,sum,10",
+		"queue.size 12.000000 1585161000 last,10",
+		"latency 0.250000 1585161000 avg,count,p90,10",
+	}, "\n")))
+	if err != nil {
+		t.Fatalf("Send() returned error: %v", err)
+	}
+
+	if len(payload.ResourceMetrics) != 1 || len(payload.ResourceMetrics[0].ScopeMetrics) != 1 {
+		t.Fatalf("payload: %+v", payload)
+	}
+	if tags := otlpTags(payload.ResourceMetrics[0].Resource.Attributes); !reflect.DeepEqual(tags, Tags{"service.name": "api"}) {
+		t.Errorf("resource attributes: %v", tags)
+	}
+
+	metrics := payload.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	if len(metrics) != 3 {
+		t.Fatalf("metrics: %+v", metrics)
+	}
+	if m := metrics[0]; m.Name != "requests" || m.Sum == nil || len(m.Sum.DataPoints) != 2 || m.Sum.DataPoints[0].value() != 2 ||
+		m.Sum.DataPoints[0].TimeUnixNano != 1585161000000000000 || !reflect.DeepEqual(otlpTags(m.Sum.DataPoints[1].Attributes), Tags{"status": "500"}) {
+		t.Errorf("counter: %+v", m)
+	}
+	if m := metrics[1]; m.Name != "queue.size" || m.Gauge == nil || m.Gauge.DataPoints[0].value() != 12 {
+		t.Errorf("gauge: %+v", m)
+	}
+	if m := metrics[2]; m.Name != "latency" || m.Histogram == nil || m.Histogram.DataPoints[0].Count != 1 || *m.Histogram.DataPoints[0].Sum != 0.25 {
+		t.Errorf("timer: %+v", m)
+	}
+}
+
+func TestOtlpSender_Client(t *testing.T) {
+	var mu sync.Mutex
+	var metrics []otlpMetric
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload otlpMetricsData
+		if err := jsonBody(r, &payload); err != nil {
+			t.Errorf("invalid payload: %v", err)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		for _, rm := range payload.ResourceMetrics {
+			for _, sm := range rm.ScopeMetrics {
+				metrics = append(metrics, sm.Metrics...)
+			}
+		}
+	}))
+	defer srv.Close()
+
+	client := New(Configuration{
+		DisableAutoFlush: true,
+		Sender:           &OtlpSender{Url: srv.URL},
+	})
+	// a space would split the Statful line, the metrics are converted without encoding them
+	client.Gauge("temperature", 21.5, Tags{"room": "living room"})
+	client.CounterAggregated("items", 3, Tags{}, AggSum, Freq60s)
+	if err := client.FlushError(); err != nil {
+		t.Fatalf("FlushError() returned error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Name < metrics[j].Name })
+	if len(metrics) != 2 {
+		t.Fatalf("metrics: %+v", metrics)
+	}
+	if m := metrics[0]; m.Name != "items" || m.Sum == nil || m.Sum.DataPoints[0].value() != 3 {
+		t.Errorf("aggregated counter: %+v", m)
+	}
+	if m := metrics[1]; m.Name != "temperature" || m.Gauge == nil || m.Gauge.DataPoints[0].value() != 21.5 ||
+		len(m.Gauge.DataPoints[0].Attributes) != 1 || m.Gauge.DataPoints[0].Attributes[0].Value.String() != "living room" {
+		t.Errorf("gauge: %+v", m)
+	}
+}
+
+func TestOtlpSender_DefaultClient(t *testing.T) {
+	if client := (&OtlpSender{}).client(); client.Timeout != DefaultHttpTimeout {
+		t.Errorf("default client timeout: %v, expected: %v", client.Timeout, DefaultHttpTimeout)
+	}
+}
+
+func TestOtlpHandler(t *testing.T) {
+	sender := &aggregatedSender{}
+	client := New(Configuration{DisableAutoFlush: true, Sender: sender, Logger: fmtLogger(fmt.Println)})
+	handler := &OtlpHandler{Client: client}
+
+	payload := func(total int, count int, sum float64) string {
+		return fmt.Sprintf(`{"resourceMetrics":[{
+			"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"api"}},{"key":"host","value":{"stringValue":"a"}}]},
+			"scopeMetrics":[{"scope":{"name":"lib","attributes":[{"key":"host","value":{"stringValue":"b"}}]},"metrics":[
+				{"name":"requests","sum":{"aggregationTemporality":1,"isMonotonic":true,"dataPoints":[{"asInt":"3","timeUnixNano":"1585161000000000000","attributes":[{"key":"code","value":{"intValue":200}}]}]}},
+				{"name":"jobs","sum":{"aggregationTemporality":2,"isMonotonic":true,"dataPoints":[{"asDouble":%d,"timeUnixNano":"1585161000000000000"}]}},
+				{"name":"queue.size","gauge":{"dataPoints":[{"asDouble":1.5,"timeUnixNano":"1585161000000000000"}]}},
+				{"name":"latency","histogram":{"aggregationTemporality":1,"dataPoints":[{"count":"4","sum":2,"min":0.1,"max":1,"timeUnixNano":"1585161000000000000"}]}},
+				{"name":"rpc","summary":{"dataPoints":[{"count":%d,"sum":%g,"quantileValues":[{"quantile":0.5,"value":0.2},{"quantile":0.99,"value":0.9}],"timeUnixNano":"1585161000000000000"}]}}
+			]}]}]}`, total, count, sum)
+	}
+
+	for _, body := range []string{payload(10, 100, 50), payload(15, 110, 54)} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/metrics", bytes.NewBufferString(body)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("ServeHTTP() returned %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+	if err := client.FlushError(); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := sender.sorted()
+	expected := []string{
+		"- jobs map[host:b service.name:api] 5",
+		"- queue.size map[host:b service.name:api] 1.5",
+		"- queue.size map[host:b service.name:api] 1.5",
+		"- requests map[code:200 host:b service.name:api] 3",
+		"- requests map[code:200 host:b service.name:api] 3",
+		"count latency map[host:b service.name:api] 4",
+		"count latency map[host:b service.name:api] 4",
+		"count rpc map[host:b service.name:api] 10",
+		"max latency map[host:b service.name:api] 1",
+		"max latency map[host:b service.name:api] 1",
+		"min latency map[host:b service.name:api] 0.1",
+		"min latency map[host:b service.name:api] 0.1",
+		"p99 rpc map[host:b service.name:api] 0.9",
+		"p99 rpc map[host:b service.name:api] 0.9",
+		"sum latency map[host:b service.name:api] 2",
+		"sum latency map[host:b service.name:api] 2",
+		"sum rpc map[host:b service.name:api] 4",
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("sent:\n%s\nexpected:\n%s", strings.Join(lines, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestOtlpHandler_InvalidRequests(t *testing.T) {
+	handler := &OtlpHandler{Client: New(Configuration{DisableAutoFlush: true, Sender: &recordingSender{}})}
+
+	scenarios := []struct {
+		description string
+		method      string
+		contentType string
+		body        string
+		status      int
+	}{
+		{description: "get", method: http.MethodGet, status: http.StatusMethodNotAllowed},
+		{description: "protobuf", method: http.MethodPost, contentType: "application/x-protobuf", status: http.StatusUnsupportedMediaType},
+		{description: "invalid json", method: http.MethodPost, contentType: "application/json", body: "{", status: http.StatusBadRequest},
+		{description: "invalid integer", method: http.MethodPost, body: `{"resourceMetrics":[{"scopeMetrics":[{"metrics":[{"name":"a","gauge":{"dataPoints":[{"asInt":"x"}]}}]}]}]}`, status: http.StatusBadRequest},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			req := httptest.NewRequest(s.method, "/v1/metrics", strings.NewReader(s.body))
+			if s.contentType != "" {
+				req.Header.Set("Content-Type", s.contentType)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != s.status {
+				t.Errorf("ServeHTTP() returned %d, expected %d", rec.Code, s.status)
+			}
+		})
+	}
+}
+
+func TestOtlpHandler_MaxBodySize(t *testing.T) {
+	handler := &OtlpHandler{Client: New(Configuration{DisableAutoFlush: true, Sender: &recordingSender{}}), MaxBodySize: 1024}
+
+	small := `{"resourceMetrics":[]}`
+	large := `{"resourceMetrics":[` + strings.Repeat(`{"scopeMetrics":[]},`, 100) + `{}]}`
+	gzipped := func(body string) string {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		_, _ = gw.Write([]byte(body))
+		_ = gw.Close()
+		return buf.String()
+	}
+
+	scenarios := []struct {
+		description string
+		body        string
+		gzip        bool
+		status      int
+	}{
+		{description: "small payload", body: small, status: http.StatusOK},
+		{description: "large payload", body: large, status: http.StatusRequestEntityTooLarge},
+		{description: "small gzipped payload", body: gzipped(small), gzip: true, status: http.StatusOK},
+		{description: "gzipped payload expanding over the limit", body: gzipped(large), gzip: true, status: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/v1/metrics", strings.NewReader(s.body))
+			if s.gzip {
+				req.Header.Set("Content-Encoding", "gzip")
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != s.status {
+				t.Errorf("ServeHTTP() returned %d, expected %d: %s", rec.Code, s.status, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestOtlpInt_Null(t *testing.T) {
+	var p otlpNumberDataPoint
+	if err := json.Unmarshal([]byte(`{"timeUnixNano":null,"asInt":null}`), &p); err != nil {
+		t.Fatalf("Unmarshal() returned error: %v", err)
+	}
+	if p.TimeUnixNano != 0 || p.AsInt != nil {
+		t.Errorf("decoded: %+v, expected zero values", p)
+	}
+}
+
+func TestOtlpTags(t *testing.T) {
+	value := func(s string) otlpAnyValue { return otlpAnyValue{StringValue: &s} }
+	attributes := []otlpKeyValue{
+		{Key: "http.route", Value: value("/users/{id}, /teams")},
+		{Key: "k=v", Value: value("a b")},
+		{Key: "empty", Value: value("")},
+	}
+
+	expected := Tags{"http.route": "/users/{id}__/teams", "k_v": "a_b"}
+	if tags := otlpTags(attributes); !reflect.DeepEqual(tags, expected) {
+		t.Errorf("otlpTags() returned: %v, expected: %v", tags, expected)
+	}
+}
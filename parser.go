@@ -0,0 +1,329 @@
+package statful
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	knownAggregations = Aggregations{
+		AggAvg: nothing, AggSum: nothing, AggCount: nothing, AggFirst: nothing, AggLast: nothing,
+		AggP90: nothing, AggP95: nothing, AggP99: nothing, AggMin: nothing, AggMax: nothing,
+	}
+	knownFrequencies = map[AggregationFrequency]bool{
+		Freq10s: true, Freq30s: true, Freq60s: true, Freq120s: true, Freq180s: true, Freq300s: true,
+	}
+)
+
+// ValidAggregation reports whether agg is one of the aggregations accepted by Statful.
+func ValidAggregation(agg Aggregation) bool {
+	_, ok := knownAggregations[agg]
+	return ok
+}
+
+// ValidFrequency reports whether freq is one of the aggregation frequencies accepted by Statful.
+func ValidFrequency(freq AggregationFrequency) bool {
+	return knownFrequencies[freq]
+}
+
+// ParseError reports why a metric line failed to parse and where. Line is the 1-based line number when
+// parsing a stream and Column the 1-based byte offset in the line.
+type ParseError struct {
+	Line   int
+	Column int
+	Text   string
+	Msg    string
+}
+
+func (p *ParseError) Error() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("line %d, column %d: %s", p.Line, p.Column, p.Msg)
+	}
+
+	return fmt.Sprintf("column %d: %s", p.Column, p.Msg)
+}
+
+// MetricParser parses the line format produced by MetricToString, the inverse of Metric.String.
+//
+// In strict mode, the default, fields must be separated by a single space, tags must have a key and a value and
+// aggregations and frequency must be the ones supported by Statful. Lenient mode accepts any whitespace between fields,
+// ignores empty tags, accepts unknown aggregations, any positive frequency, a missing frequency (defaulting to Freq10s)
+// and fractional timestamps.
+type MetricParser struct {
+	Lenient bool
+}
+
+// ParseMetric parses a single metric line in strict mode.
+func ParseMetric(line string) (Metric, error) {
+	return MetricParser{}.Parse(line)
+}
+
+type field struct {
+	text   string
+	column int
+}
+
+func (p MetricParser) Parse(line string) (Metric, error) {
+	m := Metric{Tags: Tags{}}
+
+	fields, err := p.split(line)
+	if err != nil {
+		return m, err
+	}
+	if len(fields) < 3 {
+		return m, parseErr(line, len(line)+1, "expected value and timestamp after the metric name")
+	}
+	if len(fields) > 4 {
+		return m, parseErr(line, fields[4].column, "unexpected field %q", fields[4].text)
+	}
+
+	if err := p.parseNameAndTags(line, fields[0], &m); err != nil {
+		return m, err
+	}
+	if err := p.parseValue(line, fields[1], &m); err != nil {
+		return m, err
+	}
+	if err := p.parseTimestamp(line, fields[2], &m); err != nil {
+		return m, err
+	}
+	if len(fields) == 4 {
+		if err := p.parseAggregations(line, fields[3], &m); err != nil {
+			return m, err
+		}
+	}
+
+	return m, nil
+}
+
+// split breaks the line in space separated fields, remembering where each one starts.
+func (p MetricParser) split(line string) ([]field, error) {
+	var fields []field
+
+	if p.Lenient {
+		start := -1
+		for idx, r := range line + " " {
+			space := r == ' ' || r == '\t' || r == '\r' || r == '\n' || idx == len(line)
+			if space && start >= 0 {
+				fields = append(fields, field{text: line[start:idx], column: start + 1})
+				start = -1
+			} else if !space && start < 0 {
+				start = idx
+			}
+		}
+		if len(fields) == 0 {
+			return nil, parseErr(line, 1, "empty line")
+		}
+
+		return fields, nil
+	}
+
+	start := 0
+	for idx := 0; idx <= len(line); idx++ {
+		if idx < len(line) && line[idx] != ' ' {
+			continue
+		}
+		if idx == start {
+			if idx == 0 && len(line) == 0 {
+				return nil, parseErr(line, 1, "empty line")
+			}
+			return nil, parseErr(line, idx+1, "unexpected space")
+		}
+		fields = append(fields, field{text: line[start:idx], column: start + 1})
+		start = idx + 1
+	}
+
+	return fields, nil
+}
+
+func (p MetricParser) parseNameAndTags(line string, f field, m *Metric) error {
+	parts := strings.Split(f.text, ",")
+	m.Name = parts[0]
+	if m.Name == "" {
+		return parseErr(line, f.column, "missing metric name")
+	}
+
+	column := f.column + len(parts[0]) + 1
+	for _, tag := range parts[1:] {
+		if tag == "" && p.Lenient {
+			column++
+			continue
+		}
+
+		kv := strings.SplitN(tag, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || (kv[1] == "" && !p.Lenient) {
+			return parseErr(line, column, "invalid tag %q, expected key=value", tag)
+		}
+		if _, ok := m.Tags[kv[0]]; ok && !p.Lenient {
+			return parseErr(line, column, "duplicate tag %q", kv[0])
+		}
+		m.Tags[kv[0]] = kv[1]
+		column += len(tag) + 1
+	}
+
+	return nil
+}
+
+func (p MetricParser) parseValue(line string, f field, m *Metric) error {
+	value := f.text
+	column := f.column
+
+	if strings.HasPrefix(value, "value=") {
+		parts := strings.SplitN(strings.TrimPrefix(value, "value="), ",", 2)
+		if len(parts) != 2 || !strings.HasPrefix(parts[1], "user_id=") {
+			return parseErr(line, column, "invalid value %q, expected value=number,user_id=user", value)
+		}
+		m.User = strings.TrimPrefix(parts[1], "user_id=")
+		if m.User == "" {
+			return parseErr(line, column+len("value=")+len(parts[0])+1, "missing user_id")
+		}
+		value = parts[0]
+		column += len("value=")
+	}
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return parseErr(line, column, "invalid value %q", value)
+	}
+	m.Value = v
+
+	return nil
+}
+
+func (p MetricParser) parseTimestamp(line string, f field, m *Metric) error {
+	timestamp, err := strconv.ParseInt(f.text, 10, 64)
+	if err != nil && p.Lenient {
+		var fractional float64
+		if fractional, err = strconv.ParseFloat(f.text, 64); err == nil && !math.IsNaN(fractional) && !math.IsInf(fractional, 0) {
+			timestamp = int64(fractional)
+		} else if err == nil {
+			err = fmt.Errorf("not finite")
+		}
+	}
+	if err != nil {
+		return parseErr(line, f.column, "invalid timestamp %q", f.text)
+	}
+	m.Timestamp = timestamp
+
+	return nil
+}
+
+func (p MetricParser) parseAggregations(line string, f field, m *Metric) error {
+	parts := strings.Split(f.text, ",")
+	last := parts[len(parts)-1]
+	lastColumn := f.column + len(f.text) - len(last)
+
+	freq, err := strconv.Atoi(last)
+	if err != nil {
+		if !p.Lenient {
+			return parseErr(line, lastColumn, "invalid aggregation frequency %q", last)
+		}
+		freq = Freq10s
+	} else {
+		parts = parts[:len(parts)-1]
+	}
+
+	if freq <= 0 || (!p.Lenient && !knownFrequencies[AggregationFrequency(freq)]) {
+		return parseErr(line, lastColumn, "unsupported aggregation frequency %d", freq)
+	}
+	if len(parts) == 0 && !p.Lenient {
+		return parseErr(line, f.column, "missing aggregations before the frequency")
+	}
+
+	m.Frequency = AggregationFrequency(freq)
+	m.Aggregations = Aggregations{}
+
+	column := f.column
+	for _, agg := range parts {
+		if agg == "" && p.Lenient {
+			column++
+			continue
+		}
+		if _, ok := knownAggregations[Aggregation(agg)]; !ok && (!p.Lenient || agg == "") {
+			return parseErr(line, column, "unsupported aggregation %q", agg)
+		}
+		m.Aggregations.Add(Aggregation(agg))
+		column += len(agg) + 1
+	}
+
+	if len(m.Aggregations) == 0 {
+		// a frequency alone can't be encoded back, treat it as a metric without aggregations
+		m.Aggregations, m.Frequency = nil, 0
+	}
+
+	return nil
+}
+
+func parseErr(line string, column int, format string, args ...interface{}) *ParseError {
+	return &ParseError{Column: column, Text: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// MetricScanner parses a stream of newline separated metric lines, skipping empty lines.
+// Scan stops on read errors only, lines that fail to parse are returned by Metric as a *ParseError
+// with the line number set.
+type MetricScanner struct {
+	Parser MetricParser
+
+	scanner    *bufio.Scanner
+	lineNumber int
+	metric     Metric
+	err        error
+}
+
+func NewMetricScanner(r io.Reader) *MetricScanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), DefaultMaxBufferSize)
+
+	return &MetricScanner{scanner: scanner}
+}
+
+// Scan advances to the next non empty line, it returns false at the end of the input or on a read error.
+func (s *MetricScanner) Scan() bool {
+	for s.scanner.Scan() {
+		s.lineNumber++
+
+		line := strings.TrimSuffix(s.scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		s.metric, s.err = s.Parser.Parse(line)
+		if s.err != nil {
+			s.err.(*ParseError).Line = s.lineNumber
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// Metric returns the metric parsed by the last call to Scan.
+func (s *MetricScanner) Metric() (Metric, error) {
+	return s.metric, s.err
+}
+
+// Err returns the first read error.
+func (s *MetricScanner) Err() error {
+	return s.scanner.Err()
+}
+
+// ParseMetrics parses all the metric lines read from r, returning the first parse or read error.
+func (p MetricParser) ParseMetrics(r io.Reader) ([]Metric, error) {
+	scanner := NewMetricScanner(r)
+	scanner.Parser = p
+
+	var metrics []Metric
+	for scanner.Scan() {
+		m, err := scanner.Metric()
+		if err != nil {
+			return metrics, err
+		}
+		metrics = append(metrics, m)
+	}
+
+	return metrics, scanner.Err()
+}
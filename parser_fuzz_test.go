@@ -0,0 +1,89 @@
+//go:build go1.18
+// +build go1.18
+
+package statful
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// FuzzParseMetric checks that any line accepted by the parser encodes back to a line that parses to the same metric.
+// The first encoding may round the value to the six decimals written by MetricToString, so the comparison is done
+// between the second and third parse.
+func FuzzParseMetric(f *testing.F) {
+	f.Add("test.metric 1.000000 1585161000", false)
+	f.Add("test.metric,env=prod,host=a 10.500000 1585161000 avg,p90,60", false)
+	f.Add("test.metric,env=prod value=2.000000,user_id=jdoe 1585161000 count,sum,10", false)
+	f.Add("  test.metric,,env=prod\t 1   1585161000.75 median", true)
+
+	f.Fuzz(func(t *testing.T, line string, lenient bool) {
+		parser := MetricParser{Lenient: lenient}
+
+		first, err := parser.Parse(line)
+		if err != nil {
+			if _, ok := err.(*ParseError); !ok {
+				t.Fatalf("Parse(%q) returned %T, expected *ParseError", line, err)
+			}
+			return
+		}
+		if math.IsNaN(first.Value) || math.IsInf(first.Value, 0) {
+			return
+		}
+
+		second, err := parser.Parse(first.String())
+		if err != nil {
+			t.Fatalf("Parse(%q) failed on encoded %q: %v", line, first.String(), err)
+		}
+		if second.Name != first.Name || second.User != first.User || second.Timestamp != first.Timestamp ||
+			!reflect.DeepEqual(second.Tags, first.Tags) || !reflect.DeepEqual(second.Aggregations, first.Aggregations) {
+			t.Fatalf("Parse(%q) = %+v, re-parsed as %+v", line, first, second)
+		}
+
+		third, err := parser.Parse(second.String())
+		if err != nil || !reflect.DeepEqual(third, second) {
+			t.Fatalf("Parse(%q) = %+v, re-parsed as %+v (%v)", second.String(), second, third, err)
+		}
+	})
+}
+
+// FuzzMetricToString checks that metrics built from arbitrary fields survive an encode and parse round trip.
+// Fields the line format cannot represent, such as names with spaces or tags with commas, are skipped.
+func FuzzMetricToString(f *testing.F) {
+	f.Add("test.metric", "env", "prod", "", 1.5, int64(1585161000))
+	f.Add("test.metric", "", "", "jdoe", -10.25, int64(0))
+
+	f.Fuzz(func(t *testing.T, name, tagKey, tagValue, user string, value float64, timestamp int64) {
+		if name == "" || !encodable(name, ", =") || !encodable(tagKey, ", =") || !encodable(tagValue, ", ") || !encodable(user, ", ") {
+			return
+		}
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return
+		}
+
+		m := Metric{Name: name, Value: value, User: user, Tags: Tags{}, Timestamp: timestamp}
+		if tagKey != "" && tagValue != "" {
+			m.Tags[tagKey] = tagValue
+		}
+
+		parsed, err := ParseMetric(m.String())
+		if err != nil {
+			t.Fatalf("ParseMetric(%q) returned error: %v", m.String(), err)
+		}
+
+		// MetricToString writes six decimals
+		if math.Abs(parsed.Value-value) > 0.000001*math.Max(1, math.Abs(value)) {
+			t.Errorf("value %v parsed as %v", value, parsed.Value)
+		}
+		parsed.Value = value
+		if !reflect.DeepEqual(parsed, m) {
+			t.Errorf("ParseMetric(%q) returned: %+v, expected: %+v", m.String(), parsed, m)
+		}
+	})
+}
+
+func encodable(s, forbidden string) bool {
+	return !strings.ContainsAny(s, forbidden+"\t\r\n") && !strings.HasPrefix(s, "value=")
+}
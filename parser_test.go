@@ -0,0 +1,168 @@
+package statful
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMetricParser_Parse(t *testing.T) {
+	scenarios := []struct {
+		description string
+		lenient     bool
+		line        string
+		expected    Metric
+	}{
+		{
+			description: "metric without tags",
+			line:        "test.metric 1.500000 1585161000",
+			expected:    Metric{Name: "test.metric", Value: 1.5, Tags: Tags{}, Timestamp: 1585161000},
+		},
+		{
+			description: "metric with tags and aggregations",
+			line:        "test.metric,env=prod,host=a 10.000000 1585161000 avg,p90,60",
+			expected: Metric{
+				Name:         "test.metric",
+				Value:        10,
+				Tags:         Tags{"env": "prod", "host": "a"},
+				Timestamp:    1585161000,
+				Aggregations: Aggregations{AggAvg: nothing, AggP90: nothing},
+				Frequency:    Freq60s,
+			},
+		},
+		{
+			description: "metric with user",
+			line:        "test.metric,env=prod value=2.000000,user_id=jdoe 1585161000",
+			expected:    Metric{Name: "test.metric", Value: 2, User: "jdoe", Tags: Tags{"env": "prod"}, Timestamp: 1585161000},
+		},
+		{
+			description: "tag value containing an equal sign",
+			line:        "test.metric,query=a=b 1 1585161000",
+			expected:    Metric{Name: "test.metric", Value: 1, Tags: Tags{"query": "a=b"}, Timestamp: 1585161000},
+		},
+		{
+			description: "lenient whitespace, empty tags and fractional timestamp",
+			lenient:     true,
+			line:        "  test.metric,,env=prod\t 1   1585161000.75 ",
+			expected:    Metric{Name: "test.metric", Value: 1, Tags: Tags{"env": "prod"}, Timestamp: 1585161000},
+		},
+		{
+			description: "lenient unknown aggregation without frequency",
+			lenient:     true,
+			line:        "test.metric 1 1585161000 median",
+			expected: Metric{
+				Name:         "test.metric",
+				Value:        1,
+				Tags:         Tags{},
+				Timestamp:    1585161000,
+				Aggregations: Aggregations{"median": nothing},
+				Frequency:    Freq10s,
+			},
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			m, err := MetricParser{Lenient: s.lenient}.Parse(s.line)
+			if err != nil {
+				t.Fatalf("Parse() returned error: %v", err)
+			}
+
+			if !reflect.DeepEqual(m, s.expected) {
+				t.Errorf("Parse() returned: %+v, expected: %+v", m, s.expected)
+			}
+		})
+	}
+}
+
+func TestMetricParser_Errors(t *testing.T) {
+	scenarios := []struct {
+		description string
+		lenient     bool
+		line        string
+		column      int
+		msg         string
+	}{
+		{description: "empty line", line: "", column: 1, msg: "empty line"},
+		{description: "missing timestamp", line: "test.metric 1", column: 14, msg: "expected value and timestamp"},
+		{description: "double space", line: "test.metric  1 1585161000", column: 13, msg: "unexpected space"},
+		{description: "trailing field", line: "test.metric 1 1585161000 avg,10 extra", column: 33, msg: "unexpected field"},
+		{description: "missing name", line: ",env=prod 1 1585161000", column: 1, msg: "missing metric name"},
+		{description: "invalid tag", line: "test.metric,env=prod,host 1 1585161000", column: 22, msg: `invalid tag "host"`},
+		{description: "empty tag value", line: "test.metric,env= 1 1585161000", column: 13, msg: `invalid tag "env="`},
+		{description: "duplicate tag", line: "test.metric,env=a,env=b 1 1585161000", column: 19, msg: `duplicate tag "env"`},
+		{description: "invalid value", line: "test.metric one 1585161000", column: 13, msg: `invalid value "one"`},
+		{description: "invalid user value", line: "test.metric value=x,user_id=jdoe 1585161000", column: 19, msg: `invalid value "x"`},
+		{description: "missing user", line: "test.metric value=1,user_id= 1585161000", column: 21, msg: "missing user_id"},
+		{description: "invalid timestamp", line: "test.metric 1 1585161000.5", column: 15, msg: "invalid timestamp"},
+		{description: "unknown aggregation", line: "test.metric 1 1585161000 avg,median,10", column: 30, msg: `unsupported aggregation "median"`},
+		{description: "unknown frequency", line: "test.metric 1 1585161000 avg,15", column: 30, msg: "unsupported aggregation frequency 15"},
+		{description: "missing frequency", line: "test.metric 1 1585161000 avg", column: 26, msg: `invalid aggregation frequency "avg"`},
+		{description: "lenient invalid timestamp", lenient: true, line: "test.metric 1 NaN", column: 15, msg: "invalid timestamp"},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			_, err := MetricParser{Lenient: s.lenient}.Parse(s.line)
+			perr, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("Parse() returned: %v, expected a *ParseError", err)
+			}
+
+			if perr.Column != s.column || !strings.Contains(perr.Msg, s.msg) {
+				t.Errorf("Parse() returned: column %d %q, expected: column %d %q", perr.Column, perr.Msg, s.column, s.msg)
+			}
+		})
+	}
+}
+
+func TestMetricScanner(t *testing.T) {
+	input := "test.a 1 1585161000\n\ntest.b one 1585161000\r\ntest.c 3 1585161000\n"
+
+	scanner := NewMetricScanner(strings.NewReader(input))
+
+	var names []string
+	var errs []*ParseError
+	for scanner.Scan() {
+		m, err := scanner.Metric()
+		if err != nil {
+			errs = append(errs, err.(*ParseError))
+			continue
+		}
+		names = append(names, m.Name)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("Err() returned: %v", err)
+	}
+
+	if !reflect.DeepEqual(names, []string{"test.a", "test.c"}) {
+		t.Errorf("scanned metrics: %v", names)
+	}
+	if len(errs) != 1 || errs[0].Line != 3 || errs[0].Column != 8 {
+		t.Fatalf("scan errors: %v, expected an error on line 3, column 8", errs)
+	}
+	if errs[0].Error() != `line 3, column 8: invalid value "one"` {
+		t.Errorf("Error() returned: %s", errs[0].Error())
+	}
+}
+
+func TestMetricParser_RoundTrip(t *testing.T) {
+	metric := Metric{
+		Name:         "test.metric",
+		Value:        42.5,
+		User:         "jdoe",
+		Tags:         Tags{"env": "prod", "host": "a"},
+		Timestamp:    1585161000,
+		Aggregations: Aggregations{AggCount: nothing, AggSum: nothing},
+		Frequency:    Freq30s,
+	}
+
+	parsed, err := ParseMetric(metric.String())
+	if err != nil {
+		t.Fatalf("ParseMetric() returned error: %v", err)
+	}
+
+	if !reflect.DeepEqual(parsed, metric) {
+		t.Errorf("ParseMetric() returned: %+v, expected: %+v", parsed, metric)
+	}
+}
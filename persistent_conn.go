@@ -0,0 +1,247 @@
+package statful
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMaxBufferSize   = 1024 * 1024
+	DefaultMaxDatagramSize = 8192
+	DefaultMinBackoff      = 100 * time.Millisecond
+	DefaultMaxBackoff      = 30 * time.Second
+)
+
+var (
+	ErrBufferFull  = errors.New("send buffer full while reconnecting")
+	ErrLineTooLong = errors.New("metric line exceeds the maximum datagram size")
+	// ErrSendBuffered reports data kept by a socket sender while reconnecting, it is sent with a later write.
+	// The client counts it in Stats.MetricsBuffered instead of as flushed or dropped.
+	ErrSendBuffered = errors.New("data buffered while reconnecting")
+	// ErrPendingDiscarded reports the data buffered while reconnecting that was lost when the sender was closed.
+	ErrPendingDiscarded = errors.New("buffered data discarded on close")
+	errWaitingRedial    = errors.New("waiting to reconnect")
+)
+
+// persistentConn is a persistent connection shared by the socket senders.
+// It reconnects with exponential backoff after a failed dial or write and keeps the unsent lines,
+// up to maxBuffer bytes, until the connection is restored.
+// With datagramSize set the lines are written in datagrams of at most datagramSize bytes split on line boundaries.
+type persistentConn struct {
+	dial         func(ctx context.Context) (net.Conn, error)
+	writeTimeout time.Duration
+	maxBuffer    int
+	datagramSize int
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+
+	mu       sync.Mutex
+	conn     net.Conn
+	pending  bytes.Buffer
+	backoff  time.Duration
+	nextDial time.Time
+}
+
+// withDefaults replaces the unset limits with the package defaults.
+func (s *persistentConn) withDefaults() *persistentConn {
+	if s.maxBuffer <= 0 {
+		s.maxBuffer = DefaultMaxBufferSize
+	}
+	if s.minBackoff <= 0 {
+		s.minBackoff = DefaultMinBackoff
+	}
+	if s.maxBackoff <= 0 {
+		s.maxBackoff = DefaultMaxBackoff
+	}
+	if s.maxBackoff < s.minBackoff {
+		s.maxBackoff = s.minBackoff
+	}
+
+	return s
+}
+
+// write sends data as newline terminated lines. While disconnected the data is kept for the next write and
+// ErrSendBuffered is returned, unless the data doesn't fit in the buffer and ErrBufferFull is returned.
+func (s *persistentConn) write(ctx context.Context, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the new data is written after the lines already pending
+	start := s.pending.Len()
+	s.pending.Write(data)
+	if data[len(data)-1] != '\n' {
+		s.pending.WriteByte('\n')
+	}
+	end := s.pending.Len()
+
+	if err := s.flushPending(ctx); err == nil || err == ErrLineTooLong {
+		return err
+	}
+
+	if s.pending.Len() > s.maxBuffer {
+		// drop the part of the new data that wasn't written, the older lines are still sent once reconnected
+		unwritten := end - start
+		if written := end - s.pending.Len(); written > start {
+			unwritten -= written - start
+		}
+		s.pending.Truncate(s.pending.Len() - unwritten)
+		return ErrBufferFull
+	}
+
+	return ErrSendBuffered
+}
+
+// close flushes the pending data and closes the connection. The pending data that can't be sent, e.g. while
+// waiting to reconnect, is discarded and reported with ErrPendingDiscarded.
+func (s *persistentConn) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	if flushErr := s.flushPending(context.Background()); flushErr != nil && flushErr != ErrLineTooLong {
+		err = fmt.Errorf("%w: %d bytes: %v", ErrPendingDiscarded, s.pending.Len(), flushErr)
+		s.pending.Reset()
+	}
+
+	if s.conn != nil {
+		if closeErr := s.conn.Close(); err == nil {
+			err = closeErr
+		}
+		s.conn = nil
+	}
+
+	return err
+}
+
+func (s *persistentConn) flushPending(ctx context.Context) error {
+	if s.pending.Len() == 0 {
+		return nil
+	}
+
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	if deadline, ok := writeDeadline(ctx, s.writeTimeout); ok {
+		if err := s.conn.SetWriteDeadline(deadline); err != nil {
+			s.disconnect()
+			return err
+		}
+	}
+
+	if s.datagramSize > 0 {
+		return s.writeDatagrams()
+	}
+
+	n, err := s.conn.Write(s.pending.Bytes())
+	if err != nil {
+		// resend the line that was cut by the failed write
+		if cut := bytes.LastIndexByte(s.pending.Bytes()[:n], '\n'); cut >= 0 {
+			s.pending.Next(cut + 1)
+		}
+		s.disconnect()
+		return err
+	}
+
+	s.pending.Reset()
+	return nil
+}
+
+func (s *persistentConn) writeDatagrams() error {
+	n, err := writeDatagrams(s.conn, s.pending.Bytes(), s.datagramSize)
+	s.pending.Next(n)
+	if err != nil && err != ErrLineTooLong {
+		s.disconnect()
+	}
+
+	return err
+}
+
+// writeDatagrams writes data to conn in datagrams of at most size bytes split on line boundaries.
+// Lines longer than size are skipped and reported with ErrLineTooLong once the other lines are written.
+// It returns the number of bytes of data consumed.
+func writeDatagrams(conn io.Writer, data []byte, size int) (int, error) {
+	var tooLong error
+	n := 0
+	for n < len(data) {
+		chunk := nextDatagram(data[n:], size)
+		line := bytes.TrimSuffix(chunk, []byte("\n"))
+		if len(line) > size {
+			n += len(chunk)
+			tooLong = ErrLineTooLong
+			continue
+		}
+
+		if _, err := conn.Write(line); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+	}
+
+	return n, tooLong
+}
+
+// nextDatagram returns the longest run of whole lines from data that fits in size bytes,
+// ignoring the trailing newline. A line longer than size is returned on its own.
+func nextDatagram(data []byte, size int) []byte {
+	end := 0
+	for end < len(data) {
+		next := bytes.IndexByte(data[end:], '\n')
+		if next < 0 {
+			next = len(data)
+		} else {
+			next += end + 1
+		}
+
+		if end > 0 && len(bytes.TrimSuffix(data[:next], []byte("\n"))) > size {
+			break
+		}
+		end = next
+	}
+
+	return data[:end]
+}
+
+func (s *persistentConn) connect(ctx context.Context) error {
+	if time.Now().Before(s.nextDial) {
+		return errWaitingRedial
+	}
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		s.scheduleReconnect()
+		return err
+	}
+
+	s.conn = conn
+	s.backoff = 0
+	return nil
+}
+
+func (s *persistentConn) disconnect() {
+	_ = s.conn.Close()
+	s.conn = nil
+	s.scheduleReconnect()
+}
+
+func (s *persistentConn) scheduleReconnect() {
+	if s.backoff == 0 {
+		s.backoff = s.minBackoff
+	} else if s.backoff *= 2; s.backoff > s.maxBackoff {
+		s.backoff = s.maxBackoff
+	}
+
+	s.nextDial = time.Now().Add(s.backoff)
+}
@@ -0,0 +1,137 @@
+package statful
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNextDatagram(t *testing.T) {
+	scenarios := []struct {
+		description string
+		data        string
+		size        int
+		expected    string
+	}{
+		{
+			description: "all lines fit",
+			data:        "a 1 1\nb 2 2\n",
+			size:        20,
+			expected:    "a 1 1\nb 2 2\n",
+		},
+		{
+			description: "split on line boundary",
+			data:        "a 1 1\nb 2 2\nc 3 3",
+			size:        11,
+			expected:    "a 1 1\nb 2 2\n",
+		},
+		{
+			description: "trailing newline does not count",
+			data:        "a 1 1\nb 2 2",
+			size:        11,
+			expected:    "a 1 1\nb 2 2",
+		},
+		{
+			description: "line longer than the datagram",
+			data:        "aaaaaaaaaa 1 1\nb 2 2",
+			size:        5,
+			expected:    "aaaaaaaaaa 1 1\n",
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			chunk := nextDatagram([]byte(s.data), s.size)
+			if string(chunk) != s.expected {
+				t.Errorf("nextDatagram() returned: %q, expected: %q", chunk, s.expected)
+			}
+		})
+	}
+}
+
+// partialConn accepts up to limit bytes and then fails the writes.
+type partialConn struct {
+	net.Conn
+	limit   int
+	written bytes.Buffer
+}
+
+func (p *partialConn) Write(b []byte) (int, error) {
+	n := len(b)
+	if room := p.limit - p.written.Len(); n > room {
+		n = room
+	}
+	p.written.Write(b[:n])
+	if n < len(b) {
+		return n, errors.New("connection reset")
+	}
+
+	return n, nil
+}
+
+func (p *partialConn) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+func (p *partialConn) Close() error {
+	return nil
+}
+
+func TestPersistentConn_BufferFullAfterPartialWrite(t *testing.T) {
+	conn := &partialConn{limit: 20}
+	dials := 0
+	s := (&persistentConn{
+		dial: func(context.Context) (net.Conn, error) {
+			if dials++; dials == 1 {
+				return nil, errors.New("connection refused")
+			}
+			return conn, nil
+		},
+		maxBuffer:  10,
+		minBackoff: time.Nanosecond,
+	}).withDefaults()
+
+	if err := s.write(context.Background(), []byte("aaaa 1 1")); err != ErrSendBuffered {
+		t.Fatalf("expected ErrSendBuffered, got: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+
+	// the pending line and the first new line are written before the connection drops
+	if err := s.write(context.Background(), []byte("bbbbbb 2 2\ncccccc 3 3\ndddddd 4 4")); err != ErrBufferFull {
+		t.Fatalf("expected ErrBufferFull, got: %v", err)
+	}
+	if written := conn.written.String(); written != "aaaa 1 1\nbbbbbb 2 2\n" {
+		t.Errorf("unexpected written data: %q", written)
+	}
+	if s.pending.Len() != 0 {
+		t.Errorf("expected the unwritten new lines dropped, pending: %q", s.pending.String())
+	}
+}
+
+func TestPersistentConn_CloseDiscardsPending(t *testing.T) {
+	s := (&persistentConn{
+		dial: func(context.Context) (net.Conn, error) {
+			return nil, errors.New("connection refused")
+		},
+		minBackoff: time.Minute,
+	}).withDefaults()
+
+	if err := s.write(context.Background(), []byte("a 1 1")); err != ErrSendBuffered {
+		t.Fatalf("expected ErrSendBuffered, got: %v", err)
+	}
+
+	err := s.close()
+	if !errors.Is(err, ErrPendingDiscarded) || !strings.Contains(err.Error(), "6 bytes") {
+		t.Errorf("expected ErrPendingDiscarded reporting 6 bytes, got: %v", err)
+	}
+	if s.pending.Len() != 0 {
+		t.Errorf("expected the pending data discarded, pending: %q", s.pending.String())
+	}
+	if err := s.close(); err != nil {
+		t.Errorf("expected nothing to discard on a second close, got: %v", err)
+	}
+}
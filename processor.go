@@ -0,0 +1,143 @@
+package statful
+
+import (
+	"regexp"
+)
+
+// Processor rewrites a metric before it is buffered, returning false drops the metric.
+// Processors run in Configuration.Processors order on every Put and PutAggregated, after the global tags
+// are merged and before the observers are notified. m.Tags and m.Aggregations are copies the processor may change.
+type Processor interface {
+	Process(m *Metric) bool
+}
+
+// ProcessorFunc adapts a function to a Processor.
+type ProcessorFunc func(m *Metric) bool
+
+func (f ProcessorFunc) Process(m *Metric) bool {
+	return f(m)
+}
+
+// RenameMetric replaces the matches of Pattern in the metric name with Replacement, which may refer to
+// the submatches as in regexp.Regexp.ReplaceAllString.
+type RenameMetric struct {
+	Pattern     *regexp.Regexp
+	Replacement string
+}
+
+func (r RenameMetric) Process(m *Metric) bool {
+	m.Name = r.Pattern.ReplaceAllString(m.Name, r.Replacement)
+	return m.Name != ""
+}
+
+// AddTags sets Tags on every metric, replacing the values of existing tags.
+type AddTags struct {
+	Tags Tags
+}
+
+func (a AddTags) Process(m *Metric) bool {
+	if m.Tags == nil {
+		m.Tags = Tags{}
+	}
+	for k, v := range a.Tags {
+		m.Tags[k] = v
+	}
+
+	return true
+}
+
+// DropTags removes the tags named in Names.
+type DropTags struct {
+	Names []string
+}
+
+func (d DropTags) Process(m *Metric) bool {
+	for _, name := range d.Names {
+		delete(m.Tags, name)
+	}
+
+	return true
+}
+
+// RenameTags renames the tags by the Names mapping of old to new name.
+type RenameTags struct {
+	Names map[string]string
+}
+
+func (r RenameTags) Process(m *Metric) bool {
+	renamed := Tags{}
+	for from, to := range r.Names {
+		if v, ok := m.Tags[from]; ok {
+			delete(m.Tags, from)
+			renamed[to] = v
+		}
+	}
+	for k, v := range renamed {
+		m.Tags[k] = v
+	}
+
+	return true
+}
+
+// MapTagValues replaces the value of Tag by the Values mapping of old to new value, unmapped values are kept.
+type MapTagValues struct {
+	Tag    string
+	Values map[string]string
+}
+
+func (p MapTagValues) Process(m *Metric) bool {
+	if v, ok := m.Tags[p.Tag]; ok {
+		if mapped, ok := p.Values[v]; ok {
+			m.Tags[p.Tag] = mapped
+		}
+	}
+
+	return true
+}
+
+// AllowMetrics keeps only the metrics with a name matching one of Patterns.
+type AllowMetrics struct {
+	Patterns []*regexp.Regexp
+}
+
+func (a AllowMetrics) Process(m *Metric) bool {
+	return matchesAny(a.Patterns, m.Name)
+}
+
+// DenyMetrics drops the metrics with a name matching one of Patterns.
+type DenyMetrics struct {
+	Patterns []*regexp.Regexp
+}
+
+func (d DenyMetrics) Process(m *Metric) bool {
+	return !matchesAny(d.Patterns, m.Name)
+}
+
+func matchesAny(patterns []*regexp.Regexp, name string) bool {
+	for _, p := range patterns {
+		if p.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// process runs the processors on m, it returns false as soon as one of them drops the metric.
+// The aggregations are copied first, they may be shared, e.g. the default aggregations of Counter and Gauge.
+func process(processors []Processor, m *Metric) bool {
+	if len(processors) == 0 {
+		return true
+	}
+	if m.Aggregations != nil {
+		m.Aggregations = Aggregations{}.Merge(m.Aggregations)
+	}
+
+	for _, p := range processors {
+		if !p.Process(m) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,151 @@
+package statful
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestProcessors(t *testing.T) {
+	scenarios := []struct {
+		description string
+		processor   Processor
+		metric      Metric
+		expected    Metric
+		dropped     bool
+	}{
+		{
+			description: "rename metric",
+			processor:   RenameMetric{Pattern: regexp.MustCompile(`^app_(\w+)$`), Replacement: "app.$1"},
+			metric:      Metric{Name: "app_requests", Tags: Tags{}},
+			expected:    Metric{Name: "app.requests", Tags: Tags{}},
+		}, {
+			description: "rename metric to empty name",
+			processor:   RenameMetric{Pattern: regexp.MustCompile(`.*`)},
+			metric:      Metric{Name: "app.requests", Tags: Tags{}},
+			dropped:     true,
+		}, {
+			description: "add tags",
+			processor:   AddTags{Tags: Tags{"team": "platform", "env": "production"}},
+			metric:      Metric{Name: "app.requests", Tags: Tags{"env": "test", "host": "a"}},
+			expected:    Metric{Name: "app.requests", Tags: Tags{"team": "platform", "env": "production", "host": "a"}},
+		}, {
+			description: "drop tags",
+			processor:   DropTags{Names: []string{"host", "pod"}},
+			metric:      Metric{Name: "app.requests", Tags: Tags{"env": "test", "host": "a"}},
+			expected:    Metric{Name: "app.requests", Tags: Tags{"env": "test"}},
+		}, {
+			description: "rename tags",
+			processor:   RenameTags{Names: map[string]string{"environment": "env", "env": "environment"}},
+			metric:      Metric{Name: "app.requests", Tags: Tags{"environment": "test", "env": "prd"}},
+			expected:    Metric{Name: "app.requests", Tags: Tags{"env": "test", "environment": "prd"}},
+		}, {
+			description: "map tag values",
+			processor:   MapTagValues{Tag: "env", Values: map[string]string{"prd": "production"}},
+			metric:      Metric{Name: "app.requests", Tags: Tags{"env": "prd", "stage": "prd"}},
+			expected:    Metric{Name: "app.requests", Tags: Tags{"env": "production", "stage": "prd"}},
+		}, {
+			description: "map unmapped tag value",
+			processor:   MapTagValues{Tag: "env", Values: map[string]string{"prd": "production"}},
+			metric:      Metric{Name: "app.requests", Tags: Tags{"env": "test"}},
+			expected:    Metric{Name: "app.requests", Tags: Tags{"env": "test"}},
+		}, {
+			description: "allowed metric",
+			processor:   AllowMetrics{Patterns: []*regexp.Regexp{regexp.MustCompile(`^app\.`)}},
+			metric:      Metric{Name: "app.requests", Tags: Tags{}},
+			expected:    Metric{Name: "app.requests", Tags: Tags{}},
+		}, {
+			description: "not allowed metric",
+			processor:   AllowMetrics{Patterns: []*regexp.Regexp{regexp.MustCompile(`^app\.`)}},
+			metric:      Metric{Name: "debug.requests", Tags: Tags{}},
+			dropped:     true,
+		}, {
+			description: "denied metric",
+			processor:   DenyMetrics{Patterns: []*regexp.Regexp{regexp.MustCompile(`^debug\.`)}},
+			metric:      Metric{Name: "debug.requests", Tags: Tags{}},
+			dropped:     true,
+		}, {
+			description: "custom processor",
+			processor: ProcessorFunc(func(m *Metric) bool {
+				m.Value *= 1000
+				return true
+			}),
+			metric:   Metric{Name: "app.latency", Value: 0.5, Tags: Tags{}},
+			expected: Metric{Name: "app.latency", Value: 500, Tags: Tags{}},
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			m := s.metric
+			kept := s.processor.Process(&m)
+			if kept == s.dropped {
+				t.Fatalf("expected dropped %v, got %v", s.dropped, !kept)
+			}
+			if !s.dropped && !reflect.DeepEqual(m, s.expected) {
+				t.Errorf("unexpected metric:\n\texpected: %v\n\tactual: %v", s.expected, m)
+			}
+		})
+	}
+}
+
+func TestClient_Processors(t *testing.T) {
+	sender := &recordingSender{}
+	callerTags := Tags{"host": "a"}
+	client := New(Configuration{
+		DisableAutoFlush: true,
+		Tags:             Tags{"env": "prd"},
+		Sender:           sender,
+		Processors: []Processor{
+			DenyMetrics{Patterns: []*regexp.Regexp{regexp.MustCompile(`^debug\.`)}},
+			MapTagValues{Tag: "env", Values: map[string]string{"prd": "production"}},
+			DropTags{Names: []string{"host"}},
+		},
+	})
+
+	client.Put("app.requests", 1, callerTags, 1585161000, Aggregations{}, Freq10s, WithUser("user"))
+	client.Put("debug.requests", 1, callerTags, 1585161000, Aggregations{}, Freq10s)
+	client.PutAggregated("app.latency", 2, callerTags, 1585161001, AggAvg, Freq10s)
+	if err := client.FlushError(); err != nil {
+		t.Fatalf("unexpected flush error: %v", err)
+	}
+
+	expected := []string{
+		"app.requests,env=production value=1.000000,user_id=user 1585161000",
+		"app.latency,env=production 2.000000 1585161001",
+	}
+	if !reflect.DeepEqual(sender.payloads, expected) {
+		t.Errorf("unexpected payloads:\n\texpected: %q\n\tactual: %q", expected, sender.payloads)
+	}
+	if _, ok := callerTags["host"]; !ok {
+		t.Error("expected the caller tags to be left untouched")
+	}
+	if stats := client.Stats(); stats.MetricsFiltered != 1 || stats.MetricsPut != 2 {
+		t.Errorf("expected 1 filtered and 2 put metrics, got: %+v", stats)
+	}
+}
+
+func TestClient_ProcessorsAggregations(t *testing.T) {
+	sender := &recordingSender{}
+	client := New(Configuration{
+		DisableAutoFlush: true,
+		Sender:           sender,
+		Processors: []Processor{
+			ProcessorFunc(func(m *Metric) bool {
+				m.Aggregations.Add(AggAvg)
+				return true
+			}),
+		},
+	})
+
+	callerAggs := Aggregations{AggMax: nothing}
+	client.Counter("requests", 1, Tags{})
+	client.Put("latency", 1, Tags{}, 1585161000, callerAggs, Freq10s)
+
+	if !reflect.DeepEqual(counterAggregations, Aggregations{AggCount: nothing, AggSum: nothing}) {
+		t.Errorf("expected the default counter aggregations left untouched, got: %v", counterAggregations)
+	}
+	if !reflect.DeepEqual(callerAggs, Aggregations{AggMax: nothing}) {
+		t.Errorf("expected the caller aggregations left untouched, got: %v", callerAggs)
+	}
+}
@@ -0,0 +1,339 @@
+package statful
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	DefaultPrometheusSamples = 1024
+)
+
+var prometheusQuantiles = map[Aggregation]float64{AggP90: 0.9, AggP95: 0.95, AggP99: 0.99}
+
+// MetricObserver is notified of every metric put in a client, with the global tags already merged.
+// Observers are called synchronously from Put and PutAggregated and must not block.
+type MetricObserver interface {
+	ObserveMetric(m Metric)
+	ObserveAggregatedMetric(m Metric, agg Aggregation)
+}
+
+// PrometheusHandler is a MetricObserver serving the observed metrics in the Prometheus text exposition format.
+//
+// Counters, metrics with only the count and sum aggregations, are exposed as Prometheus counters with the _total suffix,
+// gauges, metrics with the last aggregation, as gauges and the other metrics, like timers, as summaries with the
+// quantiles of their percentile aggregations computed over the last MaxSamples values.
+// Already aggregated metrics are exposed as counters for the count and sum aggregations and as gauges otherwise.
+//
+// Names are prefixed by Namespace and mapped by NameMapper, which defaults to replacing the characters not allowed by
+// Prometheus, like dots, with underscores. Tags become labels with the same replacement in their keys.
+// A name keeps the type it was first observed with, and the metrics whose samples would clash with the _sum and
+// _count samples of a summary observed first are dropped.
+type PrometheusHandler struct {
+	Namespace  string
+	NameMapper func(name string) string
+	MaxSamples int
+
+	mu       sync.Mutex
+	families map[string]*promFamily
+}
+
+type promKind string
+
+const (
+	promCounter promKind = "counter"
+	promGauge   promKind = "gauge"
+	promSummary promKind = "summary"
+)
+
+type promFamily struct {
+	kind   promKind
+	series map[string]*promSeries
+}
+
+type promSeries struct {
+	labels    string
+	value     float64
+	count     int64
+	samples   []float64
+	next      int
+	quantiles []float64
+}
+
+func (p *PrometheusHandler) ObserveMetric(m Metric) {
+	kind := promKindOf(m.Aggregations)
+	name := p.name(m.Name)
+	if kind == promCounter && !strings.HasSuffix(name, "_total") {
+		name += "_total"
+	}
+
+	p.observe(name, kind, m.Tags, m.Value, m.Aggregations)
+}
+
+func (p *PrometheusHandler) ObserveAggregatedMetric(m Metric, agg Aggregation) {
+	kind := promGauge
+	name := p.name(m.Name)
+	if agg == AggCount || agg == AggSum {
+		kind = promCounter
+		name = strings.TrimSuffix(name, "_total") + "_" + string(agg) + "_total"
+	}
+
+	p.observe(name, kind, m.Tags, m.Value, nil)
+}
+
+func (p *PrometheusHandler) observe(name string, kind promKind, tags Tags, value float64, aggs Aggregations) {
+	labels := promLabels(tags)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.families == nil {
+		p.families = map[string]*promFamily{}
+	}
+	family, ok := p.families[name]
+	if !ok {
+		if p.clashes(name, kind) {
+			return
+		}
+		family = &promFamily{kind: kind, series: map[string]*promSeries{}}
+		p.families[name] = family
+	}
+	if family.kind != kind {
+		// a name can only have one type in the exposition format, keep the first one
+		return
+	}
+
+	series, ok := family.series[labels]
+	if !ok {
+		series = &promSeries{labels: labels}
+		family.series[labels] = series
+	}
+
+	switch kind {
+	case promCounter:
+		series.value += value
+	case promGauge:
+		series.value = value
+	case promSummary:
+		series.value += value
+		series.count++
+		series.addSample(value, p.maxSamples())
+		series.quantiles = quantilesOf(aggs)
+	}
+}
+
+func (s *promSeries) addSample(value float64, max int) {
+	if len(s.samples) < max {
+		s.samples = append(s.samples, value)
+		return
+	}
+
+	s.samples[s.next] = value
+	s.next = (s.next + 1) % max
+}
+
+// ServeHTTP writes the observed metrics in the Prometheus text exposition format.
+func (p *PrometheusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = p.Expose(w)
+}
+
+// Expose writes the observed metrics in the Prometheus text exposition format, sorted by name and labels.
+func (p *PrometheusHandler) Expose(w io.Writer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	names := make([]string, 0, len(p.families))
+	for name := range p.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		family := p.families[name]
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, family.kind)
+
+		keys := make([]string, 0, len(family.series))
+		for labels := range family.series {
+			keys = append(keys, labels)
+		}
+		sort.Strings(keys)
+
+		for _, labels := range keys {
+			series := family.series[labels]
+			if family.kind != promSummary {
+				writePromSample(&b, name, labels, "", series.value)
+				continue
+			}
+
+			sorted := append([]float64(nil), series.samples...)
+			sort.Float64s(sorted)
+			for _, q := range series.quantiles {
+				writePromSample(&b, name, labels, fmt.Sprintf(`quantile="%s"`, formatPromValue(q)), quantile(sorted, q))
+			}
+			writePromSample(&b, name+"_sum", labels, "", series.value)
+			writePromSample(&b, name+"_count", labels, "", float64(series.count))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// clashes reports whether a new family would expose the same sample names as an existing one, a summary also
+// exposes the _sum and _count samples.
+func (p *PrometheusHandler) clashes(name string, kind promKind) bool {
+	for _, suffix := range []string{"_sum", "_count"} {
+		if _, ok := p.families[name+suffix]; ok && kind == promSummary {
+			return true
+		}
+		if base := strings.TrimSuffix(name, suffix); base != name {
+			if family, ok := p.families[base]; ok && family.kind == promSummary {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (p *PrometheusHandler) name(name string) string {
+	if p.Namespace != "" {
+		name = p.Namespace + "_" + name
+	}
+	if p.NameMapper != nil {
+		return p.NameMapper(name)
+	}
+
+	return PrometheusName(name)
+}
+
+func (p *PrometheusHandler) maxSamples() int {
+	if p.MaxSamples <= 0 {
+		return DefaultPrometheusSamples
+	}
+
+	return p.MaxSamples
+}
+
+// PrometheusName maps a Statful metric name to a valid Prometheus metric name,
+// replacing the characters other than letters, digits, underscores and colons with underscores.
+func PrometheusName(name string) string {
+	return promSanitize(name, true)
+}
+
+func promSanitize(name string, colons bool) string {
+	b := []byte(name)
+	for idx, c := range b {
+		valid := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c == ':' && colons) || (c >= '0' && c <= '9' && idx > 0)
+		if !valid {
+			b[idx] = '_'
+		}
+	}
+
+	if len(b) == 0 {
+		return "_"
+	}
+
+	return string(b)
+}
+
+// promLabels encodes tags as sorted Prometheus labels, without the braces. Tags whose keys map to the same label
+// name keep the tag with the first key in sorted order.
+func promLabels(tags Tags) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	seen := make(map[string]bool, len(tags))
+	labels := make([]string, 0, len(tags))
+	for _, k := range keys {
+		key := promSanitize(k, false)
+		if strings.HasPrefix(key, "__") || seen[key] {
+			// reserved for internal use by Prometheus, or a duplicate label
+			continue
+		}
+		seen[key] = true
+		labels = append(labels, key+`="`+promEscape(tags[k])+`"`)
+	}
+	sort.Strings(labels)
+
+	return strings.Join(labels, ",")
+}
+
+func promEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func writePromSample(b *strings.Builder, name string, labels string, extra string, value float64) {
+	b.WriteString(name)
+	if labels != "" || extra != "" {
+		b.WriteByte('{')
+		b.WriteString(labels)
+		if labels != "" && extra != "" {
+			b.WriteByte(',')
+		}
+		b.WriteString(extra)
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatPromValue(value))
+	b.WriteByte('\n')
+}
+
+func formatPromValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func promKindOf(aggs Aggregations) promKind {
+	if len(aggs) == 0 {
+		return promGauge
+	}
+	if _, ok := aggs[AggLast]; ok {
+		return promGauge
+	}
+	for agg := range aggs {
+		if agg != AggCount && agg != AggSum {
+			return promSummary
+		}
+	}
+
+	return promCounter
+}
+
+func quantilesOf(aggs Aggregations) []float64 {
+	var quantiles []float64
+	for agg := range aggs {
+		if q, ok := prometheusQuantiles[agg]; ok {
+			quantiles = append(quantiles, q)
+		}
+	}
+	sort.Float64s(quantiles)
+
+	return quantiles
+}
+
+// quantile returns the nearest rank quantile q of the sorted values.
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	idx := int(q*float64(len(sorted))+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+
+	return sorted[idx]
+}
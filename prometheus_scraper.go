@@ -0,0 +1,364 @@
+package statful
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultScrapeInterval = 15 * time.Second
+	DefaultScrapeTimeout  = 5 * time.Second
+)
+
+// PrometheusType is the type of a metric family in the Prometheus text exposition format.
+type PrometheusType string
+
+const (
+	PrometheusCounter   PrometheusType = "counter"
+	PrometheusGauge     PrometheusType = "gauge"
+	PrometheusHistogram PrometheusType = "histogram"
+	PrometheusSummary   PrometheusType = "summary"
+	PrometheusUntyped   PrometheusType = "untyped"
+)
+
+// PrometheusSample is a single sample of the Prometheus text exposition format.
+// Type is the type of the family the sample belongs to, e.g. histogram for the name_bucket samples.
+// Timestamp is in milliseconds and zero when the sample has none.
+type PrometheusSample struct {
+	Name      string
+	Labels    Tags
+	Value     float64
+	Type      PrometheusType
+	Timestamp int64
+}
+
+// ParsePrometheus parses the Prometheus text exposition format. Samples of families without a TYPE line are untyped.
+// Errors are *ParseError values with the line and column of the invalid sample.
+func ParsePrometheus(r io.Reader) ([]PrometheusSample, error) {
+	types := map[string]PrometheusType{}
+
+	var samples []PrometheusSample
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), DefaultMaxBufferSize)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			fields := strings.Fields(line)
+			if len(fields) >= 4 && fields[1] == "TYPE" {
+				types[fields[2]] = PrometheusType(fields[3])
+			}
+			continue
+		}
+
+		sample, err := parsePrometheusSample(line)
+		if err != nil {
+			err.Line = lineNumber
+			return samples, err
+		}
+		sample.Type = prometheusTypeOf(sample.Name, types)
+		samples = append(samples, sample)
+	}
+
+	return samples, scanner.Err()
+}
+
+func parsePrometheusSample(line string) (PrometheusSample, *ParseError) {
+	s := PrometheusSample{Labels: Tags{}}
+
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return s, parseErr(line, 1, "expected metric name and value")
+	}
+	s.Name = line[:end]
+
+	pos := end
+	if line[pos] == '{' {
+		var err *ParseError
+		if pos, err = parsePrometheusLabels(line, pos+1, s.Labels); err != nil {
+			return s, err
+		}
+	}
+
+	fields := strings.Fields(line[pos:])
+	if len(fields) == 0 || len(fields) > 2 {
+		return s, parseErr(line, pos+1, "expected value and optional timestamp")
+	}
+
+	column := strings.Index(line[pos:], fields[0]) + pos + 1
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return s, parseErr(line, column, "invalid value %q", fields[0])
+	}
+	s.Value = value
+
+	if len(fields) == 2 {
+		timestamp, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return s, parseErr(line, strings.LastIndex(line, fields[1])+1, "invalid timestamp %q", fields[1])
+		}
+		s.Timestamp = timestamp
+	}
+
+	return s, nil
+}
+
+// parsePrometheusLabels parses the labels starting at pos, after the opening brace, and returns the position after
+// the closing brace.
+func parsePrometheusLabels(line string, pos int, labels Tags) (int, *ParseError) {
+	for {
+		for pos < len(line) && (line[pos] == ' ' || line[pos] == ',') {
+			pos++
+		}
+		if pos >= len(line) {
+			return pos, parseErr(line, pos+1, "unterminated labels")
+		}
+		if line[pos] == '}' {
+			return pos + 1, nil
+		}
+
+		eq := strings.IndexByte(line[pos:], '=')
+		if eq <= 0 {
+			return pos, parseErr(line, pos+1, "expected label=\"value\"")
+		}
+		key := strings.TrimSpace(line[pos : pos+eq])
+		pos += eq + 1
+
+		if pos >= len(line) || line[pos] != '"' {
+			return pos, parseErr(line, pos+1, "expected quoted label value")
+		}
+		pos++
+
+		var value strings.Builder
+		for ; pos < len(line) && line[pos] != '"'; pos++ {
+			if line[pos] == '\\' && pos+1 < len(line) {
+				pos++
+				switch line[pos] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(line[pos])
+				}
+				continue
+			}
+			value.WriteByte(line[pos])
+		}
+		if pos >= len(line) {
+			return pos, parseErr(line, pos+1, "unterminated label value")
+		}
+		pos++
+
+		labels[key] = value.String()
+	}
+}
+
+func prometheusTypeOf(name string, types map[string]PrometheusType) PrometheusType {
+	if t, ok := types[name]; ok {
+		return t
+	}
+
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if t, ok := types[strings.TrimSuffix(name, suffix)]; ok && strings.HasSuffix(name, suffix) && (t == PrometheusHistogram || t == PrometheusSummary) {
+			return t
+		}
+	}
+
+	return PrometheusUntyped
+}
+
+// PrometheusScraper periodically fetches Prometheus exposition endpoints and puts their samples in Client,
+// with the labels as tags merged with Tags. Whitespace, commas and equal signs in labels are replaced by underscores.
+//
+// Counters, and the buckets, sums and counts of histograms and summaries, are sent as the delta since the previous
+// scrape with CounterAggregations, the first scrape of a series only records its value and a series missing from
+// a scrape is forgotten. Gauges, untyped samples and
+// summary quantiles are sent with GaugeAggregations. Names are prefixed by Prefix followed by a dot when set.
+type PrometheusScraper struct {
+	Client   *Client
+	Targets  []string
+	Http     *http.Client
+	Interval time.Duration
+	Prefix   string
+	Tags     Tags
+
+	CounterAggregations Aggregations
+	GaugeAggregations   Aggregations
+	Frequency           AggregationFrequency
+
+	Logger Logger
+
+	deltas deltaTracker
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// Start scrapes the targets every Interval until Stop is called.
+func (p *PrometheusScraper) Start() {
+	interval := p.Interval
+	if interval <= 0 {
+		interval = DefaultScrapeInterval
+	}
+
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+
+	go func() {
+		defer close(p.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := p.Scrape(context.Background()); err != nil {
+				structuredLoggerFor(p.Logger).Log(LevelError, "Failed to scrape prometheus targets", "error", err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops the scrapes started by Start.
+func (p *PrometheusScraper) Stop() {
+	if p.stop != nil {
+		close(p.stop)
+		<-p.done
+		p.stop = nil
+	}
+}
+
+// Scrape fetches every target once and puts the samples in the client.
+// It returns a FlushErr with a SenderErr, indexed by target, for every target that failed.
+func (p *PrometheusScraper) Scrape(ctx context.Context) error {
+	var flushErr FlushErr
+	for idx, target := range p.Targets {
+		if err := p.scrape(ctx, target); err != nil {
+			flushErr = flushErr.appendErr(SenderErr{Index: idx, Err: fmt.Errorf("%s: %v", target, err)})
+		}
+	}
+
+	if flushErr.hasErrors() {
+		return flushErr
+	}
+
+	return nil
+}
+
+func (p *PrometheusScraper) scrape(ctx context.Context, target string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/plain; version=0.0.4")
+
+	client := p.Http
+	if client == nil {
+		client = &http.Client{Timeout: DefaultScrapeTimeout}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	samples, err := ParsePrometheus(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	started := p.deltas.time()
+	now := started.Unix()
+	for _, s := range samples {
+		if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+			continue
+		}
+
+		timestamp := now
+		if s.Timestamp > 0 {
+			timestamp = s.Timestamp / 1000
+		}
+
+		name := s.Name
+		if p.Prefix != "" {
+			name = p.Prefix + "." + name
+		}
+		tags := sanitizeTags(s.Labels).Merge(p.Tags)
+
+		if !p.isCumulative(s) {
+			_ = p.Client.Put(name, s.Value, tags, timestamp, p.gaugeAggregations(), p.frequency())
+			continue
+		}
+
+		delta, ok := p.deltas.delta(target+" "+seriesKey(s.Name, s.Labels), s.Value)
+		if !ok {
+			continue
+		}
+		_ = p.Client.Put(name, delta, tags, timestamp, p.counterAggregations(), p.frequency())
+	}
+
+	// series gone from the target are forgotten, a target that failed to scrape keeps its series
+	p.deltas.expire(target+" ", started)
+
+	return nil
+}
+
+// isCumulative tells if the sample is a monotonic counter that is sent as a delta.
+func (p *PrometheusScraper) isCumulative(s PrometheusSample) bool {
+	switch s.Type {
+	case PrometheusCounter:
+		return true
+	case PrometheusHistogram:
+		return true
+	case PrometheusSummary:
+		return strings.HasSuffix(s.Name, "_sum") || strings.HasSuffix(s.Name, "_count")
+	default:
+		return false
+	}
+}
+
+func (p *PrometheusScraper) counterAggregations() Aggregations {
+	if len(p.CounterAggregations) == 0 {
+		return counterAggregations
+	}
+
+	return p.CounterAggregations
+}
+
+func (p *PrometheusScraper) gaugeAggregations() Aggregations {
+	if len(p.GaugeAggregations) == 0 {
+		return gaugeAggregations
+	}
+
+	return p.GaugeAggregations
+}
+
+func (p *PrometheusScraper) frequency() AggregationFrequency {
+	if p.Frequency == 0 {
+		return Freq10s
+	}
+
+	return p.Frequency
+}
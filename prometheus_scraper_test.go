@@ -0,0 +1,275 @@
+package statful
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const exposition = `# HELP http_requests_total The total number of requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} 1027 1395066363000
+http_requests_total{method="post",code="400"}    3 1395066363000
+
+# TYPE queue_size gauge
+queue_size 12
+# untyped sample without TYPE
+build_info{version="1.2.\"3\"",path="C:\\bin"} 1
+
+# TYPE request_duration_seconds histogram
+request_duration_seconds_bucket{le="0.1"} 10
+request_duration_seconds_bucket{le="+Inf"} 12
+request_duration_seconds_sum 3.5
+request_duration_seconds_count 12
+
+# TYPE rpc_duration_seconds summary
+rpc_duration_seconds{quantile="0.99"} 0.25
+rpc_duration_seconds_sum 17
+rpc_duration_seconds_count 100
+`
+
+func TestParsePrometheus(t *testing.T) {
+	samples, err := ParsePrometheus(strings.NewReader(exposition))
+	if err != nil {
+		t.Fatalf("ParsePrometheus() returned error: %v", err)
+	}
+
+	expected := []PrometheusSample{
+		{Name: "http_requests_total", Labels: Tags{"method": "post", "code": "200"}, Value: 1027, Type: PrometheusCounter, Timestamp: 1395066363000},
+		{Name: "http_requests_total", Labels: Tags{"method": "post", "code": "400"}, Value: 3, Type: PrometheusCounter, Timestamp: 1395066363000},
+		{Name: "queue_size", Labels: Tags{}, Value: 12, Type: PrometheusGauge},
+		{Name: "build_info", Labels: Tags{"version": `1.2."3"`, "path": `C:\bin`}, Value: 1, Type: PrometheusUntyped},
+		{Name: "request_duration_seconds_bucket", Labels: Tags{"le": "0.1"}, Value: 10, Type: PrometheusHistogram},
+		{Name: "request_duration_seconds_bucket", Labels: Tags{"le": "+Inf"}, Value: 12, Type: PrometheusHistogram},
+		{Name: "request_duration_seconds_sum", Labels: Tags{}, Value: 3.5, Type: PrometheusHistogram},
+		{Name: "request_duration_seconds_count", Labels: Tags{}, Value: 12, Type: PrometheusHistogram},
+		{Name: "rpc_duration_seconds", Labels: Tags{"quantile": "0.99"}, Value: 0.25, Type: PrometheusSummary},
+		{Name: "rpc_duration_seconds_sum", Labels: Tags{}, Value: 17, Type: PrometheusSummary},
+		{Name: "rpc_duration_seconds_count", Labels: Tags{}, Value: 100, Type: PrometheusSummary},
+	}
+
+	if !reflect.DeepEqual(samples, expected) {
+		t.Errorf("ParsePrometheus() returned:\n%+v\nexpected:\n%+v", samples, expected)
+	}
+}
+
+func TestParsePrometheus_Errors(t *testing.T) {
+	scenarios := []struct {
+		description string
+		input       string
+		line        int
+		column      int
+	}{
+		{description: "missing value", input: "metric", line: 1, column: 1},
+		{description: "invalid value", input: "# TYPE metric gauge\nmetric abc", line: 2, column: 8},
+		{description: "unterminated labels", input: `metric{a="b" 1`, line: 1, column: 14},
+		{description: "unquoted label value", input: `metric{a=b} 1`, line: 1, column: 10},
+		{description: "invalid timestamp", input: "metric 1 now", line: 1, column: 10},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			_, err := ParsePrometheus(strings.NewReader(s.input))
+			perr, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("ParsePrometheus() returned: %v, expected a *ParseError", err)
+			}
+
+			if perr.Line != s.line || perr.Column != s.column {
+				t.Errorf("ParsePrometheus() returned: %v, expected line %d, column %d", perr, s.line, s.column)
+			}
+		})
+	}
+}
+
+func TestPrometheusScraper_Scrape(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		requests++
+		fmt.Fprintf(w, "# TYPE jobs_total counter\njobs_total{queue=\"a\"} %d\n# TYPE temperature gauge\ntemperature 21.5\n", 10*requests)
+	}))
+	defer srv.Close()
+
+	sender := &recordingSender{}
+	client := New(Configuration{DisableAutoFlush: true, Sender: sender, Logger: fmtLogger(fmt.Println)})
+	scraper := &PrometheusScraper{
+		Client:  client,
+		Targets: []string{srv.URL},
+		Prefix:  "app",
+		Tags:    Tags{"host": "a"},
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := scraper.Scrape(context.Background()); err != nil {
+			t.Fatalf("Scrape() returned error: %v", err)
+		}
+	}
+	if err := client.FlushError(); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, err := MetricParser{}.ParseMetrics(strings.NewReader(strings.Join(sender.payloads, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gauges, counters []Metric
+	for _, m := range metrics {
+		m.Timestamp = 0
+		if m.Name == "app.temperature" {
+			gauges = append(gauges, m)
+		} else {
+			counters = append(counters, m)
+		}
+	}
+
+	if len(gauges) != 2 || gauges[0].Value != 21.5 || !reflect.DeepEqual(gauges[0].Aggregations, gaugeAggregations) {
+		t.Errorf("gauges: %+v", gauges)
+	}
+
+	// the first scrape only records the counter value
+	expected := []Metric{{Name: "app.jobs_total", Value: 10, Tags: Tags{"queue": "a", "host": "a"}, Aggregations: counterAggregations, Frequency: Freq10s}}
+	if !reflect.DeepEqual(counters, expected) {
+		t.Errorf("counters: %+v, expected: %+v", counters, expected)
+	}
+}
+
+func TestPrometheusScraper_Failure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	scraper := &PrometheusScraper{
+		Client:  New(Configuration{DisableAutoFlush: true, Sender: &recordingSender{}}),
+		Targets: []string{"http://127.0.0.1:0/metrics", srv.URL},
+	}
+
+	err := scraper.Scrape(context.Background())
+	flushErr, ok := err.(FlushErr)
+	if !ok || len(flushErr.Errors()) != 2 {
+		t.Fatalf("Scrape() returned: %v, expected errors for both targets", err)
+	}
+	if senderErr, ok := flushErr.Errors()[1].(SenderErr); !ok || senderErr.Index != 1 || !strings.Contains(senderErr.Error(), "500") {
+		t.Errorf("second error: %v", flushErr.Errors()[1])
+	}
+}
+
+func TestDeltaTracker(t *testing.T) {
+	var deltas deltaTracker
+	key := seriesKey("jobs_total", Tags{"b": "2", "a": "1"})
+
+	for _, s := range []struct {
+		value    float64
+		expected float64
+		ok       bool
+	}{{100, 0, false}, {150, 50, true}, {20, 20, true}} {
+		if delta, ok := deltas.delta(key, s.value); delta != s.expected || ok != s.ok {
+			t.Errorf("delta(%v) returned: %v %v, expected: %v %v", s.value, delta, ok, s.expected, s.ok)
+		}
+	}
+
+	if key != "jobs_total{a=1,b=2}" {
+		t.Errorf("seriesKey() returned: %s", key)
+	}
+}
+
+func TestDeltaTracker_Expire(t *testing.T) {
+	now := time.Unix(1585161000, 0)
+	deltas := deltaTracker{now: func() time.Time { return now }}
+
+	deltas.delta("a old", 1)
+	deltas.delta("b old", 1)
+	now = now.Add(time.Minute)
+	deltas.delta("a new", 1)
+
+	deltas.expire("a ", now)
+	if _, ok := deltas.previous["a old"]; ok {
+		t.Error("expected the old series with the prefix to be removed")
+	}
+	if len(deltas.previous) != 2 {
+		t.Errorf("series: %v, expected the recent and the other prefix series to be kept", deltas.previous)
+	}
+
+	// idle series are removed once the ttl elapsed
+	now = now.Add(time.Second)
+	deltas.expireIdle(time.Minute)
+	if len(deltas.previous) != 1 {
+		t.Errorf("series: %v, expected only the recent series", deltas.previous)
+	}
+}
+
+func TestPrometheusScraper_UnsafeLabels(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "# TYPE temperature gauge\ntemperature{room=\"living room\",pos=\"a,b=c\",empty=\"\"} 21.5\n")
+	}))
+	defer srv.Close()
+
+	sender := &recordingSender{}
+	client := New(Configuration{DisableAutoFlush: true, Sender: sender})
+	scraper := &PrometheusScraper{Client: client, Targets: []string{srv.URL}}
+
+	if err := scraper.Scrape(context.Background()); err != nil {
+		t.Fatalf("Scrape() returned error: %v", err)
+	}
+	if err := client.FlushError(); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, err := MetricParser{}.ParseMetrics(strings.NewReader(strings.Join(sender.payloads, "\n")))
+	if err != nil {
+		t.Fatalf("sent invalid metric lines %q: %v", sender.payloads, err)
+	}
+	expected := Tags{"room": "living_room", "pos": "a_b_c"}
+	if len(metrics) != 1 || !reflect.DeepEqual(metrics[0].Tags, expected) {
+		t.Errorf("metrics: %+v, expected tags: %v", metrics, expected)
+	}
+}
+
+func TestPrometheusScraper_ExpiresSeries(t *testing.T) {
+	var mu sync.Mutex
+	bodies := []string{
+		"# TYPE jobs_total counter\njobs_total{queue=\"a\"} 10\njobs_total{queue=\"b\"} 10\n",
+		"# TYPE jobs_total counter\njobs_total{queue=\"a\"} 20\n",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		fmt.Fprint(w, bodies[0])
+		if len(bodies) > 1 {
+			bodies = bodies[1:]
+		}
+	}))
+	defer srv.Close()
+
+	scraper := &PrometheusScraper{
+		Client:  New(Configuration{DisableAutoFlush: true, Sender: &recordingSender{}}),
+		Targets: []string{srv.URL},
+	}
+	for i := 0; i < 2; i++ {
+		if err := scraper.Scrape(context.Background()); err != nil {
+			t.Fatalf("Scrape() returned error: %v", err)
+		}
+	}
+
+	// the series missing from the last scrape is forgotten
+	expected := []string{srv.URL + " " + seriesKey("jobs_total", Tags{"queue": "a"})}
+	var keys []string
+	for key := range scraper.deltas.previous {
+		keys = append(keys, key)
+	}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("tracked series: %v, expected: %v", keys, expected)
+	}
+}
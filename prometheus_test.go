@@ -0,0 +1,128 @@
+package statful
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPrometheusHandler(t *testing.T) {
+	prom := &PrometheusHandler{Namespace: "app"}
+	client := New(Configuration{
+		DisableAutoFlush: true,
+		Tags:             Tags{"env": "prod"},
+		Logger:           fmtLogger(fmt.Println),
+		Sender:           &recordingSender{},
+		Observers:        []MetricObserver{prom},
+	})
+
+	client.Counter("http.requests", 1, Tags{"status.code": "200"})
+	client.Counter("http.requests", 2, Tags{"status.code": "200"})
+	client.Counter("http.requests", 1, Tags{"status.code": "500"})
+	client.Gauge("queue.size", 10, Tags{"__internal": "x"})
+	client.Gauge("queue.size", 7, nil)
+	for value := 1; value <= 10; value++ {
+		client.Timer("http.duration", float64(value), Tags{"path": `/say"hi"`})
+	}
+	client.PutAggregated("jobs", 12, nil, 0, AggSum, Freq60s)
+	client.PutAggregated("jobs.latency", 0.25, nil, 0, AggAvg, Freq60s)
+
+	expected := strings.Join([]string{
+		`# TYPE app_http_duration summary`,
+		`app_http_duration{env="prod",path="/say\"hi\"",quantile="0.9"} 9`,
+		`app_http_duration_sum{env="prod",path="/say\"hi\""} 55`,
+		`app_http_duration_count{env="prod",path="/say\"hi\""} 10`,
+		`# TYPE app_http_requests_total counter`,
+		`app_http_requests_total{env="prod",status_code="200"} 3`,
+		`app_http_requests_total{env="prod",status_code="500"} 1`,
+		`# TYPE app_jobs_latency gauge`,
+		`app_jobs_latency{env="prod"} 0.25`,
+		`# TYPE app_jobs_sum_total counter`,
+		`app_jobs_sum_total{env="prod"} 12`,
+		`# TYPE app_queue_size gauge`,
+		`app_queue_size{env="prod"} 7`,
+	}, "\n") + "\n"
+
+	rec := httptest.NewRecorder()
+	prom.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if rec.Body.String() != expected {
+		t.Errorf("exposed:\n%s\nexpected:\n%s", rec.Body.String(), expected)
+	}
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("content type: %s", rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestPrometheusHandler_Samples(t *testing.T) {
+	prom := &PrometheusHandler{MaxSamples: 4}
+	for value := 1; value <= 10; value++ {
+		prom.ObserveMetric(Metric{Name: "latency", Value: float64(value), Aggregations: Aggregations{AggP99: nothing}})
+	}
+
+	var b strings.Builder
+	if err := prom.Expose(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the last 4 samples, 7 to 10, are used for the quantiles
+	if !strings.Contains(b.String(), `latency{quantile="0.99"} 10`) || !strings.Contains(b.String(), "latency_count 10") {
+		t.Errorf("exposed:\n%s", b.String())
+	}
+
+	prom = &PrometheusHandler{MaxSamples: 4}
+	for _, value := range []float64{100, 1, 2, 3, 4} {
+		prom.ObserveMetric(Metric{Name: "latency", Value: value, Aggregations: Aggregations{AggP90: nothing}})
+	}
+	b.Reset()
+	_ = prom.Expose(&b)
+	if !strings.Contains(b.String(), `latency{quantile="0.9"} 4`) {
+		t.Errorf("exposed:\n%s", b.String())
+	}
+}
+
+func TestPrometheusHandler_Clashes(t *testing.T) {
+	prom := &PrometheusHandler{}
+	prom.ObserveMetric(Metric{Name: "latency", Value: 1, Aggregations: Aggregations{AggP90: nothing}})
+	prom.ObserveMetric(Metric{Name: "latency.count", Value: 5, Aggregations: Aggregations{AggLast: nothing}})
+	prom.ObserveMetric(Metric{Name: "size_sum", Value: 2, Aggregations: Aggregations{AggLast: nothing}})
+	prom.ObserveMetric(Metric{Name: "size", Value: 3, Aggregations: Aggregations{AggP90: nothing}})
+	prom.ObserveMetric(Metric{Name: "requests", Value: 1, Tags: Tags{"status.code": "200", "status_code": "500"}, Aggregations: Aggregations{AggLast: nothing}})
+
+	var b strings.Builder
+	if err := prom.Expose(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := strings.Join([]string{
+		`# TYPE latency summary`,
+		`latency{quantile="0.9"} 1`,
+		`latency_sum 1`,
+		`latency_count 1`,
+		`# TYPE requests gauge`,
+		`requests{status_code="200"} 1`,
+		`# TYPE size_sum gauge`,
+		`size_sum 2`,
+	}, "\n") + "\n"
+	if b.String() != expected {
+		t.Errorf("exposed:\n%s\nexpected:\n%s", b.String(), expected)
+	}
+}
+
+func TestPrometheusName(t *testing.T) {
+	scenarios := map[string]string{
+		"http.requests":   "http_requests",
+		"ns:metric-name":  "ns:metric_name",
+		"1st.metric":      "_st_metric",
+		"already_valid_1": "already_valid_1",
+		"":                "_",
+	}
+
+	for name, expected := range scenarios {
+		if got := PrometheusName(name); got != expected {
+			t.Errorf("PrometheusName(%q) returned: %q, expected: %q", name, got, expected)
+		}
+	}
+}
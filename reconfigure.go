@@ -0,0 +1,210 @@
+package statful
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+type reconfiguration struct {
+	tags          *Tags
+	flushSize     *int
+	flushInterval *time.Duration
+	dryRun        *bool
+	sender        Sender
+	processors    *[]Processor
+}
+
+// ReconfigureOption changes a setting of a running client, see Client.Reconfigure.
+type ReconfigureOption func(*reconfiguration)
+
+// WithTags replaces the global tags added to every metric.
+func WithTags(tags Tags) ReconfigureOption {
+	return func(r *reconfiguration) {
+		r.tags = &tags
+	}
+}
+
+// WithFlushSize replaces the maximum number of buffered metrics, zero applies DefaultFlushSize.
+func WithFlushSize(size int) ReconfigureOption {
+	return func(r *reconfiguration) {
+		r.flushSize = &size
+	}
+}
+
+// WithFlushInterval restarts the periodic flush with a new interval, zero stops it.
+func WithFlushInterval(interval time.Duration) ReconfigureOption {
+	return func(r *reconfiguration) {
+		r.flushInterval = &interval
+	}
+}
+
+// WithDryRun enables or disables the dry run mode.
+func WithDryRun(dryRun bool) ReconfigureOption {
+	return func(r *reconfiguration) {
+		r.dryRun = &dryRun
+	}
+}
+
+// WithSender replaces the sender of the metrics and events. The previous sender is always retired, its buffered
+// metrics and events flushed and itself closed when it is an io.Closer, so pass a new sender.
+func WithSender(sender Sender) ReconfigureOption {
+	return func(r *reconfiguration) {
+		r.sender = sender
+	}
+}
+
+// WithProcessors replaces the processors run on every metric.
+func WithProcessors(processors ...Processor) ReconfigureOption {
+	return func(r *reconfiguration) {
+		r.processors = &processors
+	}
+}
+
+// retiredSender holds a replaced sender along with the metrics and events buffered for it.
+type retiredSender struct {
+	sender         Sender
+	metrics        drained
+	events         []Event
+	eventsDryRun   bool
+	eventsFlushing *sync.WaitGroup
+}
+
+// Reconfigure validates and applies the options at once, either every option is applied or, on a *ConfigError,
+// none is. A new sender is validated like in NewWithError. When the sender is replaced, the buffered metrics and
+// events are flushed to the previous sender, which is closed once its pending flushes are done. Otherwise
+// buffered metrics are kept: metrics drained before the call are sent with the previous dry run mode, the
+// remaining ones with the new settings. A smaller flush size flushes a buffer that already reached it.
+func (c *Client) Reconfigure(opts ...ReconfigureOption) error {
+	r := &reconfiguration{}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	retired, err := c.reconfigure(r)
+	if err != nil {
+		return err
+	}
+
+	if retired != nil {
+		c.retire(retired)
+	}
+
+	return nil
+}
+
+func (c *Client) reconfigure(r *reconfiguration) (*retiredSender, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.buffer.mu.Lock()
+	defer c.buffer.mu.Unlock()
+
+	c.eventBuffer.mu.Lock()
+	defer c.eventBuffer.mu.Unlock()
+
+	invalid := func(key string, format string, args ...interface{}) (*retiredSender, error) {
+		return nil, &ConfigError{Key: key, Msg: fmt.Sprintf(format, args...)}
+	}
+
+	if r.flushSize != nil {
+		if *r.flushSize < 0 {
+			return invalid("FlushSize", "must not be negative, got %d", *r.flushSize)
+		}
+		if *r.flushSize == 0 {
+			*r.flushSize = DefaultFlushSize
+		}
+	}
+
+	if r.flushInterval != nil {
+		interval := *r.flushInterval
+		if interval < 0 {
+			return invalid("FlushInterval", "must not be negative, got %v", interval)
+		}
+		if interval > 0 && c.buffer.disableAutoFlush {
+			return invalid("FlushInterval", "must not be set with DisableAutoFlush, got %v", interval)
+		}
+		if interval > 0 && interval < MinFlushInterval {
+			return invalid("FlushInterval", "must be at least %v, got %v", MinFlushInterval, interval)
+		}
+	}
+
+	if r.tags != nil {
+		for k := range *r.tags {
+			if k == "" {
+				return invalid("Tags", "must not have an empty name")
+			}
+		}
+	}
+
+	dryRun := c.buffer.dryRun
+	if r.dryRun != nil {
+		dryRun = *r.dryRun
+	}
+	if r.sender != nil || r.dryRun != nil {
+		sender := c.buffer.Sender
+		if r.sender != nil {
+			sender = r.sender
+		}
+		if err := validateSender(sender, dryRun); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.tags != nil {
+		c.globalTags = *r.tags
+	}
+	if r.processors != nil {
+		c.processors = *r.processors
+	}
+
+	var retired *retiredSender
+	if r.sender != nil {
+		retired = &retiredSender{
+			sender:         c.buffer.Sender,
+			metrics:        c.buffer.drainBuffers(),
+			events:         c.eventBuffer.drainBuffers(),
+			eventsDryRun:   c.eventBuffer.dryRun,
+			eventsFlushing: c.eventBuffer.flushingGroup(),
+		}
+		// the flushes started from now on use the new sender
+		c.buffer.flushing, c.eventBuffer.flushing = nil, nil
+		c.buffer.Sender, c.eventBuffer.Sender = r.sender, r.sender
+	}
+	c.buffer.dryRun, c.eventBuffer.dryRun = dryRun, dryRun
+
+	if r.flushSize != nil {
+		c.buffer.flushSize = *r.flushSize
+		if !c.buffer.disableAutoFlush && c.buffer.metricCount >= c.buffer.flushSize {
+			go c.buffer.flushBuffers(context.Background(), c.buffer.drainBuffers())
+		}
+	}
+
+	if r.flushInterval != nil {
+		if interval := *r.flushInterval; interval > 0 {
+			c.startFlushInterval(interval)
+		} else {
+			c.stopFlushInterval()
+		}
+	}
+
+	return retired, nil
+}
+
+// retire flushes the metrics and events buffered for the replaced sender, waits for its pending flushes and
+// closes it when it is an io.Closer.
+func (c *Client) retire(r *retiredSender) {
+	_ = c.buffer.flushBuffers(context.Background(), r.metrics)
+	_ = c.eventBuffer.flushBuffers(context.Background(), r.events, r.sender, r.eventsDryRun)
+
+	r.metrics.flushing.Wait()
+	r.eventsFlushing.Wait()
+
+	if closer, ok := r.sender.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			structuredLoggerFor(c.buffer.Logger).Log(LevelWarn, "Failed to close the previous sender", "error", err)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package statful
+
+import (
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type closingSender struct {
+	recordingSender
+	closed bool
+}
+
+func (c *closingSender) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+
+	return nil
+}
+
+// taggedSender is not comparable, it prefixes the payloads with the tags of the sender.
+type taggedSender struct {
+	tags []string
+	sent *[]string
+}
+
+func (s taggedSender) Send(data io.Reader) error {
+	payload, err := ioutil.ReadAll(data)
+	*s.sent = append(*s.sent, strings.Join(s.tags, ",")+": "+string(payload))
+	return err
+}
+
+func (s taggedSender) SendAggregated(data io.Reader, agg Aggregation, freq AggregationFrequency) error {
+	return s.Send(data)
+}
+
+func (s taggedSender) SendEvents(data io.Reader) error {
+	return s.Send(data)
+}
+
+func TestClient_Reconfigure(t *testing.T) {
+	previous := &closingSender{}
+	next := &encodingRecordingSender{encoder: GraphiteEncoder{}}
+	client := New(Configuration{DisableAutoFlush: true, Tags: Tags{"env": "test"}, Sender: previous})
+
+	client.Put("test.demo.metric", 100, Tags{}, 1585161000, Aggregations{}, Freq10s)
+	client.Event(Event{EventId: "1"})
+
+	err := client.Reconfigure(WithSender(next), WithTags(Tags{"env": "prod"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	client.Put("test.demo.metric", 200, Tags{}, 1585161001, Aggregations{}, Freq10s)
+	if err := client.FlushError(); err != nil {
+		t.Fatalf("unexpected flush error: %v", err)
+	}
+
+	expected := []string{"test.demo.metric,env=test 100.000000 1585161000"}
+	if len(previous.payloads) != 2 || !reflect.DeepEqual(previous.payloads[:1], expected) || !strings.HasPrefix(previous.payloads[1], `[{"eventId":"1",`) {
+		t.Errorf("expected buffered metrics and events sent to the previous sender:\n\texpected: %q\n\tactual: %q", expected, previous.payloads)
+	}
+	if !previous.closed {
+		t.Error("expected the previous sender closed")
+	}
+
+	expected = []string{"test.demo.metric;env=prod 200 1585161001"}
+	if !reflect.DeepEqual(next.payloads, expected) {
+		t.Errorf("expected new metrics sent to the new sender:\n\texpected: %q\n\tactual: %q", expected, next.payloads)
+	}
+}
+
+func TestClient_Reconfigure_NonComparableSender(t *testing.T) {
+	var sent []string
+	client := New(Configuration{DisableAutoFlush: true, Sender: taggedSender{tags: []string{"previous"}, sent: &sent}})
+
+	client.Put("test.demo.metric", 100, Tags{}, 1585161000, Aggregations{}, Freq10s)
+	if err := client.Reconfigure(WithSender(taggedSender{tags: []string{"next"}, sent: &sent})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client.Put("test.demo.metric", 200, Tags{}, 1585161001, Aggregations{}, Freq10s)
+	if err := client.FlushError(); err != nil {
+		t.Fatalf("unexpected flush error: %v", err)
+	}
+
+	expected := []string{"previous: test.demo.metric 100.000000 1585161000", "next: test.demo.metric 200.000000 1585161001"}
+	if !reflect.DeepEqual(sent, expected) {
+		t.Errorf("unexpected payloads:\n\texpected: %q\n\tactual: %q", expected, sent)
+	}
+}
+
+func TestClient_Reconfigure_UnchangedSender(t *testing.T) {
+	// the sender isn't validated by New, only when it or the dry run mode is reconfigured
+	client := New(Configuration{DisableAutoFlush: true, Sender: &TcpSender{}})
+
+	if err := client.Reconfigure(WithFlushSize(10), WithTags(Tags{"env": "prod"})); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err, ok := client.Reconfigure(WithDryRun(false)).(*ConfigError); !ok || err.Key != "Sender.Address" {
+		t.Errorf("expected a *ConfigError for Sender.Address, got: %v", err)
+	}
+}
+
+func TestClient_Reconfigure_Invalid(t *testing.T) {
+	scenarios := []struct {
+		description string
+		opts        []ReconfigureOption
+		key         string
+	}{
+		{
+			description: "negative flush size",
+			opts:        []ReconfigureOption{WithFlushSize(-1)},
+			key:         "FlushSize",
+		}, {
+			description: "flush interval with auto flush disabled",
+			opts:        []ReconfigureOption{WithFlushInterval(time.Second)},
+			key:         "FlushInterval",
+		}, {
+			description: "empty tag name",
+			opts:        []ReconfigureOption{WithTags(Tags{"": "value"})},
+			key:         "Tags",
+		}, {
+			description: "disabling dry run without sender",
+			opts:        []ReconfigureOption{WithTags(Tags{"env": "prod"}), WithDryRun(false)},
+			key:         "Sender",
+		}, {
+			description: "sender without address",
+			opts:        []ReconfigureOption{WithSender(&TcpSender{})},
+			key:         "Sender.Address",
+		}, {
+			description: "http sender without token",
+			opts:        []ReconfigureOption{WithSender(&HttpSender{}), WithDryRun(false)},
+			key:         "Sender.Token",
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			var lines []string
+			client := New(Configuration{
+				DisableAutoFlush: true,
+				DryRun:           true,
+				Tags:             Tags{"env": "test"},
+				Logger: fmtLogger(func(v ...interface{}) (int, error) {
+					lines = append(lines, v[1].(string))
+					return 0, nil
+				}),
+			})
+
+			err := client.Reconfigure(s.opts...)
+			cfgErr, ok := err.(*ConfigError)
+			if !ok || cfgErr.Key != s.key {
+				t.Fatalf("expected a *ConfigError for %s, got: %v", s.key, err)
+			}
+
+			client.Put("test.demo.metric", 100, Tags{}, 1585161000, Aggregations{}, Freq10s)
+			client.Flush()
+
+			expected := "test.demo.metric,env=test 100.000000 1585161000"
+			if len(lines) != 1 || lines[0] != expected {
+				t.Errorf("expected the configuration unchanged:\n\texpected: %q\n\tactual: %q", expected, lines)
+			}
+		})
+	}
+}
+
+func TestClient_Reconfigure_FlushSize(t *testing.T) {
+	data := make(chan []byte, 1)
+	client := New(Configuration{FlushSize: 10, Sender: &ChannelSender{data: data}})
+
+	client.Put("test.demo.metric", 100, Tags{}, 1585161000, Aggregations{}, Freq10s)
+	client.Put("test.demo.metric", 200, Tags{}, 1585161001, Aggregations{}, Freq10s)
+
+	if err := client.Reconfigure(WithFlushSize(2)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	select {
+	case d := <-data:
+		expected := "test.demo.metric 100.000000 1585161000\ntest.demo.metric 200.000000 1585161001"
+		if string(d) != expected {
+			t.Errorf("unexpected flush:\n\texpected: %q\n\tactual: %q", expected, string(d))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a flush once the buffer reached the new flush size")
+	}
+}
+
+func TestClient_Reconfigure_FlushInterval(t *testing.T) {
+	data := make(chan []byte, 100)
+	client := New(Configuration{FlushSize: 1000, FlushInterval: time.Hour, Sender: &ChannelSender{data: data}})
+	defer client.StopFlushInterval()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				client.Put("test.demo.metric", float64(j), Tags{}, 1585161000, Aggregations{}, Freq10s)
+				_ = client.Reconfigure(WithTags(Tags{"env": "test"}), WithFlushInterval(MinFlushInterval))
+			}
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case <-data:
+	case <-time.After(time.Second):
+		t.Fatal("expected a flush with the new interval")
+	}
+
+	if err := client.Reconfigure(WithFlushInterval(0)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.ticker != nil {
+		t.Error("expected the periodic flush to be stopped")
+	}
+}
@@ -3,6 +3,7 @@ package statful
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -20,46 +21,150 @@ type Sender interface {
 	SendAggregated(data io.Reader, agg Aggregation, frequency AggregationFrequency) error
 }
 
+// ContextSender is implemented by senders that can be cancelled or given a deadline through a context.
+// The buffers use it when the configured Sender implements it.
+type ContextSender interface {
+	Sender
+	SendContext(ctx context.Context, data io.Reader) error
+	SendEventsContext(ctx context.Context, data io.Reader) error
+	SendAggregatedContext(ctx context.Context, data io.Reader, agg Aggregation, frequency AggregationFrequency) error
+}
+
+var ErrUnsupportedOperation = errors.New("UNSUPPORTED_OPERATION")
+
+func sendContext(ctx context.Context, sender Sender, data io.Reader) error {
+	if cs, ok := sender.(ContextSender); ok {
+		return cs.SendContext(ctx, data)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return sender.Send(data)
+}
+
+func sendEventsContext(ctx context.Context, sender Sender, data io.Reader) error {
+	if cs, ok := sender.(ContextSender); ok {
+		return cs.SendEventsContext(ctx, data)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return sender.SendEvents(data)
+}
+
+func sendAggregatedContext(ctx context.Context, sender Sender, data io.Reader, agg Aggregation, freq AggregationFrequency) error {
+	if cs, ok := sender.(ContextSender); ok {
+		return cs.SendAggregatedContext(ctx, data, agg, freq)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return sender.SendAggregated(data, agg, freq)
+}
+
 const (
 	epEvents            = "/insights/event"
 	epMetrics           = "/tel/v2.0/metrics"
 	epMetricsAggregated = "/tel/v2.0/aggregation/:agg/frequency/:freq"
 	jsonEncoding        = "application/json"
+	ndjsonEncoding      = "application/x-ndjson"
 	plainTextEncoding   = "text/plain"
 )
 
+// HttpSender sends metrics and events to the Statful API. Url defaults to DefaultUrl and a nil Http
+// to a client with DefaultHttpTimeout.
 type HttpSender struct {
 	Http          *http.Client
 	Url           string
 	BasePath      string
 	Token         string
 	NoCompression bool
+
+	// Serializer defines the events payload format of this sender, defaults to Configuration.EventSerializer.
+	Serializer EventSerializer
 }
 
-func (h *HttpSender) Send(data io.Reader) error {
-	p := h.Url + h.BasePath + epMetrics
+func (h *HttpSender) EventSerializer() EventSerializer {
+	return h.Serializer
+}
 
-	return h.do(http.MethodPut, p, plainTextEncoding, data)
+// Encoder returns StatfulEncoder, the only metrics format accepted by the Statful API.
+func (h *HttpSender) Encoder() Encoder {
+	return StatfulEncoder{}
 }
 
-func (h *HttpSender) SendEvents(data io.Reader) error {
-	url := h.Url + h.BasePath + epEvents
+func (h *HttpSender) Send(data io.Reader) error {
+	return h.SendContext(context.Background(), data)
+}
 
-	return h.do(http.MethodPut, url, jsonEncoding, data)
+func (h *HttpSender) SendEvents(data io.Reader) error {
+	return h.SendEventsContext(context.Background(), data)
 }
 
 func (h *HttpSender) SendAggregated(data io.Reader, agg Aggregation, freq AggregationFrequency) error {
-	p := h.Url + h.BasePath + epMetricsAggregated
+	return h.SendAggregatedContext(context.Background(), data, agg, freq)
+}
+
+func (h *HttpSender) SendContext(ctx context.Context, data io.Reader) error {
+	p := h.url() + h.BasePath + epMetrics
+
+	return h.do(ctx, http.MethodPut, p, plainTextEncoding, data)
+}
+
+// SendEventsContext sends a payload of the sender Serializer, JsonArraySerializer by default.
+func (h *HttpSender) SendEventsContext(ctx context.Context, data io.Reader) error {
+	return h.sendEventsPayload(ctx, data, contentTypeOf(eventSerializerFor(h, nil)))
+}
+
+// sendEvents labels the events with the content type of the serializer that produced them.
+func (h *HttpSender) sendEvents(ctx context.Context, b eventBatch) error {
+	data, serializer, err := b.serialize(h)
+	if err != nil {
+		return err
+	}
+
+	return h.sendEventsPayload(ctx, data, contentTypeOf(serializer))
+}
+
+func (h *HttpSender) sendEventsPayload(ctx context.Context, data io.Reader, contentType string) error {
+	url := h.url() + h.BasePath + epEvents
+
+	return h.do(ctx, http.MethodPut, url, contentType, data)
+}
+
+func (h *HttpSender) SendAggregatedContext(ctx context.Context, data io.Reader, agg Aggregation, freq AggregationFrequency) error {
+	p := h.url() + h.BasePath + epMetricsAggregated
 	p = strings.Replace(p, ":agg", string(agg), -1)
 	p = strings.Replace(p, ":freq", strconv.Itoa(int(freq)), -1)
 
-	return h.do(http.MethodPut, p, plainTextEncoding, data)
+	return h.do(ctx, http.MethodPut, p, plainTextEncoding, data)
+}
+
+var defaultHttpClient = &http.Client{Timeout: DefaultHttpTimeout}
+
+func (h *HttpSender) url() string {
+	if h.Url == "" {
+		return DefaultUrl
+	}
+
+	return h.Url
 }
 
-func (h *HttpSender) do(method string, url string, contentType string, data io.Reader) error {
+func (h *HttpSender) client() *http.Client {
+	if h.Http == nil {
+		return defaultHttpClient
+	}
+
+	return h.Http
+}
+
+func (h *HttpSender) do(ctx context.Context, method string, url string, contentType string, data io.Reader) error {
 	headers := http.Header{}
 
-	if !h.NoCompression && contentType != jsonEncoding {
+	if !h.NoCompression && contentType == plainTextEncoding {
 		compressed, err := gzipData(data)
 		if err != nil {
 			return err
@@ -71,13 +176,13 @@ func (h *HttpSender) do(method string, url string, contentType string, data io.R
 	headers.Set("M-API-Token", h.Token)
 	headers.Set("Content-Type", contentType)
 
-	req, err := http.NewRequest(method, url, data)
-	req.Header = headers
+	req, err := http.NewRequestWithContext(ctx, method, url, data)
 	if err != nil {
 		return err
 	}
+	req.Header = headers
 
-	resp, err := h.Http.Do(req)
+	resp, err := h.client().Do(req)
 	if err != nil {
 		return err
 	}
@@ -115,30 +220,77 @@ func gzipData(reader io.Reader) (io.Reader, error) {
 	return bytes.NewReader(buf.Bytes()), nil
 }
 
+// UdpSender writes metrics in datagrams of at most MaxPacketSize bytes, split on line boundaries.
+// Lines longer than MaxPacketSize are dropped and reported with ErrLineTooLong, like UnixSender datagrams.
 type UdpSender struct {
-	Address string
-	Timeout time.Duration
+	Address       string
+	Timeout       time.Duration
+	MaxPacketSize int
+
+	// Format defines the metrics line format, e.g. InfluxEncoder, defaults to Configuration.Encoder.
+	Format Encoder
+}
+
+func (u *UdpSender) Encoder() Encoder {
+	return u.Format
 }
 
 func (u *UdpSender) Send(reader io.Reader) error {
-	conn, err := net.Dial("udp", u.Address)
+	return u.SendContext(context.Background(), reader)
+}
+
+func (u *UdpSender) SendContext(ctx context.Context, reader io.Reader) error {
+	data, err := ioutil.ReadAll(reader)
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
 
-	_, err = io.Copy(conn, reader)
+	dialer := net.Dialer{Timeout: u.Timeout}
+	conn, err := dialer.DialContext(ctx, "udp", u.Address)
 	if err != nil {
 		return err
 	}
+	defer conn.Close()
 
-	return nil
+	if deadline, ok := writeDeadline(ctx, u.Timeout); ok {
+		if err := conn.SetWriteDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	size := u.MaxPacketSize
+	if size <= 0 {
+		size = DefaultMaxDatagramSize
+	}
+
+	_, err = writeDatagrams(conn, data, size)
+	return err
 }
 
 func (u *UdpSender) SendAggregated(io.Reader, Aggregation, AggregationFrequency) error {
-	return errors.New("UNSUPPORTED_OPERATION")
+	return ErrUnsupportedOperation
 }
 
-func (u *UdpSender) SendEvents(io.Reader, Aggregation, AggregationFrequency) error {
-	return errors.New("UNSUPPORTED_OPERATION")
+func (u *UdpSender) SendAggregatedContext(context.Context, io.Reader, Aggregation, AggregationFrequency) error {
+	return ErrUnsupportedOperation
+}
+
+func (u *UdpSender) SendEvents(io.Reader) error {
+	return ErrUnsupportedOperation
+}
+
+func (u *UdpSender) SendEventsContext(context.Context, io.Reader) error {
+	return ErrUnsupportedOperation
+}
+
+// writeDeadline returns the earliest of the context deadline and now plus timeout.
+func writeDeadline(ctx context.Context, timeout time.Duration) (time.Time, bool) {
+	deadline, ok := ctx.Deadline()
+	if timeout > 0 {
+		if d := time.Now().Add(timeout); !ok || d.Before(deadline) {
+			return d, true
+		}
+	}
+
+	return deadline, ok
 }
@@ -3,9 +3,11 @@ package statful
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
@@ -143,6 +145,49 @@ func TestApiClient_PutMetrics_Success(t *testing.T) {
 	}
 }
 
+var (
+	_ ContextSender = &HttpSender{}
+	_ ContextSender = &UdpSender{}
+	_ ContextSender = &MultiSender{}
+	_ ContextSender = &FailoverSender{}
+	_ ContextSender = &CircuitBreakerSender{}
+	_ ContextSender = &StatsDSender{}
+	_ ContextSender = &OtlpSender{}
+)
+
+func TestApiClient_PutMetrics_ContextCancelled(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	api := HttpSender{
+		Url:   srv.URL,
+		Token: apiToken,
+		Http:  &http.Client{},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	client := New(Configuration{DisableAutoFlush: true, Sender: &api, Logger: fmtLogger(func(...interface{}) (int, error) { return 0, nil })})
+	client.Put("test.demo.metric", 100, Tags{}, 1585161000, Aggregations{}, Freq10s)
+
+	start := time.Now()
+	err := client.FlushContext(ctx)
+	if err == nil {
+		t.Fatal("expected flush to fail when the context expires")
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("flush did not honour the context deadline, took %v", time.Since(start))
+	}
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Errorf("expected context deadline to be exceeded, got: %v", ctx.Err())
+	}
+}
+
 func TestApiClient_PutMetrics_FailToCompressData(t *testing.T) {}
 
 func TestApiClient_PutMetrics_FailToCreateRequest(t *testing.T) {}
@@ -240,3 +285,24 @@ func TestUdpClient_PutMetrics(t *testing.T) {
 		})
 	}
 }
+
+func TestUdpSender_LineTooLong(t *testing.T) {
+	udp := UdpSender{
+		Address:       udpAddr,
+		Timeout:       2 * time.Second,
+		MaxPacketSize: 16,
+	}
+
+	var err error
+	udpServerPacket := getUdpPacket(t, udpAddr, func() {
+		err = udp.Send(bytes.NewBufferString("a 1 1\ntest.demo.metric.too.long 1 1\nb 2 2"))
+	})
+
+	if err != ErrLineTooLong {
+		t.Errorf("Send() returned: %v, expected: %v", err, ErrLineTooLong)
+	}
+	// the lines that fit are still sent, one datagram each
+	if string(udpServerPacket) != "a 1 1b 2 2" {
+		t.Errorf("received: %q, expected: %q", udpServerPacket, "a 1 1b 2 2")
+	}
+}
@@ -0,0 +1,46 @@
+package statfultest
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/statful/statful-client-golang"
+)
+
+// parseMetrics parses newline separated metric lines, as encoded by statful.MetricToString.
+// The lines are parsed in strict mode so that malformed payloads sent by the client fail the request.
+func parseMetrics(data []byte) ([]statful.Metric, error) {
+	return statful.MetricParser{}.ParseMetrics(bytes.NewReader(data))
+}
+
+// parseEvents parses events serialized by any of the built-in statful.EventSerializer.
+func parseEvents(data []byte) ([]statful.Event, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	switch {
+	case data[0] == '[':
+		var events []statful.Event
+		err := json.Unmarshal(data, &events)
+		return events, err
+	case bytes.HasPrefix(data, []byte(`{"v":`)):
+		var envelope struct {
+			Events []statful.Event `json:"events"`
+		}
+		err := json.Unmarshal(data, &envelope)
+		return envelope.Events, err
+	default:
+		var events []statful.Event
+		dec := json.NewDecoder(bytes.NewReader(data))
+		for dec.More() {
+			var event statful.Event
+			if err := dec.Decode(&event); err != nil {
+				return nil, err
+			}
+			events = append(events, event)
+		}
+		return events, nil
+	}
+}
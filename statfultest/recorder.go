@@ -0,0 +1,303 @@
+package statfultest
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/statful/statful-client-golang"
+)
+
+var (
+	counterAggregations = []statful.Aggregation{statful.AggCount, statful.AggSum}
+	gaugeAggregations   = []statful.Aggregation{statful.AggLast}
+	timerAggregations   = []statful.Aggregation{statful.AggAvg, statful.AggCount, statful.AggP90}
+)
+
+// Recorder is a Sender that records the metrics, aggregated metrics and events it receives as parsed structs.
+// Aggregated metrics carry the aggregation and frequency they were sent with. The zero value is ready to use.
+type Recorder struct {
+	mu         sync.Mutex
+	metrics    []statful.Metric
+	aggregated []statful.Metric
+	events     []statful.Event
+	err        error
+	changed    chan struct{}
+}
+
+func (r *Recorder) Send(data io.Reader) error {
+	return r.SendContext(context.Background(), data)
+}
+
+func (r *Recorder) SendAggregated(data io.Reader, agg statful.Aggregation, freq statful.AggregationFrequency) error {
+	return r.SendAggregatedContext(context.Background(), data, agg, freq)
+}
+
+func (r *Recorder) SendEvents(data io.Reader) error {
+	return r.SendEventsContext(context.Background(), data)
+}
+
+func (r *Recorder) SendContext(ctx context.Context, data io.Reader) error {
+	metrics, err := r.readMetrics(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	return r.record(func() {
+		r.metrics = append(r.metrics, metrics...)
+	})
+}
+
+func (r *Recorder) SendAggregatedContext(ctx context.Context, data io.Reader, agg statful.Aggregation, freq statful.AggregationFrequency) error {
+	metrics, err := r.readMetrics(ctx, data)
+	if err != nil {
+		return err
+	}
+
+	for idx := range metrics {
+		metrics[idx].Aggregations = statful.Aggregations{}.Add(agg)
+		metrics[idx].Frequency = freq
+	}
+
+	return r.record(func() {
+		r.aggregated = append(r.aggregated, metrics...)
+	})
+}
+
+func (r *Recorder) SendEventsContext(ctx context.Context, data io.Reader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	payload, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+
+	events, err := parseEvents(payload)
+	if err != nil {
+		return err
+	}
+
+	return r.record(func() {
+		r.events = append(r.events, events...)
+	})
+}
+
+// Encoder returns StatfulEncoder, the Recorder parses the Statful format whatever the configured encoder.
+func (r *Recorder) Encoder() statful.Encoder {
+	return statful.StatfulEncoder{}
+}
+
+// SetError makes the following sends fail with err, without recording anything. A nil err restores the recording.
+func (r *Recorder) SetError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.err = err
+}
+
+// Metrics returns the metrics sent with Send.
+func (r *Recorder) Metrics() []statful.Metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]statful.Metric(nil), r.metrics...)
+}
+
+// AggregatedMetrics returns the metrics sent with SendAggregated.
+func (r *Recorder) AggregatedMetrics() []statful.Metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]statful.Metric(nil), r.aggregated...)
+}
+
+// Events returns the events sent with SendEvents.
+func (r *Recorder) Events() []statful.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]statful.Event(nil), r.events...)
+}
+
+// Find returns the metrics and aggregated metrics named name that have all the given tags.
+func (r *Recorder) Find(name string, tags statful.Tags) []statful.Metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var found []statful.Metric
+	for _, metrics := range [][]statful.Metric{r.metrics, r.aggregated} {
+		for _, m := range metrics {
+			if m.Name == name && hasTags(m.Tags, tags) {
+				found = append(found, m)
+			}
+		}
+	}
+
+	return found
+}
+
+// Reset clears the recorded metrics and events.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.metrics = nil
+	r.aggregated = nil
+	r.events = nil
+}
+
+// WaitForMetrics waits until at least n metrics and aggregated metrics were recorded,
+// it returns false if the timeout expires first.
+func (r *Recorder) WaitForMetrics(n int, timeout time.Duration) bool {
+	return r.waitFor(func() bool {
+		return len(r.metrics)+len(r.aggregated) >= n
+	}, timeout)
+}
+
+// WaitForEvents waits until at least n events were recorded, it returns false if the timeout expires first.
+func (r *Recorder) WaitForEvents(n int, timeout time.Duration) bool {
+	return r.waitFor(func() bool {
+		return len(r.events) >= n
+	}, timeout)
+}
+
+// AssertCounter fails the test unless a counter named name with the given tags was recorded.
+// Counters are metrics with the count and sum aggregations or with a single one of them, as aggregated counters.
+func (r *Recorder) AssertCounter(t testing.TB, name string, tags statful.Tags) {
+	t.Helper()
+	r.assert(t, "counter", name, tags, counterAggregations)
+}
+
+// AssertGauge fails the test unless a gauge named name with the given tags was recorded.
+// Gauges are metrics with the last aggregation.
+func (r *Recorder) AssertGauge(t testing.TB, name string, tags statful.Tags) {
+	t.Helper()
+	r.assert(t, "gauge", name, tags, gaugeAggregations)
+}
+
+// AssertTimer fails the test unless a timer named name with the given tags was recorded.
+// Timers are metrics with the avg, count and p90 aggregations or with a single one of them, as aggregated timers.
+func (r *Recorder) AssertTimer(t testing.TB, name string, tags statful.Tags) {
+	t.Helper()
+	r.assert(t, "timer", name, tags, timerAggregations)
+}
+
+// AssertMetric fails the test unless a metric named name with the given tags was recorded.
+func (r *Recorder) AssertMetric(t testing.TB, name string, tags statful.Tags) {
+	t.Helper()
+	if len(r.Find(name, tags)) == 0 {
+		t.Errorf("no metric %s with tags %v was recorded, got: %v", name, tags, r.names())
+	}
+}
+
+func (r *Recorder) assert(t testing.TB, kind string, name string, tags statful.Tags, aggs []statful.Aggregation) {
+	t.Helper()
+
+	for _, m := range r.Find(name, tags) {
+		if hasAggregations(m, aggs) {
+			return
+		}
+	}
+
+	t.Errorf("no %s %s with tags %v was recorded, got: %v", kind, name, tags, r.names())
+}
+
+func (r *Recorder) names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var names []string
+	for _, metrics := range [][]statful.Metric{r.metrics, r.aggregated} {
+		for _, m := range metrics {
+			names = append(names, m.String())
+		}
+	}
+
+	return names
+}
+
+func (r *Recorder) readMetrics(ctx context.Context, data io.Reader) ([]statful.Metric, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	payload, err := ioutil.ReadAll(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseMetrics(payload)
+}
+
+func (r *Recorder) record(add func()) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+
+	add()
+	if r.changed != nil {
+		close(r.changed)
+		r.changed = nil
+	}
+
+	return nil
+}
+
+func (r *Recorder) waitFor(done func() bool, timeout time.Duration) bool {
+	deadline := time.After(timeout)
+	for {
+		r.mu.Lock()
+		if done() {
+			r.mu.Unlock()
+			return true
+		}
+		if r.changed == nil {
+			r.changed = make(chan struct{})
+		}
+		changed := r.changed
+		r.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return false
+		}
+	}
+}
+
+func hasTags(tags statful.Tags, expected statful.Tags) bool {
+	for k, v := range expected {
+		if tv, ok := tags[k]; !ok || tv != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasAggregations tells if a metric has all the aggregations or, for aggregated metrics, one of them.
+func hasAggregations(m statful.Metric, aggs []statful.Aggregation) bool {
+	if len(m.Aggregations) == 1 {
+		for _, agg := range aggs {
+			if _, ok := m.Aggregations[agg]; ok {
+				return true
+			}
+		}
+	}
+
+	for _, agg := range aggs {
+		if _, ok := m.Aggregations[agg]; !ok {
+			return false
+		}
+	}
+
+	return len(aggs) > 0
+}
@@ -0,0 +1,143 @@
+package statfultest
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/statful/statful-client-golang"
+)
+
+// fakeT records the failures of the assertions under test.
+type fakeT struct {
+	testing.TB
+	errors []string
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Errorf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func TestRecorder(t *testing.T) {
+	recorder := &Recorder{}
+	client := statful.New(statful.Configuration{
+		DisableAutoFlush: true,
+		Tags:             statful.Tags{"env": "test"},
+		Sender:           recorder,
+	})
+
+	client.Counter("requests", 1, statful.Tags{"status": "200"})
+	client.Gauge("queue.size", 10, statful.Tags{})
+	client.Timer("latency", 12.5, statful.Tags{"route": "/"})
+	client.CounterAggregated("items", 5, statful.Tags{}, statful.AggSum, statful.Freq60s)
+	client.Put("custom", 3, statful.Tags{}, 1585161000, statful.Aggregations{}, statful.Freq10s, statful.WithUser("u1"))
+	if err := client.FlushError(); err != nil {
+		t.Fatalf("FlushError() returned error: %v", err)
+	}
+
+	client.Event(statful.Event{EventType: "deploy"})
+	if err := client.FlushEvents(); err != nil {
+		t.Fatalf("FlushEvents() returned error: %v", err)
+	}
+
+	recorder.AssertCounter(t, "requests", statful.Tags{"status": "200"})
+	recorder.AssertCounter(t, "items", statful.Tags{"env": "test"})
+	recorder.AssertGauge(t, "queue.size", nil)
+	recorder.AssertTimer(t, "latency", statful.Tags{"route": "/", "env": "test"})
+	recorder.AssertMetric(t, "custom", nil)
+
+	custom := recorder.Find("custom", nil)
+	if len(custom) != 1 || custom[0].User != "u1" || custom[0].Value != 3 || custom[0].Timestamp != 1585161000 {
+		t.Errorf("Find() returned: %+v", custom)
+	}
+
+	aggregated := recorder.AggregatedMetrics()
+	if len(aggregated) != 1 || aggregated[0].Frequency != statful.Freq60s {
+		t.Errorf("AggregatedMetrics() returned: %+v", aggregated)
+	}
+	if len(recorder.Metrics()) != 4 {
+		t.Errorf("Metrics() returned: %+v", recorder.Metrics())
+	}
+	if events := recorder.Events(); len(events) != 1 || events[0].EventType != "deploy" {
+		t.Errorf("Events() returned: %+v", events)
+	}
+
+	ft := &fakeT{}
+	recorder.AssertCounter(ft, "queue.size", nil)
+	recorder.AssertGauge(ft, "requests", nil)
+	recorder.AssertTimer(ft, "latency", statful.Tags{"route": "/other"})
+	recorder.AssertMetric(ft, "missing", nil)
+	if len(ft.errors) != 4 {
+		t.Errorf("expected 4 failed assertions, got: %v", ft.errors)
+	}
+
+	recorder.Reset()
+	if len(recorder.Metrics()) != 0 || len(recorder.AggregatedMetrics()) != 0 || len(recorder.Events()) != 0 {
+		t.Error("Reset() did not clear the recorded data")
+	}
+}
+
+func TestRecorder_ConfiguredEncoder(t *testing.T) {
+	recorder := &Recorder{}
+	client := statful.New(statful.Configuration{
+		DisableAutoFlush: true,
+		Encoder:          statful.InfluxEncoder{},
+		Sender:           recorder,
+	})
+
+	client.Counter("requests", 1, statful.Tags{"status": "200"})
+	if err := client.FlushError(); err != nil {
+		t.Fatalf("FlushError() returned error: %v", err)
+	}
+
+	recorder.AssertCounter(t, "requests", statful.Tags{"status": "200"})
+}
+
+func TestRecorder_WaitForMetrics(t *testing.T) {
+	recorder := &Recorder{}
+	client := statful.New(statful.Configuration{
+		FlushSize:     2,
+		FlushInterval: time.Hour,
+		Sender:        recorder,
+	})
+	defer client.StopFlushInterval()
+
+	go func() {
+		for i := 0; i < 4; i++ {
+			client.Counter("requests", 1, statful.Tags{})
+		}
+	}()
+
+	if !recorder.WaitForMetrics(4, time.Second) {
+		t.Fatalf("WaitForMetrics() timed out with %d metrics", len(recorder.Metrics()))
+	}
+	if recorder.WaitForMetrics(5, 10*time.Millisecond) {
+		t.Error("WaitForMetrics() returned true without enough metrics")
+	}
+	if recorder.WaitForEvents(1, 10*time.Millisecond) {
+		t.Error("WaitForEvents() returned true without events")
+	}
+}
+
+func TestRecorder_SetError(t *testing.T) {
+	recorder := &Recorder{}
+	client := statful.New(statful.Configuration{
+		DisableAutoFlush: true,
+		Logger:           log.New(ioutil.Discard, "", 0),
+		Sender:           recorder,
+	})
+
+	recorder.SetError(errors.New("api down"))
+	client.Counter("requests", 1, statful.Tags{})
+	if err := client.FlushError(); err == nil {
+		t.Error("expected FlushError() to fail")
+	}
+	if len(recorder.Metrics()) != 0 {
+		t.Errorf("failed metrics were recorded: %+v", recorder.Metrics())
+	}
+}
@@ -0,0 +1,243 @@
+// Package statfultest provides a fake Statful API and a recording Sender for integration tests.
+package statfultest
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/statful/statful-client-golang"
+)
+
+var (
+	metricsPath    = regexp.MustCompile(`/tel/v2\.0/metrics$`)
+	aggregatedPath = regexp.MustCompile(`/tel/v2\.0/aggregation/([^/]+)/frequency/([0-9]+)$`)
+	eventsPath     = regexp.MustCompile(`/insights/event$`)
+)
+
+// Request is a request received by the Server, with the body decompressed.
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// Server is a fake Statful API serving the metrics, aggregated metrics and events endpoints under any base path.
+// Payloads are decompressed, the M-API-Token header is checked against Token when it is set and the metrics
+// and events are parsed and recorded. Latency, error responses and dropped connections can be injected.
+type Server struct {
+	*httptest.Server
+	Token string
+
+	mu         sync.Mutex
+	requests   []Request
+	metrics    []statful.Metric
+	aggregated []statful.Metric
+	events     []statful.Event
+	latency    time.Duration
+	failures   []int
+	drops      int
+}
+
+// NewServer starts a Server that accepts requests with token, an empty token accepts every request.
+// The caller should call Close when finished.
+func NewServer(token string) *Server {
+	s := &Server{Token: token}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s
+}
+
+// Sender returns an HttpSender configured for the server.
+func (s *Server) Sender() *statful.HttpSender {
+	return &statful.HttpSender{
+		Http:  s.Client(),
+		Url:   s.URL,
+		Token: s.Token,
+	}
+}
+
+// SetLatency delays every response by latency.
+func (s *Server) SetLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latency = latency
+}
+
+// FailNext responds to the next n requests with status. The failed requests are returned by Requests,
+// their metrics and events aren't recorded.
+func (s *Server) FailNext(n int, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := 0; i < n; i++ {
+		s.failures = append(s.failures, status)
+	}
+}
+
+// DropNext closes the connection of the next n requests without responding.
+func (s *Server) DropNext(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.drops += n
+}
+
+// Requests returns the requests received so far, including the rejected ones.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Request(nil), s.requests...)
+}
+
+// Metrics returns the metrics received on the metrics endpoint.
+func (s *Server) Metrics() []statful.Metric {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]statful.Metric(nil), s.metrics...)
+}
+
+// AggregatedMetrics returns the metrics received on the aggregation endpoint,
+// with the aggregation and frequency of the request.
+func (s *Server) AggregatedMetrics() []statful.Metric {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]statful.Metric(nil), s.aggregated...)
+}
+
+// Events returns the events received on the events endpoint.
+func (s *Server) Events() []statful.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]statful.Event(nil), s.events...)
+}
+
+// Reset clears the recorded requests, metrics and events and the injected faults.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = nil
+	s.metrics = nil
+	s.aggregated = nil
+	s.events = nil
+	s.latency = 0
+	s.failures = nil
+	s.drops = 0
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	body, err := readBody(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Header: r.Header.Clone(), Body: body})
+	latency := s.latency
+	drop := s.drops > 0
+	if drop {
+		s.drops--
+	}
+	status := 0
+	if !drop && len(s.failures) > 0 {
+		status, s.failures = s.failures[0], s.failures[1:]
+	}
+	s.mu.Unlock()
+
+	if latency > 0 {
+		select {
+		case <-time.After(latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if drop {
+		if conn, _, err := w.(http.Hijacker).Hijack(); err == nil {
+			_ = conn.Close()
+		}
+		return
+	}
+	if status != 0 {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	if s.Token != "" && r.Header.Get("M-API-Token") != s.Token {
+		http.Error(w, `{"code":"UNAUTHORIZED"}`, http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodPut && r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch {
+	case metricsPath.MatchString(r.URL.Path):
+		metrics, err := parseMetrics(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.metrics = append(s.metrics, metrics...)
+		s.mu.Unlock()
+	case aggregatedPath.MatchString(r.URL.Path):
+		match := aggregatedPath.FindStringSubmatch(r.URL.Path)
+		freq, _ := strconv.Atoi(match[2])
+		metrics, err := parseMetrics(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for idx := range metrics {
+			metrics[idx].Aggregations = statful.Aggregations{}.Add(statful.Aggregation(match[1]))
+			metrics[idx].Frequency = statful.AggregationFrequency(freq)
+		}
+		s.mu.Lock()
+		s.aggregated = append(s.aggregated, metrics...)
+		s.mu.Unlock()
+	case eventsPath.MatchString(r.URL.Path):
+		events, err := parseEvents(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.events = append(s.events, events...)
+		s.mu.Unlock()
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	_, _ = io.WriteString(w, `{"code":"SUCCESS"}`)
+}
+
+func readBody(r *http.Request) ([]byte, error) {
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		body = gr
+	}
+
+	return ioutil.ReadAll(body)
+}
@@ -0,0 +1,165 @@
+package statfultest
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/statful/statful-client-golang"
+)
+
+func TestServer(t *testing.T) {
+	srv := NewServer("token")
+	defer srv.Close()
+
+	sender := srv.Sender()
+	sender.BasePath = "/base"
+	client := statful.New(statful.Configuration{
+		DisableAutoFlush: true,
+		Tags:             statful.Tags{"env": "test"},
+		Sender:           sender,
+	})
+
+	client.Put("requests", 2, statful.Tags{"status": "200"}, 1585161000, statful.Aggregations{statful.AggCount: struct{}{}}, statful.Freq10s, statful.WithUser("u1"))
+	client.PutAggregated("latency", 12.5, statful.Tags{}, 1585161001, statful.AggP90, statful.Freq60s)
+	if err := client.FlushError(); err != nil {
+		t.Fatalf("FlushError() returned error: %v", err)
+	}
+
+	client.Event(statful.Event{EventType: "deploy", Timestamp: 1585161002})
+	if err := client.FlushEvents(); err != nil {
+		t.Fatalf("FlushEvents() returned error: %v", err)
+	}
+
+	expectedMetrics := []statful.Metric{{
+		Name:         "requests",
+		Value:        2,
+		User:         "u1",
+		Tags:         statful.Tags{"status": "200", "env": "test"},
+		Timestamp:    1585161000,
+		Aggregations: statful.Aggregations{statful.AggCount: struct{}{}},
+		Frequency:    statful.Freq10s,
+	}}
+	if !reflect.DeepEqual(srv.Metrics(), expectedMetrics) {
+		t.Errorf("Metrics() returned: %+v, expected: %+v", srv.Metrics(), expectedMetrics)
+	}
+
+	expectedAggregated := []statful.Metric{{
+		Name:         "latency",
+		Value:        12.5,
+		Tags:         statful.Tags{"env": "test"},
+		Timestamp:    1585161001,
+		Aggregations: statful.Aggregations{statful.AggP90: struct{}{}},
+		Frequency:    statful.Freq60s,
+	}}
+	if !reflect.DeepEqual(srv.AggregatedMetrics(), expectedAggregated) {
+		t.Errorf("AggregatedMetrics() returned: %+v, expected: %+v", srv.AggregatedMetrics(), expectedAggregated)
+	}
+
+	if events := srv.Events(); len(events) != 1 || events[0].EventType != "deploy" {
+		t.Errorf("Events() returned: %+v", events)
+	}
+
+	requests := srv.Requests()
+	if len(requests) != 3 || !strings.HasPrefix(requests[0].Path, "/base/") {
+		t.Errorf("Requests() returned: %+v", requests)
+	}
+
+	srv.Reset()
+	if len(srv.Requests()) != 0 || len(srv.Metrics()) != 0 || len(srv.AggregatedMetrics()) != 0 || len(srv.Events()) != 0 {
+		t.Error("Reset() did not clear the recorded data")
+	}
+}
+
+func TestServer_Rejections(t *testing.T) {
+	srv := NewServer("token")
+	defer srv.Close()
+
+	scenarios := []struct {
+		description string
+		sender      func() *statful.HttpSender
+		payload     string
+	}{
+		{
+			description: "invalid token",
+			sender: func() *statful.HttpSender {
+				sender := srv.Sender()
+				sender.Token = "wrong"
+				return sender
+			},
+			payload: "requests 1 1585161000",
+		},
+		{
+			description: "invalid metric line",
+			sender:      srv.Sender,
+			payload:     "requests one 1585161000",
+		},
+		{
+			description: "injected failure",
+			sender: func() *statful.HttpSender {
+				srv.FailNext(1, http.StatusServiceUnavailable)
+				return srv.Sender()
+			},
+			payload: "requests 1 1585161000",
+		},
+		{
+			description: "dropped connection",
+			sender: func() *statful.HttpSender {
+				srv.DropNext(1)
+				return srv.Sender()
+			},
+			payload: "requests 1 1585161000",
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			if err := s.sender().Send(bytes.NewBufferString(s.payload)); err == nil {
+				t.Error("expected Send() to fail")
+			}
+		})
+	}
+
+	if len(srv.Metrics()) != 0 {
+		t.Errorf("rejected metrics were recorded: %+v", srv.Metrics())
+	}
+
+	// faults are consumed, the next request succeeds
+	if err := srv.Sender().Send(bytes.NewBufferString("requests 1 1585161000")); err != nil {
+		t.Errorf("Send() returned error: %v", err)
+	}
+}
+
+func TestServer_FailNext(t *testing.T) {
+	srv := NewServer("")
+	defer srv.Close()
+	srv.FailNext(1, http.StatusServiceUnavailable)
+
+	if err := srv.Sender().Send(bytes.NewBufferString("requests 1 1585161000")); err == nil {
+		t.Error("expected Send() to fail")
+	}
+
+	if requests := srv.Requests(); len(requests) != 1 || string(requests[0].Body) != "requests 1 1585161000" {
+		t.Errorf("expected the failed request to be recorded, got: %+v", requests)
+	}
+	if len(srv.Metrics()) != 0 {
+		t.Errorf("metrics of the failed request were recorded: %+v", srv.Metrics())
+	}
+}
+
+func TestServer_Latency(t *testing.T) {
+	srv := NewServer("")
+	defer srv.Close()
+	srv.SetLatency(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := srv.Sender().SendContext(ctx, bytes.NewBufferString("requests 1 1585161000")); err == nil {
+		t.Error("expected SendContext() to time out")
+	}
+}
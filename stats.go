@@ -0,0 +1,126 @@
+package statful
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Stats holds the client counters. Fields are updated atomically, use Client.Stats to get a consistent copy.
+type Stats struct {
+	MetricsPut     int64
+	MetricsFlushed int64
+	MetricsDropped int64
+	EventsFlushed  int64
+	EventsDropped  int64
+	FlushErrors    int64
+
+	// MetricsFiltered counts the metrics dropped by the Processors.
+	MetricsFiltered int64
+	// MetricsBuffered counts the metrics kept by a socket sender while reconnecting, see ErrSendBuffered.
+	MetricsBuffered int64
+
+	CircuitOpened     int64
+	CircuitHalfOpened int64
+	CircuitClosed     int64
+	CircuitRejected   int64
+}
+
+type statsContextKey struct{}
+
+// contextWithStats carries the client stats to the senders of a flush, so senders shared by several
+// clients, like CircuitBreakerSender, count into the stats of the client sending.
+func contextWithStats(ctx context.Context, stats *Stats) context.Context {
+	if stats == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, statsContextKey{}, stats)
+}
+
+func statsFromContext(ctx context.Context) *Stats {
+	stats, _ := ctx.Value(statsContextKey{}).(*Stats)
+	return stats
+}
+
+func (s *Stats) metricsPut() {
+	if s != nil {
+		atomic.AddInt64(&s.MetricsPut, 1)
+	}
+}
+
+func (s *Stats) metricsFiltered() {
+	if s != nil {
+		atomic.AddInt64(&s.MetricsFiltered, 1)
+	}
+}
+
+func (s *Stats) metricsFlushed(count int, err error) {
+	if s == nil {
+		return
+	}
+
+	switch {
+	case err == ErrSendBuffered:
+		atomic.AddInt64(&s.MetricsBuffered, int64(count))
+	case err != nil:
+		atomic.AddInt64(&s.MetricsDropped, int64(count))
+		atomic.AddInt64(&s.FlushErrors, 1)
+	default:
+		atomic.AddInt64(&s.MetricsFlushed, int64(count))
+	}
+}
+
+func (s *Stats) eventsFlushed(count int, err error) {
+	if s == nil {
+		return
+	}
+
+	if err != nil {
+		atomic.AddInt64(&s.EventsDropped, int64(count))
+		atomic.AddInt64(&s.FlushErrors, 1)
+	} else {
+		atomic.AddInt64(&s.EventsFlushed, int64(count))
+	}
+}
+
+func (s *Stats) circuitTransition(to CircuitState) {
+	if s == nil {
+		return
+	}
+
+	switch to {
+	case CircuitOpen:
+		atomic.AddInt64(&s.CircuitOpened, 1)
+	case CircuitHalfOpen:
+		atomic.AddInt64(&s.CircuitHalfOpened, 1)
+	case CircuitClosed:
+		atomic.AddInt64(&s.CircuitClosed, 1)
+	}
+}
+
+func (s *Stats) circuitRejected() {
+	if s != nil {
+		atomic.AddInt64(&s.CircuitRejected, 1)
+	}
+}
+
+func (s *Stats) snapshot() Stats {
+	if s == nil {
+		return Stats{}
+	}
+
+	return Stats{
+		MetricsPut:        atomic.LoadInt64(&s.MetricsPut),
+		MetricsFlushed:    atomic.LoadInt64(&s.MetricsFlushed),
+		MetricsDropped:    atomic.LoadInt64(&s.MetricsDropped),
+		MetricsFiltered:   atomic.LoadInt64(&s.MetricsFiltered),
+		MetricsBuffered:   atomic.LoadInt64(&s.MetricsBuffered),
+		EventsFlushed:     atomic.LoadInt64(&s.EventsFlushed),
+		EventsDropped:     atomic.LoadInt64(&s.EventsDropped),
+		FlushErrors:       atomic.LoadInt64(&s.FlushErrors),
+		CircuitOpened:     atomic.LoadInt64(&s.CircuitOpened),
+		CircuitHalfOpened: atomic.LoadInt64(&s.CircuitHalfOpened),
+		CircuitClosed:     atomic.LoadInt64(&s.CircuitClosed),
+		CircuitRejected:   atomic.LoadInt64(&s.CircuitRejected),
+	}
+}
@@ -0,0 +1,296 @@
+package statful
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatsDType is the metric type of a StatsD line.
+type StatsDType string
+
+const (
+	StatsDCounter      StatsDType = "c"
+	StatsDGauge        StatsDType = "g"
+	StatsDTimer        StatsDType = "ms"
+	StatsDHistogram    StatsDType = "h"
+	StatsDDistribution StatsDType = "d"
+	StatsDSet          StatsDType = "s"
+)
+
+var ErrStatsDGaugeDelta = errors.New("statsd gauge deltas are not supported")
+
+// statsDTagReplacer replaces the separators of the StatsD tags section, and the line breaks, with underscores.
+var statsDTagReplacer = strings.NewReplacer(",", "_", "|", "_", ":", "_", "\r", "_", "\n", "_")
+
+// StatsDMetric is a single StatsD metric: name:value|type[|@sample_rate][|#tag1:value,tag2]
+// Tags use the DogStatsD extension, a tag without a value gets the value "true".
+// Delta is set for gauges with an explicit sign, which StatsD applies to the previous value.
+type StatsDMetric struct {
+	Name       string
+	Value      float64
+	Type       StatsDType
+	SampleRate float64
+	Tags       Tags
+	Delta      bool
+}
+
+// String returns the StatsD line of the metric. Commas, pipes and colons in the tag keys and values are replaced
+// with underscores. A negative gauge that isn't a delta is written as two lines, the first one setting the gauge
+// to 0, since StatsD reads a leading minus sign as a decrement.
+func (m StatsDMetric) String() string {
+	var b strings.Builder
+
+	if m.Type == StatsDGauge && !m.Delta && m.Value < 0 {
+		reset := m
+		reset.Value = 0
+		reset.writeTo(&b)
+		b.WriteByte('\n')
+	}
+	m.writeTo(&b)
+
+	return b.String()
+}
+
+func (m StatsDMetric) writeTo(b *strings.Builder) {
+	b.WriteString(m.Name)
+	b.WriteByte(':')
+	if m.Delta && m.Value >= 0 {
+		b.WriteByte('+')
+	}
+	b.WriteString(strconv.FormatFloat(m.Value, 'f', -1, 64))
+	b.WriteByte('|')
+	b.WriteString(string(m.Type))
+
+	if m.SampleRate > 0 && m.SampleRate < 1 {
+		b.WriteString("|@")
+		b.WriteString(strconv.FormatFloat(m.SampleRate, 'f', -1, 64))
+	}
+
+	if len(m.Tags) > 0 {
+		b.WriteString("|#")
+		first := true
+		for k, v := range m.Tags {
+			if !first {
+				b.WriteByte(',')
+			}
+			first = false
+			fmt.Fprintf(b, "%s:%s", statsDTagReplacer.Replace(k), statsDTagReplacer.Replace(v))
+		}
+	}
+}
+
+// ParseStatsD parses a single StatsD line. Errors are *ParseError values with the column of the invalid section.
+func ParseStatsD(line string) (StatsDMetric, error) {
+	m := StatsDMetric{SampleRate: 1, Tags: Tags{}}
+
+	colon := strings.LastIndexByte(strings.SplitN(line, "|", 2)[0], ':')
+	if colon <= 0 {
+		return m, parseErr(line, 1, "expected name:value")
+	}
+	m.Name = line[:colon]
+
+	sections := strings.Split(line[colon+1:], "|")
+	if len(sections) < 2 {
+		return m, parseErr(line, len(line)+1, "missing metric type")
+	}
+
+	column := colon + 2
+	value := sections[0]
+	if value == "" {
+		return m, parseErr(line, column, "missing value")
+	}
+	m.Delta = value[0] == '+' || value[0] == '-'
+
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return m, parseErr(line, column, "invalid value %q", value)
+	}
+	m.Value = v
+	column += len(value) + 1
+
+	m.Type = StatsDType(sections[1])
+	switch m.Type {
+	case StatsDCounter, StatsDGauge, StatsDTimer, StatsDHistogram, StatsDDistribution, StatsDSet:
+	default:
+		return m, parseErr(line, column, "unsupported metric type %q", sections[1])
+	}
+	if m.Type != StatsDGauge {
+		m.Delta = false
+	}
+	column += len(sections[1]) + 1
+
+	for _, section := range sections[2:] {
+		switch {
+		case strings.HasPrefix(section, "@"):
+			rate, err := strconv.ParseFloat(section[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return m, parseErr(line, column, "invalid sample rate %q", section)
+			}
+			m.SampleRate = rate
+		case strings.HasPrefix(section, "#"):
+			for _, tag := range strings.Split(section[1:], ",") {
+				if tag == "" {
+					continue
+				}
+				kv := strings.SplitN(tag, ":", 2)
+				if kv[0] == "" {
+					return m, parseErr(line, column, "invalid tag %q", tag)
+				}
+				if len(kv) == 1 || kv[1] == "" {
+					m.Tags[kv[0]] = "true"
+				} else {
+					m.Tags[kv[0]] = kv[1]
+				}
+			}
+		case strings.HasPrefix(section, "c:") || strings.HasPrefix(section, "T"):
+			// DogStatsD container id and timestamp fields are ignored
+		default:
+			return m, parseErr(line, column, "unexpected section %q", section)
+		}
+		column += len(section) + 1
+	}
+
+	return m, nil
+}
+
+// PutStatsD puts a StatsD metric using the default aggregations of Counter, Gauge and Timer.
+// Counters are scaled by the inverse of the sample rate, timers, histograms and distributions are sent as timers
+// and sets are counted as counters, one per occurrence, since the unique values aren't tracked.
+// Gauge deltas can't be represented and return ErrStatsDGaugeDelta.
+func (c *Client) PutStatsD(m StatsDMetric) error {
+	switch m.Type {
+	case StatsDCounter:
+		value := m.Value
+		if m.SampleRate > 0 && m.SampleRate < 1 {
+			value /= m.SampleRate
+		}
+		c.Counter(m.Name, value, m.Tags)
+	case StatsDSet:
+		c.Counter(m.Name, 1, m.Tags)
+	case StatsDGauge:
+		if m.Delta {
+			return ErrStatsDGaugeDelta
+		}
+		c.Gauge(m.Name, m.Value, m.Tags)
+	case StatsDTimer, StatsDHistogram, StatsDDistribution:
+		c.Timer(m.Name, m.Value, m.Tags)
+	default:
+		return fmt.Errorf("unsupported statsd metric type %q", m.Type)
+	}
+
+	return nil
+}
+
+// StatsDSender sends metrics to a StatsD server over UDP, converting them to StatsD lines with DogStatsD tags.
+// The type is derived from the aggregations: metrics with last or without aggregations are sent as gauges,
+// metrics with only count and sum as counters and the others as timers. Timestamps, users and frequencies are dropped. Events are not supported.
+type StatsDSender struct {
+	Address       string
+	Timeout       time.Duration
+	MaxPacketSize int
+}
+
+// Encoder returns StatfulEncoder, the lines are converted to StatsD when sent.
+func (s *StatsDSender) Encoder() Encoder {
+	return StatfulEncoder{}
+}
+
+func (s *StatsDSender) Send(data io.Reader) error {
+	return s.SendContext(context.Background(), data)
+}
+
+func (s *StatsDSender) SendContext(ctx context.Context, data io.Reader) error {
+	metrics, err := parseStatsDPayload(data)
+	if err != nil {
+		return err
+	}
+
+	return s.send(ctx, metrics, statsDType)
+}
+
+func (s *StatsDSender) SendAggregated(data io.Reader, agg Aggregation, freq AggregationFrequency) error {
+	return s.SendAggregatedContext(context.Background(), data, agg, freq)
+}
+
+func (s *StatsDSender) SendAggregatedContext(ctx context.Context, data io.Reader, agg Aggregation, freq AggregationFrequency) error {
+	metrics, err := parseStatsDPayload(data)
+	if err != nil {
+		return err
+	}
+
+	return s.send(ctx, metrics, statsDAggregatedType(agg))
+}
+
+func (s *StatsDSender) SendEvents(io.Reader) error {
+	return ErrUnsupportedOperation
+}
+
+func (s *StatsDSender) SendEventsContext(context.Context, io.Reader) error {
+	return ErrUnsupportedOperation
+}
+
+// sendMetrics converts the buffered metrics to StatsD directly instead of parsing their Statful lines.
+func (s *StatsDSender) sendMetrics(ctx context.Context, b metricBatch) error {
+	if b.aggregated {
+		return s.send(ctx, b.metrics, statsDAggregatedType(b.agg))
+	}
+
+	return s.send(ctx, b.metrics, statsDType)
+}
+
+func (s *StatsDSender) send(ctx context.Context, metrics []Metric, typeOf func(Metric) StatsDType) error {
+	var b bytes.Buffer
+	for _, m := range metrics {
+		b.WriteString(StatsDMetric{Name: m.Name, Value: m.Value, Type: typeOf(m), Tags: m.Tags}.String())
+		b.WriteByte('\n')
+	}
+
+	udp := UdpSender{Address: s.Address, Timeout: s.Timeout, MaxPacketSize: s.MaxPacketSize}
+	return udp.SendContext(ctx, &b)
+}
+
+func parseStatsDPayload(data io.Reader) ([]Metric, error) {
+	payload, err := ioutil.ReadAll(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return MetricParser{Lenient: true}.ParseMetrics(bytes.NewReader(payload))
+}
+
+// statsDType returns the StatsD type of a metric from its aggregations.
+func statsDType(m Metric) StatsDType {
+	if _, ok := m.Aggregations[AggLast]; ok {
+		return StatsDGauge
+	}
+	for agg := range m.Aggregations {
+		if agg != AggCount && agg != AggSum {
+			return StatsDTimer
+		}
+	}
+	if len(m.Aggregations) > 0 {
+		return StatsDCounter
+	}
+	return StatsDGauge
+}
+
+// statsDAggregatedType returns the StatsD type of the metrics aggregated with agg.
+func statsDAggregatedType(agg Aggregation) func(Metric) StatsDType {
+	return func(Metric) StatsDType {
+		switch agg {
+		case AggCount, AggSum:
+			return StatsDCounter
+		case AggFirst, AggLast, AggMin, AggMax:
+			return StatsDGauge
+		default:
+			return StatsDTimer
+		}
+	}
+}
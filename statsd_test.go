@@ -0,0 +1,250 @@
+package statful
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStatsD(t *testing.T) {
+	scenarios := []struct {
+		description string
+		line        string
+		expected    StatsDMetric
+	}{
+		{
+			description: "counter",
+			line:        "requests:1|c",
+			expected:    StatsDMetric{Name: "requests", Value: 1, Type: StatsDCounter, SampleRate: 1, Tags: Tags{}},
+		},
+		{
+			description: "sampled counter with dogstatsd tags",
+			line:        "requests:2|c|@0.5|#env:prod,canary",
+			expected:    StatsDMetric{Name: "requests", Value: 2, Type: StatsDCounter, SampleRate: 0.5, Tags: Tags{"env": "prod", "canary": "true"}},
+		},
+		{
+			description: "gauge",
+			line:        "queue.size:12.5|g",
+			expected:    StatsDMetric{Name: "queue.size", Value: 12.5, Type: StatsDGauge, SampleRate: 1, Tags: Tags{}},
+		},
+		{
+			description: "gauge delta",
+			line:        "queue.size:-3|g",
+			expected:    StatsDMetric{Name: "queue.size", Value: -3, Type: StatsDGauge, SampleRate: 1, Tags: Tags{}, Delta: true},
+		},
+		{
+			description: "timer with tags",
+			line:        "request.duration:320|ms|#endpoint:/users",
+			expected:    StatsDMetric{Name: "request.duration", Value: 320, Type: StatsDTimer, SampleRate: 1, Tags: Tags{"endpoint": "/users"}},
+		},
+		{
+			description: "histogram ignoring dogstatsd container id",
+			line:        "payload.size:1024|h|c:abc123",
+			expected:    StatsDMetric{Name: "payload.size", Value: 1024, Type: StatsDHistogram, SampleRate: 1, Tags: Tags{}},
+		},
+		{
+			description: "set",
+			line:        "users.unique:42|s",
+			expected:    StatsDMetric{Name: "users.unique", Value: 42, Type: StatsDSet, SampleRate: 1, Tags: Tags{}},
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			m, err := ParseStatsD(s.line)
+			if err != nil {
+				t.Fatalf("ParseStatsD() returned error: %v", err)
+			}
+
+			if !reflect.DeepEqual(m, s.expected) {
+				t.Errorf("ParseStatsD() returned: %+v, expected: %+v", m, s.expected)
+			}
+		})
+	}
+}
+
+func TestParseStatsD_Errors(t *testing.T) {
+	scenarios := []struct {
+		description string
+		line        string
+		column      int
+	}{
+		{description: "missing value", line: "requests", column: 1},
+		{description: "missing type", line: "requests:1", column: 11},
+		{description: "invalid value", line: "requests:one|c", column: 10},
+		{description: "unknown type", line: "requests:1|x", column: 12},
+		{description: "invalid sample rate", line: "requests:1|c|@2", column: 14},
+		{description: "unexpected section", line: "requests:1|c|@0.1|foo", column: 19},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			_, err := ParseStatsD(s.line)
+			perr, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("ParseStatsD() returned: %v, expected a *ParseError", err)
+			}
+
+			if perr.Column != s.column {
+				t.Errorf("ParseStatsD() returned column %d (%s), expected: %d", perr.Column, perr.Msg, s.column)
+			}
+		})
+	}
+}
+
+func TestClient_PutStatsD(t *testing.T) {
+	sender := &recordingSender{}
+	client := New(Configuration{DisableAutoFlush: true, Sender: sender, Logger: fmtLogger(fmt.Println)})
+
+	for _, line := range []string{"requests:2|c|@0.5|#env:prod", "queue.size:12|g", "request.duration:320|ms", "users.unique:42|s"} {
+		m, err := ParseStatsD(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := client.PutStatsD(m); err != nil {
+			t.Fatalf("PutStatsD(%q) returned error: %v", line, err)
+		}
+	}
+
+	if err := client.PutStatsD(StatsDMetric{Name: "queue.size", Value: 1, Type: StatsDGauge, Delta: true}); err != ErrStatsDGaugeDelta {
+		t.Errorf("PutStatsD() of a gauge delta returned: %v", err)
+	}
+
+	if err := client.FlushError(); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, err := MetricParser{}.ParseMetrics(strings.NewReader(strings.Join(sender.payloads, "\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]struct {
+		value float64
+		aggs  Aggregations
+	}{
+		"requests":         {4, counterAggregations},
+		"queue.size":       {12, gaugeAggregations},
+		"request.duration": {320, timerAggregations},
+		"users.unique":     {1, counterAggregations},
+	}
+	if len(metrics) != len(expected) {
+		t.Fatalf("sent %+v", metrics)
+	}
+	for _, m := range metrics {
+		e := expected[m.Name]
+		if m.Value != e.value || !reflect.DeepEqual(m.Aggregations, e.aggs) {
+			t.Errorf("sent %+v, expected value %v and aggregations %v", m, e.value, e.aggs)
+		}
+	}
+}
+
+func TestStatsDMetric_String(t *testing.T) {
+	scenarios := []struct {
+		description string
+		metric      StatsDMetric
+		expected    string
+	}{
+		{
+			description: "sampled counter with tags",
+			metric:      StatsDMetric{Name: "requests", Value: 2, Type: StatsDCounter, SampleRate: 0.5, Tags: Tags{"env": "prod"}},
+			expected:    "requests:2|c|@0.5|#env:prod",
+		},
+		{
+			description: "gauge delta",
+			metric:      StatsDMetric{Name: "queue.size", Value: -3, Type: StatsDGauge, Delta: true},
+			expected:    "queue.size:-3|g",
+		},
+		{
+			description: "negative gauge is reset first",
+			metric:      StatsDMetric{Name: "temperature", Value: -5, Type: StatsDGauge, Tags: Tags{"room": "cellar"}},
+			expected:    "temperature:0|g|#room:cellar\ntemperature:-5|g|#room:cellar",
+		},
+		{
+			description: "tag separators are replaced",
+			metric:      StatsDMetric{Name: "requests", Value: 1, Type: StatsDCounter, Tags: Tags{"a:b": "c,d|e:f"}},
+			expected:    "requests:1|c|#a_b:c_d_e_f",
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			if line := s.metric.String(); line != s.expected {
+				t.Errorf("String() returned: %q, expected: %q", line, s.expected)
+			}
+		})
+	}
+}
+
+func TestStatsDSender_Send(t *testing.T) {
+	sender := StatsDSender{Address: ":2014", Timeout: 2 * time.Second}
+
+	packet := getUdpPacket(t, ":2014", func() {
+		err := sender.Send(bytes.NewBufferString(strings.Join([]string{
+			"requests,env=prod 1.000000 1585161000 count,sum,10",
+			"queue.size 12.000000 1585161000 last,10",
+			"request.duration 320.000000 1585161000 avg,count,p90,10",
+		}, "\n")))
+		if err != nil {
+			t.Fatal("Failed to send metrics:", err)
+		}
+	})
+
+	lines := strings.Split(string(packet), "\n")
+	sort.Strings(lines)
+	expected := []string{"queue.size:12|g", "request.duration:320|ms", "requests:1|c|#env:prod"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("sent %q, expected %q", lines, expected)
+	}
+}
+
+func TestStatsDSender_Client(t *testing.T) {
+	client := New(Configuration{
+		DisableAutoFlush: true,
+		Sender:           &StatsDSender{Address: ":2015", Timeout: 2 * time.Second},
+	})
+
+	scenarios := []struct {
+		description string
+		put         func()
+		expected    []string
+	}{
+		{
+			description: "metrics",
+			put: func() {
+				// a space would split the Statful line, the metrics are converted without encoding them
+				client.Gauge("temperature", -5, Tags{"room": "living room"})
+				client.Counter("requests", 1, Tags{})
+			},
+			expected: []string{"requests:1|c", "temperature:-5|g|#room:living room", "temperature:0|g|#room:living room"},
+		},
+		{
+			description: "aggregated metrics",
+			put: func() {
+				client.CounterAggregated("items", 3, Tags{}, AggSum, Freq60s)
+			},
+			expected: []string{"items:3|c"},
+		},
+	}
+
+	for _, s := range scenarios {
+		t.Run(s.description, func(t *testing.T) {
+			packet := getUdpPacket(t, ":2015", func() {
+				s.put()
+				if err := client.FlushError(); err != nil {
+					t.Fatal("Failed to send metrics:", err)
+				}
+			})
+
+			lines := strings.Split(string(packet), "\n")
+			sort.Strings(lines)
+			if !reflect.DeepEqual(lines, s.expected) {
+				t.Errorf("sent %q, expected %q", lines, s.expected)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package statful
 import (
 	"bytes"
 	"fmt"
+	"strings"
 )
 
 type Tags map[string]string
@@ -40,4 +41,24 @@ func (t Tags) String() string {
 	}
 
 	return b.String()
-}
\ No newline at end of file
+}
+
+var lineUnsafeReplacer = strings.NewReplacer(" ", "_", "\t", "_", "\r", "_", "\n", "_", ",", "_", "=", "_")
+
+// sanitizeName replaces the characters that would corrupt a Statful metric line, whitespace, commas and equal
+// signs, with underscores. It is used for names and tags read from external sources, like Prometheus labels.
+func sanitizeName(name string) string {
+	return lineUnsafeReplacer.Replace(name)
+}
+
+// sanitizeTags returns a copy of tags with sanitized keys and values, dropping the tags left without a key or value.
+func sanitizeTags(tags Tags) Tags {
+	sanitized := make(Tags, len(tags))
+	for k, v := range tags {
+		if k, v = sanitizeName(k), sanitizeName(v); k != "" && v != "" {
+			sanitized[k] = v
+		}
+	}
+
+	return sanitized
+}
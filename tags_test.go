@@ -1,6 +1,7 @@
 package statful
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -111,3 +112,12 @@ func TestTags_String(t *testing.T) {
 		})
 	}
 }
+
+func TestSanitizeTags(t *testing.T) {
+	tags := Tags{"room": "living room", "pos": "a,b=c", "new\nline": "x", "empty": "", " ": "blank"}
+
+	expected := Tags{"room": "living_room", "pos": "a_b_c", "new_line": "x", "_": "blank"}
+	if sanitized := sanitizeTags(tags); !reflect.DeepEqual(sanitized, expected) {
+		t.Errorf("sanitizeTags() returned: %v, expected: %v", sanitized, expected)
+	}
+}
@@ -0,0 +1,107 @@
+package statful
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+)
+
+// TcpSender writes newline delimited metrics over a persistent, optionally TLS, connection.
+// Broken connections are re-established with exponential backoff between MinBackoff and MaxBackoff,
+// meanwhile up to MaxBufferSize bytes are kept and sent once reconnected. Timeout applies to dialing and writing.
+type TcpSender struct {
+	Address       string
+	Timeout       time.Duration
+	TLSConfig     *tls.Config
+	MaxBufferSize int
+	MinBackoff    time.Duration
+	MaxBackoff    time.Duration
+
+	// Format defines the metrics line format, e.g. GraphiteEncoder, defaults to Configuration.Encoder.
+	Format Encoder
+
+	once sync.Once
+	conn *persistentConn
+}
+
+func (t *TcpSender) Encoder() Encoder {
+	return t.Format
+}
+
+func (t *TcpSender) Send(data io.Reader) error {
+	return t.SendContext(context.Background(), data)
+}
+
+func (t *TcpSender) SendContext(ctx context.Context, data io.Reader) error {
+	payload, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+
+	return t.stream().write(ctx, payload)
+}
+
+func (t *TcpSender) SendAggregated(io.Reader, Aggregation, AggregationFrequency) error {
+	return ErrUnsupportedOperation
+}
+
+func (t *TcpSender) SendAggregatedContext(context.Context, io.Reader, Aggregation, AggregationFrequency) error {
+	return ErrUnsupportedOperation
+}
+
+func (t *TcpSender) SendEvents(io.Reader) error {
+	return ErrUnsupportedOperation
+}
+
+func (t *TcpSender) SendEventsContext(context.Context, io.Reader) error {
+	return ErrUnsupportedOperation
+}
+
+// Close sends the buffered metrics if connected and closes the connection.
+func (t *TcpSender) Close() error {
+	return t.stream().close()
+}
+
+func (t *TcpSender) stream() *persistentConn {
+	t.once.Do(func() {
+		t.conn = (&persistentConn{
+			dial:         t.dial,
+			writeTimeout: t.Timeout,
+			maxBuffer:    t.MaxBufferSize,
+			minBackoff:   t.MinBackoff,
+			maxBackoff:   t.MaxBackoff,
+		}).withDefaults()
+	})
+
+	return t.conn
+}
+
+func (t *TcpSender) dial(ctx context.Context) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: t.Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", t.Address)
+	if err != nil || t.TLSConfig == nil {
+		return conn, err
+	}
+
+	cfg := t.TLSConfig
+	if cfg.ServerName == "" {
+		cfg = cfg.Clone()
+		cfg.ServerName, _, _ = net.SplitHostPort(t.Address)
+	}
+
+	tlsConn := tls.Client(conn, cfg)
+	if deadline, ok := writeDeadline(ctx, t.Timeout); ok {
+		_ = tlsConn.SetDeadline(deadline)
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = tlsConn.SetDeadline(time.Time{})
+
+	return tlsConn, nil
+}
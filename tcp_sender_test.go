@@ -0,0 +1,136 @@
+package statful
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readLines(t *testing.T, listener net.Listener, count int) []string {
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal("Failed to accept tcp connection:", err)
+	}
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var lines []string
+	scanner := bufio.NewScanner(conn)
+	for len(lines) < count && scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	return lines
+}
+
+func TestTcpSender_Send(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Failed to listen for tcp connections:", err)
+	}
+	defer listener.Close()
+
+	tcp := &TcpSender{Address: listener.Addr().String(), Timeout: time.Second}
+	defer tcp.Close()
+
+	metrics := []string{
+		"test.demo.metric 50 1585161006",
+		"test.demo.metric,Sender=golang,env=test 100 1585161000 count,10",
+	}
+
+	go func() {
+		if err := tcp.Send(bytes.NewBufferString(metrics[0])); err != nil {
+			t.Error("Failed to put metrics:", err)
+		}
+		if err := tcp.Send(bytes.NewBufferString(metrics[1] + "\n")); err != nil {
+			t.Error("Failed to put metrics:", err)
+		}
+	}()
+
+	lines := readLines(t, listener, len(metrics))
+	if strings.Join(lines, "\n") != strings.Join(metrics, "\n") {
+		t.Errorf("different metric lines: expected %v got %v", metrics, lines)
+	}
+}
+
+func TestTcpSender_Reconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Failed to listen for tcp connections:", err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+
+	tcp := &TcpSender{Address: addr, Timeout: time.Second, MinBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	defer tcp.Close()
+
+	// relay is down, metrics are buffered
+	if err := tcp.Send(bytes.NewBufferString("test.demo.metric 1 1585161000")); err != ErrSendBuffered {
+		t.Fatal("expected ErrSendBuffered, got:", err)
+	}
+
+	listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal("Failed to listen for tcp connections:", err)
+	}
+	defer listener.Close()
+	time.Sleep(5 * time.Millisecond)
+
+	go func() {
+		if err := tcp.Send(bytes.NewBufferString("test.demo.metric 2 1585161001")); err != nil {
+			t.Error("Failed to put metrics:", err)
+		}
+	}()
+
+	lines := readLines(t, listener, 2)
+	expected := []string{"test.demo.metric 1 1585161000", "test.demo.metric 2 1585161001"}
+	if strings.Join(lines, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("different metric lines: expected %v got %v", expected, lines)
+	}
+}
+
+func TestTcpSender_BufferFull(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Failed to listen for tcp connections:", err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+
+	tcp := &TcpSender{Address: addr, MaxBufferSize: 40, MinBackoff: time.Minute}
+
+	if err := tcp.Send(bytes.NewBufferString("test.demo.metric 1 1585161000")); err != ErrSendBuffered {
+		t.Fatal("expected ErrSendBuffered, got:", err)
+	}
+	if err := tcp.Send(bytes.NewBufferString("test.demo.metric 2 1585161001")); err != ErrBufferFull {
+		t.Errorf("expected ErrBufferFull, got: %v", err)
+	}
+	if tcp.stream().pending.String() != "test.demo.metric 1 1585161000\n" {
+		t.Errorf("unexpected buffered data: %q", tcp.stream().pending.String())
+	}
+}
+
+func TestTcpSender_BufferedStats(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Failed to listen for tcp connections:", err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close()
+
+	tcp := &TcpSender{Address: addr, MinBackoff: time.Minute}
+	client := New(Configuration{DisableAutoFlush: true, Sender: tcp})
+
+	client.Put("test.demo.metric", 1, Tags{}, 1585161000, Aggregations{}, Freq10s)
+	if err := client.FlushError(); err != nil {
+		t.Fatalf("expected buffered metrics not to fail the flush, got: %v", err)
+	}
+
+	stats := client.Stats()
+	if stats.MetricsBuffered != 1 || stats.MetricsFlushed != 0 || stats.MetricsDropped != 0 {
+		t.Errorf("expected the metric counted as buffered, got: %+v", stats)
+	}
+}
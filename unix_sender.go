@@ -0,0 +1,109 @@
+package statful
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	UnixStream   = "unix"
+	UnixDatagram = "unixgram"
+)
+
+// UnixSender writes metrics to a local agent over a Unix domain socket at Path.
+// Network selects a stream (UnixStream, the default) or datagram (UnixDatagram) socket, datagrams are split
+// on line boundaries to at most MaxDatagramSize bytes. Like TcpSender the connection is kept open, re-established
+// with exponential backoff and up to MaxBufferSize bytes are kept while reconnecting.
+type UnixSender struct {
+	Path            string
+	Network         string
+	Timeout         time.Duration
+	MaxBufferSize   int
+	MaxDatagramSize int
+	MinBackoff      time.Duration
+	MaxBackoff      time.Duration
+
+	// Format defines the metrics line format, e.g. InfluxEncoder, defaults to Configuration.Encoder.
+	Format Encoder
+
+	once sync.Once
+	conn *persistentConn
+}
+
+func (u *UnixSender) Encoder() Encoder {
+	return u.Format
+}
+
+func (u *UnixSender) Send(data io.Reader) error {
+	return u.SendContext(context.Background(), data)
+}
+
+func (u *UnixSender) SendContext(ctx context.Context, data io.Reader) error {
+	payload, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+
+	return u.stream().write(ctx, payload)
+}
+
+func (u *UnixSender) SendAggregated(io.Reader, Aggregation, AggregationFrequency) error {
+	return ErrUnsupportedOperation
+}
+
+func (u *UnixSender) SendAggregatedContext(context.Context, io.Reader, Aggregation, AggregationFrequency) error {
+	return ErrUnsupportedOperation
+}
+
+func (u *UnixSender) SendEvents(io.Reader) error {
+	return ErrUnsupportedOperation
+}
+
+func (u *UnixSender) SendEventsContext(context.Context, io.Reader) error {
+	return ErrUnsupportedOperation
+}
+
+// Close sends the buffered metrics if connected and closes the socket.
+func (u *UnixSender) Close() error {
+	return u.stream().close()
+}
+
+func (u *UnixSender) network() string {
+	if u.Network == "" {
+		return UnixStream
+	}
+
+	return u.Network
+}
+
+func (u *UnixSender) stream() *persistentConn {
+	u.once.Do(func() {
+		datagramSize := 0
+		if u.network() == UnixDatagram {
+			datagramSize = u.MaxDatagramSize
+			if datagramSize <= 0 {
+				datagramSize = DefaultMaxDatagramSize
+			}
+		}
+
+		u.conn = (&persistentConn{
+			dial:         u.dial,
+			writeTimeout: u.Timeout,
+			maxBuffer:    u.MaxBufferSize,
+			datagramSize: datagramSize,
+			minBackoff:   u.MinBackoff,
+			maxBackoff:   u.MaxBackoff,
+		}).withDefaults()
+	})
+
+	return u.conn
+}
+
+func (u *UnixSender) dial(ctx context.Context) (net.Conn, error) {
+	dialer := net.Dialer{Timeout: u.Timeout}
+	return dialer.DialContext(ctx, u.network(), u.Path)
+}
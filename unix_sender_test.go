@@ -0,0 +1,101 @@
+package statful
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnixSender_Stream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statful-unix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen(UnixStream, path)
+	if err != nil {
+		t.Fatal("Failed to listen on unix socket:", err)
+	}
+	defer listener.Close()
+
+	unix := &UnixSender{Path: path, Timeout: time.Second}
+	defer unix.Close()
+
+	metrics := []string{
+		"test.demo.metric 50 1585161006",
+		"test.demo.metric,Sender=golang,env=test 100 1585161000 count,10",
+	}
+
+	go func() {
+		if err := unix.Send(bytes.NewBufferString(strings.Join(metrics, "\n"))); err != nil {
+			t.Error("Failed to put metrics:", err)
+		}
+	}()
+
+	lines := readLines(t, listener, len(metrics))
+	if strings.Join(lines, "\n") != strings.Join(metrics, "\n") {
+		t.Errorf("different metric lines: expected %v got %v", metrics, lines)
+	}
+}
+
+func TestUnixSender_Datagram(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statful-unix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "agent.sock")
+
+	unix := &UnixSender{
+		Path:            path,
+		Network:         UnixDatagram,
+		MaxDatagramSize: 64,
+		MinBackoff:      time.Millisecond,
+		MaxBackoff:      time.Millisecond,
+	}
+	defer unix.Close()
+
+	metrics := []string{
+		"test.demo.metric 50 1585161006",
+		"test.demo.metric 51 1585161007",
+		"test.demo.metric,Sender=golang,env=test 100 1585161000 count,10",
+	}
+
+	// agent is not running yet, metrics are buffered
+	if err := unix.Send(bytes.NewBufferString(metrics[0])); err != ErrSendBuffered {
+		t.Fatal("expected ErrSendBuffered, got:", err)
+	}
+
+	listener, err := net.ListenUnixgram(UnixDatagram, &net.UnixAddr{Name: path, Net: UnixDatagram})
+	if err != nil {
+		t.Fatal("Failed to listen on unix socket:", err)
+	}
+	defer listener.Close()
+	time.Sleep(5 * time.Millisecond)
+
+	if err := unix.Send(bytes.NewBufferString(strings.Join(metrics[1:], "\n"))); err != nil {
+		t.Fatal("Failed to put metrics:", err)
+	}
+
+	var datagrams []string
+	message := make([]byte, 1024)
+	for len(datagrams) < 2 {
+		_ = listener.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := listener.Read(message)
+		if err != nil {
+			t.Fatal("Failed to read datagram:", err)
+		}
+		datagrams = append(datagrams, string(message[:n]))
+	}
+
+	expected := []string{strings.Join(metrics[:2], "\n"), metrics[2]}
+	if strings.Join(datagrams, "|") != strings.Join(expected, "|") {
+		t.Errorf("different datagrams: expected %q got %q", expected, datagrams)
+	}
+}
@@ -0,0 +1,78 @@
+package statful
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// WriterSender writes metrics and events to Writer in the replayable capture format.
+type WriterSender struct {
+	Writer io.Writer
+
+	mu sync.Mutex
+}
+
+func (w *WriterSender) Send(data io.Reader) error {
+	return w.SendContext(context.Background(), data)
+}
+
+func (w *WriterSender) SendContext(ctx context.Context, data io.Reader) error {
+	return w.write(ctx, data, func(dst *bytes.Buffer, payload []byte) error {
+		appendCaptureMetrics(dst, payload, "")
+		return nil
+	})
+}
+
+func (w *WriterSender) SendAggregated(data io.Reader, agg Aggregation, freq AggregationFrequency) error {
+	return w.SendAggregatedContext(context.Background(), data, agg, freq)
+}
+
+func (w *WriterSender) SendAggregatedContext(ctx context.Context, data io.Reader, agg Aggregation, freq AggregationFrequency) error {
+	return w.write(ctx, data, func(dst *bytes.Buffer, payload []byte) error {
+		appendCaptureMetrics(dst, payload, captureAggregatedLinePrefix(agg, freq))
+		return nil
+	})
+}
+
+func (w *WriterSender) SendEvents(data io.Reader) error {
+	return w.SendEventsContext(context.Background(), data)
+}
+
+func (w *WriterSender) SendEventsContext(ctx context.Context, data io.Reader) error {
+	return w.write(ctx, data, appendCaptureEvents)
+}
+
+func (w *WriterSender) EventSerializer() EventSerializer {
+	return NdjsonSerializer{}
+}
+
+// Encoder returns StatfulEncoder, the capture format is replayed as Statful lines.
+func (w *WriterSender) Encoder() Encoder {
+	return StatfulEncoder{}
+}
+
+// write encodes the payload and writes it unless ctx is done, a started write isn't interrupted.
+func (w *WriterSender) write(ctx context.Context, data io.Reader, encode func(*bytes.Buffer, []byte) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	payload, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	if err := encode(&b, payload); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	_, err = w.Writer.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,99 @@
+package statful
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestWriterSender(t *testing.T) {
+	var out bytes.Buffer
+	client := New(Configuration{
+		DisableAutoFlush: true,
+		Sender:           &WriterSender{Writer: &out},
+	})
+
+	client.Put("test.demo.metric", 100, Tags{"env": "test"}, 1585161000, Aggregations{AggCount: nothing}, Freq10s)
+	client.PutAggregated("test.demo.aggregated", 200, Tags{}, 1585161001, AggAvg, Freq30s)
+	if err := client.FlushError(); err != nil {
+		t.Fatalf("FlushError() returned error: %v", err)
+	}
+
+	client.Event(expectedEvent)
+	client.Event(expectedEvent)
+	if err := client.FlushEvents(); err != nil {
+		t.Fatalf("FlushEvents() returned error: %v", err)
+	}
+
+	expected := []string{
+		"test.demo.metric,env=test 100.000000 1585161000 count,10",
+		"@avg,30 test.demo.aggregated 200.000000 1585161001",
+		strings.Trim(expectedJson, "[]"),
+		strings.Trim(expectedJson, "[]"),
+		"",
+	}
+	if out.String() != strings.Join(expected, "\n") {
+		t.Errorf("captured:\n%s\nexpected:\n%s", out.String(), strings.Join(expected, "\n"))
+	}
+}
+
+func TestWriterSender_EventsJsonArray(t *testing.T) {
+	var out bytes.Buffer
+	sender := &WriterSender{Writer: &out}
+
+	if err := sender.SendEvents(bytes.NewBufferString("[" + strings.Trim(expectedJson, "[]") + ", {\"eventId\": \"2\"}]")); err != nil {
+		t.Fatalf("SendEvents() returned error: %v", err)
+	}
+
+	expected := strings.Trim(expectedJson, "[]") + "\n" + `{"eventId":"2"}` + "\n"
+	if out.String() != expected {
+		t.Errorf("captured:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
+
+func TestWriterSender_EventsEnvelope(t *testing.T) {
+	var out bytes.Buffer
+	sender := &WriterSender{Writer: &out}
+
+	var payload bytes.Buffer
+	if err := (EnvelopeSerializer{}).Serialize(&payload, []Event{{EventId: "1"}, {EventId: "2"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.SendEvents(&payload); err != nil {
+		t.Fatalf("SendEvents() returned error: %v", err)
+	}
+
+	var records []CaptureRecord
+	scanner := NewCaptureScanner(&out)
+	for scanner.Scan() {
+		record, err := scanner.Record()
+		if err != nil {
+			t.Fatalf("Record() returned error: %v", err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 {
+		t.Fatalf("expected 2 captured events, got: %v", records)
+	}
+	for i, id := range []string{`"eventId":"1"`, `"eventId":"2"`} {
+		if records[i].Kind != CaptureEvent || !strings.Contains(records[i].Line, id) {
+			t.Errorf("record %d: %+v, expected an event with %s", i, records[i], id)
+		}
+	}
+}
+
+func TestWriterSender_CanceledContext(t *testing.T) {
+	var out bytes.Buffer
+	sender := &WriterSender{Writer: &out}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := sender.SendContext(ctx, bytes.NewBufferString("metric 1 1")); err != context.Canceled {
+		t.Errorf("SendContext() returned: %v, expected: %v", err, context.Canceled)
+	}
+	if out.Len() != 0 {
+		t.Errorf("expected nothing written, got: %q", out.String())
+	}
+}